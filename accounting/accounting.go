@@ -0,0 +1,111 @@
+// Package accounting выгружает заказы за период для учетной системы (например, 1С):
+// в CSV (строка на каждую позицию заказа) и в формате обмена CommerceML 2.
+package accounting
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Order - заказ вместе с позициями.
+type Order struct {
+	models.Order
+	Items []Item
+}
+
+// Item - позиция заказа с названием пива.
+type Item struct {
+	models.OrderItem
+	Name string // Название пива (пустое, если пиво удалено из каталога)
+}
+
+// Sum возвращает стоимость позиции по цене на момент оформления.
+func (item Item) Sum() float64 {
+	return float64(item.Quantity) * item.Price
+}
+
+// LoadOrders загружает заказы, оформленные с from (включительно) до to, в порядке оформления.
+func LoadOrders(ctx context.Context, db *sql.DB, from, to time.Time) ([]Order, error) {
+	orders, err := database.ListOrders(ctx, db, database.OrderFilter{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].OrderDate.Equal(orders[j].OrderDate) {
+			return orders[i].OrderDate.Before(orders[j].OrderDate)
+		}
+		return orders[i].ID < orders[j].ID
+	})
+
+	orderIDs := make([]int64, 0, len(orders))
+	for _, order := range orders {
+		orderIDs = append(orderIDs, order.ID)
+	}
+	items, err := database.GetOrderItemsByOrderIDs(ctx, db, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var beerIDs []int
+	seen := make(map[int]bool)
+	for _, orderItems := range items {
+		for _, item := range orderItems {
+			if !seen[item.BeerID] {
+				seen[item.BeerID] = true
+				beerIDs = append(beerIDs, item.BeerID)
+			}
+		}
+	}
+	beers, err := database.GetBeersByIDs(ctx, db, beerIDs)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int]string, len(beers))
+	for _, beer := range beers {
+		names[beer.ID] = beer.Name
+	}
+
+	result := make([]Order, 0, len(orders))
+	for _, order := range orders {
+		exported := Order{Order: order}
+		for _, item := range items[order.ID] {
+			exported.Items = append(exported.Items, Item{OrderItem: item, Name: names[item.BeerID]})
+		}
+		result = append(result, exported)
+	}
+	return result, nil
+}
+
+// customerName возвращает имя и фамилию покупателя, а если их нет - имя пользователя или ID.
+func customerName(user models.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	switch {
+	case name != "":
+		return name
+	case user.Username != "":
+		return "@" + user.Username
+	default:
+		return "ID " + strconv.FormatInt(user.ID, 10)
+	}
+}
+
+// statusTitle возвращает название статуса заказа на русском языке (для статусов без перевода - сам статус).
+func statusTitle(status string) string {
+	key := "order.status." + status
+	if title := i18n.New("ru").T(key); title != key {
+		return title
+	}
+	return status
+}
+
+// formatMoney форматирует сумму с двумя знаками после точки.
+func formatMoney(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
@@ -0,0 +1,146 @@
+package accounting
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+// commerceMLVersion - версия схемы CommerceML, которую загружают типовые конфигурации 1С.
+const commerceMLVersion = "2.10"
+
+// Элементы документа CommerceML. Названия элементов и реквизитов заданы стандартом обмена.
+type (
+	commerceInfo struct {
+		XMLName   xml.Name   `xml:"КоммерческаяИнформация"`
+		Version   string     `xml:"ВерсияСхемы,attr"`
+		Generated string     `xml:"ДатаФормирования,attr"`
+		Documents []document `xml:"Документ"`
+	}
+
+	document struct {
+		ID         string         `xml:"Ид"`
+		Number     string         `xml:"Номер"`
+		Date       string         `xml:"Дата"`
+		Time       string         `xml:"Время"`
+		Operation  string         `xml:"ХозОперация"`
+		Role       string         `xml:"Роль"`
+		Currency   string         `xml:"Валюта"`
+		Rate       int            `xml:"Курс"`
+		Sum        string         `xml:"Сумма"`
+		Customers  []counterparty `xml:"Контрагенты>Контрагент"`
+		Products   []product      `xml:"Товары>Товар"`
+		Properties []property     `xml:"ЗначенияРеквизитов>ЗначениеРеквизита"`
+	}
+
+	counterparty struct {
+		ID       string    `xml:"Ид"`
+		Name     string    `xml:"Наименование"`
+		Role     string    `xml:"Роль"`
+		FullName string    `xml:"ПолноеНаименование"`
+		Contacts []contact `xml:"Контакты>Контакт,omitempty"`
+	}
+
+	contact struct {
+		Type  string `xml:"Тип"`
+		Value string `xml:"Значение"`
+	}
+
+	product struct {
+		ID         string     `xml:"Ид"`
+		Name       string     `xml:"Наименование"`
+		Unit       unit       `xml:"БазоваяЕдиница"`
+		Price      string     `xml:"ЦенаЗаЕдиницу"`
+		Quantity   int        `xml:"Количество"`
+		Sum        string     `xml:"Сумма"`
+		Properties []property `xml:"ЗначенияРеквизитов>ЗначениеРеквизита"`
+	}
+
+	unit struct {
+		Code     string `xml:"Код,attr"`
+		FullName string `xml:"НаименованиеПолное,attr"`
+		Abbr     string `xml:"МеждународноеСокращение,attr"`
+		Name     string `xml:",chardata"`
+	}
+
+	property struct {
+		Name  string `xml:"Наименование"`
+		Value string `xml:"Значение"`
+	}
+)
+
+// pieces - единица измерения "штука" по ОКЕИ.
+var pieces = unit{Code: "796", FullName: "Штука", Abbr: "PCE", Name: "шт"}
+
+// WriteCommerceML записывает заказы в формате обмена CommerceML 2 (документы "Заказ товара"),
+// который загружают обработки обмена с сайтом в 1С. Дата и время документов записываются
+// в часовом поясе loc, generated - время формирования выгрузки.
+func WriteCommerceML(w io.Writer, orders []Order, generated time.Time, loc *time.Location) error {
+	info := commerceInfo{
+		Version:   commerceMLVersion,
+		Generated: generated.In(loc).Format("2006-01-02T15:04:05"),
+		Documents: make([]document, 0, len(orders)),
+	}
+	for _, order := range orders {
+		date := order.OrderDate.In(loc)
+		customerID := strconv.FormatInt(order.UserID, 10)
+		customer := counterparty{
+			ID:       customerID,
+			Name:     customerName(order.Customer),
+			Role:     "Покупатель",
+			FullName: customerName(order.Customer),
+		}
+		if order.Customer.Username != "" {
+			customer.Contacts = []contact{{Type: "Telegram", Value: "@" + order.Customer.Username}}
+		}
+
+		doc := document{
+			ID:        strconv.FormatInt(order.ID, 10),
+			Number:    strconv.FormatInt(order.ID, 10),
+			Date:      date.Format(time.DateOnly),
+			Time:      date.Format(time.TimeOnly),
+			Operation: "Заказ товара",
+			Role:      "Продавец",
+			Currency:  "руб",
+			Rate:      1,
+			Sum:       formatMoney(order.Total),
+			Customers: []counterparty{customer},
+			Properties: []property{
+				{Name: "Статус заказа", Value: statusTitle(order.Status)},
+				{Name: "Отменен", Value: strconv.FormatBool(order.Status == "cancelled")},
+				{Name: "ID покупателя в Telegram", Value: customerID},
+			},
+		}
+		for _, item := range order.Items {
+			name := item.Name
+			if name == "" {
+				name = "Пиво (ID: " + strconv.Itoa(item.BeerID) + ")"
+			}
+			doc.Products = append(doc.Products, product{
+				ID:       strconv.Itoa(item.BeerID),
+				Name:     name,
+				Unit:     pieces,
+				Price:    formatMoney(item.Price),
+				Quantity: item.Quantity,
+				Sum:      formatMoney(item.Sum()),
+				Properties: []property{
+					{Name: "ВидНоменклатуры", Value: "Товар"},
+					{Name: "ТипНоменклатуры", Value: "Товар"},
+				},
+			})
+		}
+		info.Documents = append(info.Documents, doc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
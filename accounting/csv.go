@@ -0,0 +1,55 @@
+package accounting
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// utf8BOM - метка порядка байтов UTF-8 в начале CSV-файла.
+const utf8BOM = "\ufeff"
+
+// csvHeader - столбцы CSV-файла заказов.
+var csvHeader = []string{
+	"order_id", "order_date", "status", "customer_id", "customer_username", "customer_name",
+	"beer_id", "beer_name", "quantity", "price", "sum", "order_total",
+}
+
+// WriteCSV записывает заказы в CSV-файл: строка на каждую позицию заказа (заказ без позиций -
+// одна строка с пустыми столбцами позиции). Время заказа записывается в часовом поясе loc.
+// Файл начинается с метки UTF-8, чтобы таблицы правильно определяли кодировку.
+func WriteCSV(w io.Writer, orders []Order, loc *time.Location) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	writer.Write(csvHeader)
+	for _, order := range orders {
+		head := []string{
+			strconv.FormatInt(order.ID, 10),
+			order.OrderDate.In(loc).Format(time.DateTime),
+			order.Status,
+			strconv.FormatInt(order.UserID, 10),
+			order.Customer.Username,
+			customerName(order.Customer),
+		}
+		total := formatMoney(order.Total)
+		if len(order.Items) == 0 {
+			writer.Write(append(head, "", "", "", "", "", total))
+			continue
+		}
+		for _, item := range order.Items {
+			writer.Write(append(head[:len(head):len(head)],
+				strconv.Itoa(item.BeerID),
+				item.Name,
+				strconv.Itoa(item.Quantity),
+				formatMoney(item.Price),
+				formatMoney(item.Sum()),
+				total,
+			))
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,203 @@
+// Package api содержит HTTP API администрирования в формате JSON: каталог пива, остатки и заказы.
+//
+// Все запросы, кроме описания API (GET /api/v1/openapi.json), требуют ключ в заголовке
+// Authorization: Bearer <ключ> или X-API-Key. Ошибки возвращаются в виде {"error": "..."}.
+package api
+
+import (
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/metrics"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBodySize - максимальный размер тела запроса.
+const maxBodySize = 1 << 20
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+var (
+	requests = metrics.NewCounterVec("beer_bot_api_requests_total",
+		"Запросы к API администрирования по маршруту и коду ответа.", "route", "code")
+	requestDuration = metrics.NewHistogramVec("beer_bot_api_request_duration_seconds",
+		"Время обработки запросов к API администрирования в секундах.", metrics.DefaultBuckets, "route")
+)
+
+// server обрабатывает запросы API.
+type server struct {
+	db     *sql.DB
+	keys   map[[sha256.Size]byte]string // Хэши ключей и имена клиентов
+	logger *slog.Logger
+}
+
+// Handler возвращает обработчик API с маршрутами /api/v1/...
+// keys сопоставляет ключам API имена клиентов, которые записываются в журнал.
+func Handler(db *sql.DB, keys map[string]string, logger *slog.Logger) http.Handler {
+	s := &server{db: db, keys: make(map[[sha256.Size]byte]string, len(keys)), logger: logger}
+	for key, name := range keys {
+		s.keys[sha256.Sum256([]byte(key))] = name
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/openapi.json", s.route("openapi", false, s.handleOpenAPI))
+
+	mux.Handle("GET /api/v1/beers", s.route("list_beers", true, s.handleListBeers))
+	mux.Handle("POST /api/v1/beers", s.route("create_beer", true, s.handleCreateBeer))
+	mux.Handle("GET /api/v1/beers/{id}", s.route("get_beer", true, s.handleGetBeer))
+	mux.Handle("PATCH /api/v1/beers/{id}", s.route("update_beer", true, s.handleUpdateBeer))
+	mux.Handle("POST /api/v1/beers/{id}/stock", s.route("adjust_stock", true, s.handleAdjustStock))
+
+	mux.Handle("GET /api/v1/orders", s.route("list_orders", true, s.handleListOrders))
+	mux.Handle("GET /api/v1/orders/{id}", s.route("get_order", true, s.handleGetOrder))
+	mux.Handle("PUT /api/v1/orders/{id}/status", s.route("set_order_status", true, s.handleSetOrderStatus))
+
+	mux.Handle("/api/", s.route("not_found", false, func(w http.ResponseWriter, r *http.Request) error {
+		return errNotFound
+	}))
+	return mux
+}
+
+// apiError - ошибка с кодом ответа HTTP, текст которой возвращается клиенту.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string { return e.message }
+
+// errorf создает ошибку с кодом ответа status.
+func errorf(status int, format string, args ...any) error {
+	return &apiError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	errNotFound     = errorf(http.StatusNotFound, "не найдено")
+	errUnauthorized = errorf(http.StatusUnauthorized, "требуется ключ API")
+)
+
+// handlerFunc обрабатывает запрос; ошибки, кроме *apiError, считаются внутренними (500).
+type handlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// statusRecorder запоминает код ответа для метрик и журнала.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// route оборачивает обработчик маршрута name: проверяет ключ (если auth), пишет журнал и метрики
+// и превращает ошибки в ответы JSON.
+func (s *server) route(name string, auth bool, handler handlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		logger := s.logger.With(logging.Handler, "api:"+name, "method", r.Method, "path", r.URL.Path)
+
+		err := func() error {
+			ctx := r.Context()
+			if auth {
+				client, ok := s.authenticate(r)
+				if !ok {
+					return errUnauthorized
+				}
+				logger = logger.With("api_client", client)
+				ctx = context.WithValue(ctx, clientKey{}, client)
+			}
+			r = r.WithContext(logging.NewContext(ctx, logger))
+			r.Body = http.MaxBytesReader(recorder, r.Body, maxBodySize)
+			return handler(recorder, r)
+		}()
+		if err != nil {
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) {
+				logger.Error("Ошибка при обработке запроса API", logging.Error, err)
+				apiErr = &apiError{status: http.StatusInternalServerError, message: "внутренняя ошибка"}
+			}
+			if apiErr.status == http.StatusUnauthorized {
+				recorder.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			writeJSON(recorder, apiErr.status, map[string]string{"error": apiErr.message})
+		}
+
+		requests.With(name, strconv.Itoa(recorder.status)).Inc()
+		requestDuration.With(name).Observe(time.Since(start).Seconds())
+		logger.Debug("Запрос API обработан", "status", recorder.status, "duration_ms", time.Since(start).Milliseconds())
+	})
+}
+
+// clientKey - ключ контекста запроса, под которым хранится имя клиента API.
+type clientKey struct{}
+
+// clientName возвращает имя клиента, выполнившего запрос с ключом API.
+func clientName(r *http.Request) string {
+	client, _ := r.Context().Value(clientKey{}).(string)
+	return client
+}
+
+// authenticate проверяет ключ API из заголовка Authorization (Bearer) или X-API-Key
+// и возвращает имя клиента.
+func (s *server) authenticate(r *http.Request) (string, bool) {
+	key := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		key = strings.TrimSpace(bearer)
+	}
+	if key == "" {
+		return "", false
+	}
+	// Ключи сравниваются по хэшу за постоянное время, чтобы время ответа не выдавало ключ
+	hash := sha256.Sum256([]byte(key))
+	for known, name := range s.keys {
+		if subtle.ConstantTimeCompare(hash[:], known[:]) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (s *server) handleOpenAPI(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(openAPISpec)
+	return err
+}
+
+// writeJSON отправляет value в формате JSON с кодом ответа status.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// readJSON читает тело запроса в формате JSON в value; неизвестные поля считаются ошибкой.
+func readJSON(r *http.Request, value any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return errorf(http.StatusBadRequest, "некорректное тело запроса: %v", err)
+	}
+	return nil
+}
+
+// pathID возвращает числовой параметр {id} пути запроса.
+func pathID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errorf(http.StatusBadRequest, "некорректный ID %q", r.PathValue("id"))
+	}
+	return id, nil
+}
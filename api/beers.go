@@ -0,0 +1,186 @@
+package api
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/models"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Изменения пива попадают в каталог бота через триггеры базы данных (см. catalog.Run),
+// поэтому обработчики работают с базой данных напрямую.
+
+// beerInput - тело запроса на создание или изменение пива; nil означает, что поле не задано.
+type beerInput struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Price       *float64 `json:"price"`
+	Quantity    *int     `json:"quantity"`
+	ImageURL    *string  `json:"image_url"`
+	Type        *string  `json:"type"`
+}
+
+// validate проверяет заданные поля и убирает пробелы вокруг названия и типа;
+// при создании (create) название и цена обязательны.
+func (in *beerInput) validate(create bool) error {
+	for _, field := range []*string{in.Name, in.Type} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+	switch {
+	case create && in.Name == nil:
+		return errorf(http.StatusBadRequest, "не задано название пива (name)")
+	case create && in.Price == nil:
+		return errorf(http.StatusBadRequest, "не задана цена пива (price)")
+	case in.Name != nil && *in.Name == "":
+		return errorf(http.StatusBadRequest, "название пива (name) не может быть пустым")
+	case in.Price != nil && *in.Price <= 0:
+		return errorf(http.StatusBadRequest, "цена пива (price) должна быть положительной")
+	case in.Quantity != nil && *in.Quantity < 0:
+		return errorf(http.StatusBadRequest, "количество пива (quantity) не может быть отрицательным")
+	}
+	return nil
+}
+
+// handleListBeers возвращает пиво из каталога, при заданном ?type= - только пиво этого типа.
+func (s *server) handleListBeers(w http.ResponseWriter, r *http.Request) error {
+	beers, err := database.GetBeers(r.Context(), s.db)
+	if err != nil {
+		return err
+	}
+	result := []models.Beer{}
+	beerType := r.URL.Query().Get("type")
+	for _, beer := range beers {
+		if beerType == "" || beer.Type == beerType {
+			result = append(result, beer)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+	return nil
+}
+
+func (s *server) handleGetBeer(w http.ResponseWriter, r *http.Request) error {
+	beerID, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	beer, err := database.GetBeer(r.Context(), s.db, int(beerID))
+	if err != nil {
+		return err
+	}
+	if beer == nil {
+		return errNotFound
+	}
+	writeJSON(w, http.StatusOK, beer)
+	return nil
+}
+
+func (s *server) handleCreateBeer(w http.ResponseWriter, r *http.Request) error {
+	var in beerInput
+	if err := readJSON(r, &in); err != nil {
+		return err
+	}
+	if err := in.validate(true); err != nil {
+		return err
+	}
+	beer := models.Beer{Name: *in.Name, Price: *in.Price}
+	if in.Description != nil {
+		beer.Description = *in.Description
+	}
+	if in.Quantity != nil {
+		beer.Quantity = *in.Quantity
+	}
+	if in.ImageURL != nil {
+		beer.ImageURL = *in.ImageURL
+	}
+	if in.Type != nil {
+		beer.Type = *in.Type
+	}
+
+	beerID, err := database.CreateBeer(r.Context(), s.db, beer)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(r.Context()).Info("Пиво добавлено через API", "beer_id", beerID, "name", beer.Name)
+	return s.respondBeer(w, r, beerID, http.StatusCreated)
+}
+
+func (s *server) handleUpdateBeer(w http.ResponseWriter, r *http.Request) error {
+	beerID, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var in beerInput
+	if err := readJSON(r, &in); err != nil {
+		return err
+	}
+	if err := in.validate(false); err != nil {
+		return err
+	}
+
+	updated, err := database.UpdateBeer(r.Context(), s.db, int(beerID), database.BeerUpdate{
+		Name:        in.Name,
+		Description: in.Description,
+		Price:       in.Price,
+		Quantity:    in.Quantity,
+		ImageURL:    in.ImageURL,
+		Type:        in.Type,
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return errNotFound
+	}
+	logging.FromContext(r.Context()).Info("Пиво изменено через API", "beer_id", beerID)
+	return s.respondBeer(w, r, int(beerID), http.StatusOK)
+}
+
+// stockInput - тело запроса на изменение остатка пива.
+type stockInput struct {
+	Delta *int `json:"delta"` // Изменение количества: положительное - поступление, отрицательное - списание
+}
+
+func (s *server) handleAdjustStock(w http.ResponseWriter, r *http.Request) error {
+	beerID, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var in stockInput
+	if err := readJSON(r, &in); err != nil {
+		return err
+	}
+	if in.Delta == nil || *in.Delta == 0 {
+		return errorf(http.StatusBadRequest, "не задано изменение количества (delta)")
+	}
+
+	quantity, previous, err := database.AdjustBeerQuantity(r.Context(), s.db, int(beerID), *in.Delta)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return errNotFound
+	case errors.Is(err, database.ErrNegativeStock):
+		return errorf(http.StatusConflict, "%v", err)
+	case err != nil:
+		return err
+	}
+	logging.FromContext(r.Context()).Info("Остаток пива изменен через API",
+		"beer_id", beerID, "delta", *in.Delta, "previous", previous, "quantity", quantity)
+	return s.respondBeer(w, r, int(beerID), http.StatusOK)
+}
+
+// respondBeer отправляет пиво с ID beerID в том виде, в котором оно сохранено в базе данных.
+func (s *server) respondBeer(w http.ResponseWriter, r *http.Request, beerID int, status int) error {
+	beer, err := database.GetBeer(r.Context(), s.db, beerID)
+	if err != nil {
+		return err
+	}
+	if beer == nil {
+		return errNotFound
+	}
+	writeJSON(w, status, beer)
+	return nil
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/models"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOrdersLimit = 50  // Количество заказов в ответе по умолчанию
+	maxOrdersLimit     = 500 // Максимальное количество заказов в одном ответе
+)
+
+// handleListOrders возвращает заказы, начиная с новых. Параметры запроса:
+// status, user_id, from и to (RFC 3339 или ГГГГ-ММ-ДД; to не включается), limit и offset.
+func (s *server) handleListOrders(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	filter := database.OrderFilter{Status: query.Get("status"), Limit: defaultOrdersLimit}
+
+	var err error
+	if value := query.Get("user_id"); value != "" {
+		if filter.UserID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return errorf(http.StatusBadRequest, "некорректный user_id %q", value)
+		}
+	}
+	if filter.From, err = parseTime(query.Get("from")); err != nil {
+		return errorf(http.StatusBadRequest, "некорректное значение from: %v", err)
+	}
+	if filter.To, err = parseTime(query.Get("to")); err != nil {
+		return errorf(http.StatusBadRequest, "некорректное значение to: %v", err)
+	}
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit <= 0 || filter.Limit > maxOrdersLimit {
+			return errorf(http.StatusBadRequest, "limit должен быть от 1 до %d", maxOrdersLimit)
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		filter.Offset, err = strconv.Atoi(value)
+		if err != nil || filter.Offset < 0 {
+			return errorf(http.StatusBadRequest, "некорректный offset %q", value)
+		}
+	}
+
+	orders, err := database.ListOrders(r.Context(), s.db, filter)
+	if err != nil {
+		return err
+	}
+	if orders == nil {
+		orders = []models.Order{}
+	}
+	writeJSON(w, http.StatusOK, orders)
+	return nil
+}
+
+// parseTime разбирает время в формате RFC 3339 или дату ГГГГ-ММ-ДД (полночь UTC).
+// Пустая строка дает нулевое время.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// orderItem - позиция заказа в ответе API вместе с названием пива.
+type orderItem struct {
+	models.OrderItem
+	Name string `json:"name"` // Название пива (пустое, если пиво удалено из каталога)
+}
+
+// orderDetails - заказ вместе с позициями и историей статусов.
+type orderDetails struct {
+	models.Order
+	Items   []orderItem                `json:"items"`
+	History []models.OrderStatusChange `json:"history"`
+}
+
+func (s *server) handleGetOrder(w http.ResponseWriter, r *http.Request) error {
+	orderID, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	order, err := database.GetOrder(r.Context(), s.db, orderID)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return errNotFound
+	}
+	items, err := database.GetOrderItems(r.Context(), s.db, orderID)
+	if err != nil {
+		return err
+	}
+
+	beerIDs := make([]int, 0, len(items))
+	for _, item := range items {
+		beerIDs = append(beerIDs, item.BeerID)
+	}
+	beers, err := database.GetBeersByIDs(r.Context(), s.db, beerIDs)
+	if err != nil {
+		return err
+	}
+	names := make(map[int]string, len(beers))
+	for _, beer := range beers {
+		names[beer.ID] = beer.Name
+	}
+
+	history, err := database.GetOrderStatusHistory(r.Context(), s.db, orderID)
+	if err != nil {
+		return err
+	}
+	if history == nil {
+		history = []models.OrderStatusChange{}
+	}
+
+	details := orderDetails{Order: *order, Items: make([]orderItem, 0, len(items)), History: history}
+	for _, item := range items {
+		details.Items = append(details.Items, orderItem{OrderItem: item, Name: names[item.BeerID]})
+	}
+	writeJSON(w, http.StatusOK, details)
+	return nil
+}
+
+// statusInput - тело запроса на изменение статуса заказа.
+type statusInput struct {
+	Status string `json:"status"`
+}
+
+func (s *server) handleSetOrderStatus(w http.ResponseWriter, r *http.Request) error {
+	orderID, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var in statusInput
+	if err := readJSON(r, &in); err != nil {
+		return err
+	}
+
+	_, err = database.ChangeOrderStatus(r.Context(), s.db, orderID, strings.TrimSpace(in.Status), "api:"+clientName(r))
+	var transitionErr *database.OrderTransitionError
+	switch {
+	case errors.Is(err, database.ErrUnknownOrderStatus):
+		return errorf(http.StatusBadRequest, "неизвестный статус заказа %q, ожидается один из: %s",
+			in.Status, strings.Join(models.OrderStatuses, ", "))
+	case errors.As(err, &transitionErr):
+		next := database.NextOrderStatuses(transitionErr.From)
+		if len(next) == 0 {
+			return errorf(http.StatusConflict, "%v: статус %s окончательный", err, transitionErr.From)
+		}
+		return errorf(http.StatusConflict, "%v, возможные статусы: %s", err, strings.Join(next, ", "))
+	case errors.Is(err, sql.ErrNoRows):
+		return errNotFound
+	case err != nil:
+		return err
+	}
+
+	order, err := database.GetOrder(r.Context(), s.db, orderID)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return errNotFound
+	}
+	writeJSON(w, http.StatusOK, order)
+	return nil
+}
@@ -0,0 +1,225 @@
+// Package catalog хранит каталог пива в памяти и отвечает на запросы пива по ID и типу.
+//
+// Каталог загружается целиком при запуске, обновляется по уведомлениям базы данных
+// (см. Run) и периодически перезагружается. Пиво, которого нет в каталоге, запрашивается
+// из базы данных одним запросом на все недостающие ID.
+package catalog
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/metrics"
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+)
+
+// Catalog - каталог пива с индексами по ID и типу.
+// Списки пива, которые возвращает Catalog, общие для всех вызывающих и не должны изменяться.
+type Catalog struct {
+	mu     sync.RWMutex
+	loaded bool
+	beers  []models.Beer            // Все пиво в порядке ID
+	byID   map[int]models.Beer      // Пиво по ID
+	byType map[string][]models.Beer // Пиво по типу в порядке ID
+	types  []string                 // Типы пива по алфавиту
+}
+
+// New создает пустой каталог. До первой загрузки (Refresh) все пиво запрашивается из базы данных.
+func New() *Catalog {
+	c := &Catalog{}
+	c.index(nil)
+	return c
+}
+
+// index перестраивает индексы по списку beers, отсортированному по ID.
+// Вызывается с захваченным мьютексом (или до начала использования каталога).
+func (c *Catalog) index(beers []models.Beer) {
+	c.beers = beers
+	c.byID = make(map[int]models.Beer, len(beers))
+	c.byType = make(map[string][]models.Beer)
+	c.types = nil
+	for _, beer := range beers {
+		c.byID[beer.ID] = beer
+		if beer.Type == "" {
+			continue
+		}
+		if _, ok := c.byType[beer.Type]; !ok {
+			c.types = append(c.types, beer.Type)
+		}
+		c.byType[beer.Type] = append(c.byType[beer.Type], beer)
+	}
+	sort.Strings(c.types)
+}
+
+// replace заменяет список пива и возвращает пиво, которое снова появилось в наличии,
+// и признак того, что у какого-либо пива изменился остаток. Вызывается с захваченным мьютексом.
+func (c *Catalog) replace(beers []models.Beer) (restocked []models.Beer, stockChanged bool) {
+	stockChanged = !c.loaded
+	if c.loaded {
+		restocked = database.FindRestocked(c.beers, beers)
+		stockChanged = quantityChanged(c.beers, beers)
+	}
+	c.index(beers)
+	c.loaded = true
+	return restocked, stockChanged
+}
+
+// quantityChanged сообщает, есть ли в newBeers пиво, которого не было в oldBeers
+// или остаток которого отличается.
+func quantityChanged(oldBeers, newBeers []models.Beer) bool {
+	quantities := make(map[int]int, len(oldBeers))
+	for _, beer := range oldBeers {
+		quantities[beer.ID] = beer.Quantity
+	}
+	for _, beer := range newBeers {
+		if quantity, ok := quantities[beer.ID]; !ok || quantity != beer.Quantity {
+			return true
+		}
+	}
+	return false
+}
+
+// Refresh загружает каталог из базы данных целиком и возвращает пиво,
+// которое снова появилось в наличии (при первой загрузке - ничего).
+func (c *Catalog) Refresh(ctx context.Context, db *sql.DB) ([]models.Beer, error) {
+	restocked, _, err := c.refresh(ctx, db)
+	return restocked, err
+}
+
+// refresh загружает каталог из базы данных целиком и возвращает пиво, которое снова появилось
+// в наличии, и признак того, что у какого-либо пива изменился остаток.
+func (c *Catalog) refresh(ctx context.Context, db *sql.DB) ([]models.Beer, bool, error) {
+	beers, err := database.GetBeers(ctx, db)
+	if err != nil {
+		return nil, false, err
+	}
+	metrics.CatalogRefreshed()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	restocked, stockChanged := c.replace(beers)
+	return restocked, stockChanged, nil
+}
+
+// update заменяет в каталоге пиво с ID из ids на changed; пиво, которого нет в changed,
+// удаляется из каталога. Возвращает пиво, которое снова появилось в наличии,
+// и признак того, что у какого-либо пива изменился остаток.
+func (c *Catalog) update(ids []int, changed []models.Beer) ([]models.Beer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	requested := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		requested[id] = true
+	}
+	merged := make([]models.Beer, 0, len(c.beers)+len(changed))
+	for _, beer := range c.beers {
+		if !requested[beer.ID] {
+			merged = append(merged, beer)
+		}
+	}
+	merged = append(merged, changed...)
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ID < merged[j].ID })
+	return c.replace(merged)
+}
+
+// SetQuantity изменяет количество пива в наличии в каталоге (после изменения в базе данных).
+// Возвращает обновленное пиво и признак того, что оно есть в каталоге.
+func (c *Catalog) SetQuantity(beerID, quantity int) (models.Beer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	beer, ok := c.byID[beerID]
+	if !ok {
+		return models.Beer{}, false
+	}
+	beer.Quantity = quantity
+	beers := make([]models.Beer, len(c.beers))
+	for i, existing := range c.beers {
+		if existing.ID == beerID {
+			existing = beer
+		}
+		beers[i] = existing
+	}
+	c.index(beers)
+	return beer, true
+}
+
+// Loaded сообщает, загружен ли каталог.
+func (c *Catalog) Loaded() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.loaded
+}
+
+// All возвращает все пиво в порядке ID.
+func (c *Catalog) All() []models.Beer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.beers
+}
+
+// ByType возвращает пиво типа beerType в порядке ID.
+func (c *Catalog) ByType(beerType string) []models.Beer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.byType[beerType]
+}
+
+// Types возвращает типы пива из каталога по алфавиту.
+func (c *Catalog) Types() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.types
+}
+
+// Cached возвращает пиво из каталога без обращения к базе данных.
+func (c *Catalog) Cached(beerID int) (models.Beer, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	beer, ok := c.byID[beerID]
+	return beer, ok
+}
+
+// Get возвращает пиво по ID; если его нет в каталоге, запрашивает базу данных.
+// Возвращает nil, если пиво не найдено.
+func (c *Catalog) Get(ctx context.Context, db *sql.DB, beerID int) (*models.Beer, error) {
+	found, err := c.GetMany(ctx, db, []int{beerID})
+	if err != nil {
+		return nil, err
+	}
+	beer, ok := found[beerID]
+	if !ok {
+		return nil, nil
+	}
+	return &beer, nil
+}
+
+// GetMany возвращает пиво по ID. Пиво, которого нет в каталоге, запрашивается из базы данных
+// одним запросом. Пиво, которое не найдено и в базе данных, в результат не попадает.
+func (c *Catalog) GetMany(ctx context.Context, db *sql.DB, beerIDs []int) (map[int]models.Beer, error) {
+	found := make(map[int]models.Beer, len(beerIDs))
+	var missing []int
+	c.mu.RLock()
+	for _, id := range beerIDs {
+		if beer, ok := c.byID[id]; ok {
+			found[id] = beer
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	c.mu.RUnlock()
+	if len(missing) == 0 {
+		return found, nil
+	}
+
+	beers, err := database.GetBeersByIDs(ctx, db, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, beer := range beers {
+		found[beer.ID] = beer
+	}
+	return found, nil
+}
@@ -0,0 +1,25 @@
+package catalog
+
+import (
+	"beer_from_the_brewery/models"
+	"testing"
+)
+
+func TestQuantityChanged(t *testing.T) {
+	old := []models.Beer{{ID: 1, Name: "Лагер", Quantity: 10}, {ID: 2, Name: "Эль", Quantity: 0}}
+	tests := []struct {
+		name string
+		new  []models.Beer
+		want bool
+	}{
+		{"изменилось только название", []models.Beer{{ID: 1, Name: "Светлый лагер", Quantity: 10}, {ID: 2, Name: "Эль"}}, false},
+		{"пиво удалено", []models.Beer{{ID: 1, Name: "Лагер", Quantity: 10}}, false},
+		{"изменился остаток", []models.Beer{{ID: 1, Name: "Лагер", Quantity: 9}, {ID: 2, Name: "Эль"}}, true},
+		{"добавлено пиво", append([]models.Beer{{ID: 3, Name: "Стаут", Quantity: 2}}, old...), true},
+	}
+	for _, tt := range tests {
+		if got := quantityChanged(old, tt.new); got != tt.want {
+			t.Errorf("%s: quantityChanged = %v, ожидалось %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package catalog
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/models"
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// csvColumns - столбцы CSV-файла каталога в порядке экспорта.
+var csvColumns = []string{"id", "name", "type", "price", "quantity", "description", "image_url"}
+
+// utf8BOM - метка порядка байтов, с которой таблицы сохраняют CSV в UTF-8.
+const utf8BOM = "\ufeff"
+
+// ImportRow - строка CSV-файла каталога.
+type ImportRow struct {
+	Line   int                 // Номер строки в файле
+	ID     int                 // ID пива; 0 - пиво ищется по названию, а если не найдено, добавляется
+	Fields database.BeerUpdate // Значения из файла; nil - столбца нет в файле (или пустое количество)
+}
+
+// ImportError - ошибка импорта каталога со списком всех некорректных строк.
+type ImportError struct {
+	Problems []string
+}
+
+func (e *ImportError) Error() string {
+	return "некорректный файл каталога:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// add добавляет описание ошибки в строке line.
+func (e *ImportError) add(line int, format string, args ...any) {
+	e.Problems = append(e.Problems, fmt.Sprintf("строка %d: ", line)+fmt.Sprintf(format, args...))
+}
+
+// ReadCSV читает CSV-файл каталога. Первая строка - названия столбцов (id, name, type, price,
+// quantity, description, image_url) в любом порядке; обязательны name и price. Разделитель - запятая или точка с запятой (так сохраняют таблицы
+// в русской локали), дробная часть цены отделяется точкой или запятой.
+// Если какие-либо строки некорректны, возвращает *ImportError со всеми такими строками.
+func ReadCSV(r io.Reader) ([]ImportRow, error) {
+	buffered := bufio.NewReader(r)
+	if bom, err := buffered.Peek(len(utf8BOM)); err == nil && string(bom) == utf8BOM {
+		buffered.Discard(len(utf8BOM))
+	}
+	header, err := buffered.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("ошибка при чтении файла каталога: %w", err)
+	}
+	reader := csv.NewReader(io.MultiReader(strings.NewReader(header), buffered))
+	if strings.Count(header, ";") > strings.Count(header, ",") {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1 // Число ячеек проверяется для каждой строки отдельно
+
+	names, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("файл каталога пуст")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении заголовка файла каталога: %w", err)
+	}
+	columns := make(map[string]int, len(names))
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(csvColumns, name) {
+			return nil, fmt.Errorf("неизвестный столбец %q, допустимые столбцы: %s", name, strings.Join(csvColumns, ", "))
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("столбец %q указан дважды", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"name", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("нет обязательного столбца %q", name)
+		}
+	}
+
+	var rows []ImportRow
+	problems := &ImportError{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при чтении файла каталога: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue // Пустые строки в конце таблицы
+		}
+		if len(record) != len(names) {
+			problems.add(line, "число ячеек %[2]d вместо %[1]d", len(names), len(record))
+			continue
+		}
+		row, err := parseRow(record, columns)
+		if err != nil {
+			problems.add(line, "%v", err)
+			continue
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+	if len(problems.Problems) > 0 {
+		return nil, problems
+	}
+	return rows, nil
+}
+
+// parseRow разбирает ячейки строки record; columns - номера ячеек по названию столбца.
+func parseRow(record []string, columns map[string]int) (ImportRow, error) {
+	var row ImportRow
+	cell := func(name string) (string, bool) {
+		i, ok := columns[name]
+		if !ok {
+			return "", false
+		}
+		return strings.TrimSpace(record[i]), true
+	}
+
+	if value, _ := cell("id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return row, fmt.Errorf("некорректный ID %q", value)
+		}
+		row.ID = id
+	}
+
+	name, _ := cell("name")
+	if name == "" {
+		return row, errors.New("не указано название")
+	}
+	row.Fields.Name = &name
+
+	value, _ := cell("price")
+	price, err := strconv.ParseFloat(normalizeNumber(value), 64)
+	if err != nil || math.IsNaN(price) || math.IsInf(price, 0) {
+		return row, fmt.Errorf("некорректная цена %q", value)
+	}
+	if price <= 0 {
+		return row, fmt.Errorf("цена должна быть положительной, получено %q", value)
+	}
+	price = roundPrice(price)
+	row.Fields.Price = &price
+
+	if value, _ := cell("quantity"); value != "" {
+		quantity, err := strconv.Atoi(normalizeNumber(value))
+		if err != nil || quantity < 0 {
+			return row, fmt.Errorf("некорректное количество %q", value)
+		}
+		row.Fields.Quantity = &quantity
+	}
+
+	for column, field := range map[string]**string{
+		"type":        &row.Fields.Type,
+		"description": &row.Fields.Description,
+		"image_url":   &row.Fields.ImageURL,
+	} {
+		if value, ok := cell(column); ok {
+			*field = &value
+		}
+	}
+	return row, nil
+}
+
+// normalizeNumber убирает из числа разделители разрядов и заменяет десятичную запятую точкой.
+func normalizeNumber(value string) string {
+	value = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "").Replace(value)
+	return strings.Replace(value, ",", ".", 1)
+}
+
+// roundPrice округляет цену до копеек.
+func roundPrice(price float64) float64 {
+	return math.Round(price*100) / 100
+}
+
+// apply возвращает beer со значениями из строки файла.
+func (row ImportRow) apply(beer models.Beer) models.Beer {
+	fields := row.Fields
+	if fields.Name != nil {
+		beer.Name = *fields.Name
+	}
+	if fields.Type != nil {
+		beer.Type = *fields.Type
+	}
+	if fields.Price != nil {
+		beer.Price = *fields.Price
+	}
+	if fields.Quantity != nil {
+		beer.Quantity = *fields.Quantity
+	}
+	if fields.Description != nil {
+		beer.Description = *fields.Description
+	}
+	if fields.ImageURL != nil {
+		beer.ImageURL = *fields.ImageURL
+	}
+	return beer
+}
+
+// BeerChange - изменение существующего пива при импорте.
+type BeerChange struct {
+	Before  models.Beer         // Пиво до импорта
+	After   models.Beer         // Пиво после импорта
+	Columns []string            // Измененные столбцы
+	Fields  database.BeerUpdate // Новые значения только измененных столбцов
+}
+
+// ImportPlan - результат сравнения файла каталога с базой данных: что будет добавлено,
+// изменено и останется без изменений.
+type ImportPlan struct {
+	Create    []models.Beer
+	Update    []BeerChange
+	Unchanged []models.Beer
+}
+
+// Empty сообщает, что импорт ничего не изменит.
+func (p *ImportPlan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0
+}
+
+// PlanImport сравнивает строки файла каталога с пивом в базе данных, ничего не изменяя.
+// Строка с ID изменяет пиво с этим ID; строка без ID изменяет пиво с тем же названием
+// (без учета регистра), а если такого нет - добавляет новое.
+// Если строки ссылаются на несуществующее пиво или повторяются, возвращает *ImportError.
+func PlanImport(ctx context.Context, db *sql.DB, rows []ImportRow) (*ImportPlan, error) {
+	current, err := database.GetBeers(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return planImport(current, rows)
+}
+
+// planImport сравнивает строки файла каталога с текущим пивом current.
+func planImport(current []models.Beer, rows []ImportRow) (*ImportPlan, error) {
+	byID := make(map[int]models.Beer, len(current))
+	byName := make(map[string][]models.Beer, len(current))
+	for _, beer := range current {
+		byID[beer.ID] = beer
+		key := nameKey(beer.Name)
+		byName[key] = append(byName[key], beer)
+	}
+
+	plan := &ImportPlan{}
+	problems := &ImportError{}
+	changedAt := make(map[int]int)    // Строка, изменяющая пиво с ID
+	createdAt := make(map[string]int) // Строка, добавляющая пиво с названием
+	for _, row := range rows {
+		key := nameKey(*row.Fields.Name)
+		var target models.Beer
+		found := false
+		if row.ID != 0 {
+			target, found = byID[row.ID]
+			if !found {
+				problems.add(row.Line, "пиво с ID %d не найдено", row.ID)
+				continue
+			}
+		} else if matches := byName[key]; len(matches) > 1 {
+			problems.add(row.Line, "пиво с названием %q не одно, укажите ID", *row.Fields.Name)
+			continue
+		} else if len(matches) == 1 {
+			target, found = matches[0], true
+		}
+
+		if !found {
+			if line, ok := createdAt[key]; ok {
+				problems.add(row.Line, "пиво %q уже добавляется в строке %d", *row.Fields.Name, line)
+				continue
+			}
+			createdAt[key] = row.Line
+			plan.Create = append(plan.Create, row.apply(models.Beer{}))
+			continue
+		}
+
+		if line, ok := changedAt[target.ID]; ok {
+			problems.add(row.Line, "пиво с ID %d уже изменяется в строке %d", target.ID, line)
+			continue
+		}
+		changedAt[target.ID] = row.Line
+		after := row.apply(target)
+		if columns := changedColumns(target, after); len(columns) > 0 {
+			plan.Update = append(plan.Update, BeerChange{Before: target, After: after, Columns: columns, Fields: changedFields(row.Fields, columns)})
+		} else {
+			plan.Unchanged = append(plan.Unchanged, target)
+		}
+	}
+	if len(problems.Problems) > 0 {
+		return nil, problems
+	}
+	return plan, nil
+}
+
+// nameKey возвращает название пива для сравнения без учета регистра и пробелов по краям.
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// changedColumns возвращает столбцы, значения которых у before и after различаются.
+func changedColumns(before, after models.Beer) []string {
+	var columns []string
+	if before.Name != after.Name {
+		columns = append(columns, "name")
+	}
+	if before.Type != after.Type {
+		columns = append(columns, "type")
+	}
+	if roundPrice(before.Price) != roundPrice(after.Price) {
+		columns = append(columns, "price")
+	}
+	if before.Quantity != after.Quantity {
+		columns = append(columns, "quantity")
+	}
+	if before.Description != after.Description {
+		columns = append(columns, "description")
+	}
+	if before.ImageURL != after.ImageURL {
+		columns = append(columns, "image_url")
+	}
+	return columns
+}
+
+// changedFields возвращает значения fields только для столбцов columns.
+func changedFields(fields database.BeerUpdate, columns []string) database.BeerUpdate {
+	var changed database.BeerUpdate
+	for _, column := range columns {
+		switch column {
+		case "name":
+			changed.Name = fields.Name
+		case "type":
+			changed.Type = fields.Type
+		case "price":
+			changed.Price = fields.Price
+		case "quantity":
+			changed.Quantity = fields.Quantity
+		case "description":
+			changed.Description = fields.Description
+		case "image_url":
+			changed.ImageURL = fields.ImageURL
+		}
+	}
+	return changed
+}
+
+// ApplyImport применяет план импорта в одной транзакции и записывает в plan.Create ID добавленного пива.
+// У существующего пива изменяются только столбцы, отличавшиеся при сравнении, поэтому изменения,
+// сделанные после PlanImport (например, списание остатка заказом), не теряются.
+// Каталог бота обновится по уведомлениям базы данных (см. Run).
+func ApplyImport(ctx context.Context, db *sql.DB, plan *ImportPlan) error {
+	updated := make(map[int]database.BeerUpdate, len(plan.Update))
+	for _, change := range plan.Update {
+		updated[change.Before.ID] = change.Fields
+	}
+	ids, err := database.ImportBeers(ctx, db, plan.Create, updated)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		plan.Create[i].ID = id
+	}
+	return nil
+}
+
+// ColumnValue возвращает значение столбца column файла каталога для пива beer.
+func ColumnValue(beer models.Beer, column string) string {
+	switch column {
+	case "id":
+		return strconv.Itoa(beer.ID)
+	case "name":
+		return beer.Name
+	case "type":
+		return beer.Type
+	case "price":
+		return strconv.FormatFloat(beer.Price, 'f', 2, 64)
+	case "quantity":
+		return strconv.Itoa(beer.Quantity)
+	case "description":
+		return beer.Description
+	case "image_url":
+		return beer.ImageURL
+	}
+	return ""
+}
+
+// WriteCSV записывает пиво в CSV-файл в формате, который принимает ReadCSV.
+// Файл начинается с метки UTF-8, чтобы таблицы правильно определяли кодировку.
+func WriteCSV(w io.Writer, beers []models.Beer) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	writer.Write(csvColumns)
+	record := make([]string, len(csvColumns))
+	for _, beer := range beers {
+		for i, column := range csvColumns {
+			record[i] = ColumnValue(beer, column)
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
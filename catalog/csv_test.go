@@ -0,0 +1,186 @@
+package catalog
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/models"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want []ImportRow
+	}{
+		{
+			name: "столбцы в любом порядке и регистре",
+			file: "Price,NAME,id\n120.5,Лагер,3\n",
+			want: []ImportRow{
+				{Line: 2, ID: 3, Fields: database.BeerUpdate{Name: ptr("Лагер"), Price: ptr(120.5)}},
+			},
+		},
+		{
+			name: "точка с запятой, десятичная запятая и метка UTF-8",
+			file: utf8BOM + "name;price;quantity\nСтаут;1 250,499;12\n",
+			want: []ImportRow{
+				{Line: 2, Fields: database.BeerUpdate{Name: ptr("Стаут"), Price: ptr(1250.5), Quantity: ptr(12)}},
+			},
+		},
+		{
+			name: "пустое количество не меняет остаток, пустое описание очищает его",
+			file: "name,price,quantity,description\nЭль,100,,\n",
+			want: []ImportRow{
+				{Line: 2, Fields: database.BeerUpdate{Name: ptr("Эль"), Price: ptr(100.0), Description: ptr("")}},
+			},
+		},
+		{
+			name: "пустые строки пропускаются",
+			file: "name,price\nЭль,100\n,\nПортер,200\n",
+			want: []ImportRow{
+				{Line: 2, Fields: database.BeerUpdate{Name: ptr("Эль"), Price: ptr(100.0)}},
+				{Line: 4, Fields: database.BeerUpdate{Name: ptr("Портер"), Price: ptr(200.0)}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadCSV(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("ReadCSV: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadCSV = %+v, ожидалось %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"пустой файл", "", "файл каталога пуст"},
+		{"неизвестный столбец", "name,price,color\n", `неизвестный столбец "color"`},
+		{"столбец дважды", "name,price,Name\n", `столбец "name" указан дважды`},
+		{"нет цены", "name,quantity\n", `нет обязательного столбца "price"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadCSV(strings.NewReader(tt.file))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ReadCSV вернула ошибку %v, ожидалось %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVBadRows(t *testing.T) {
+	file := "id,name,price,quantity\n" +
+		"1,Лагер,100,5\n" +
+		"x,Эль,100,5\n" +
+		"2,,100,5\n" +
+		"3,Стаут,-1,5\n" +
+		"4,Портер,abc,5\n" +
+		"5,Сидр,100,-2\n" +
+		"6,Бок,100\n"
+	_, err := ReadCSV(strings.NewReader(file))
+	var importErr *ImportError
+	if !errors.As(err, &importErr) {
+		t.Fatalf("ReadCSV вернула ошибку %v, ожидалась *ImportError", err)
+	}
+	want := []string{
+		`строка 3: некорректный ID "x"`,
+		"строка 4: не указано название",
+		`строка 5: цена должна быть положительной, получено "-1"`,
+		`строка 6: некорректная цена "abc"`,
+		`строка 7: некорректное количество "-2"`,
+		"строка 8: число ячеек 3 вместо 4",
+	}
+	if !slices.Equal(importErr.Problems, want) {
+		t.Errorf("ошибки:\n%s\nожидалось:\n%s", strings.Join(importErr.Problems, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	current := []models.Beer{
+		{ID: 1, Name: "Лагер", Type: "Светлое", Price: 100, Quantity: 10, Description: "Легкое"},
+		{ID: 2, Name: "Стаут", Type: "Темное", Price: 200, Quantity: 3},
+	}
+	rows, err := ReadCSV(strings.NewReader("id,name,price,quantity\n" +
+		"1,Лагер,120,10\n" + // Изменилась только цена
+		", Стаут ,200,\n" + // Найдено по названию, ничего не изменилось
+		",Портер,150,7\n")) // Новое пиво
+	if err != nil {
+		t.Fatalf("ReadCSV: %v", err)
+	}
+
+	plan, err := planImport(current, rows)
+	if err != nil {
+		t.Fatalf("planImport: %v", err)
+	}
+	if want := []models.Beer{{Name: "Портер", Price: 150, Quantity: 7}}; !reflect.DeepEqual(plan.Create, want) {
+		t.Errorf("Create = %+v, ожидалось %+v", plan.Create, want)
+	}
+	if want := []models.Beer{current[1]}; !reflect.DeepEqual(plan.Unchanged, want) {
+		t.Errorf("Unchanged = %+v, ожидалось %+v", plan.Unchanged, want)
+	}
+	if len(plan.Update) != 1 {
+		t.Fatalf("Update = %+v, ожидалось одно изменение", plan.Update)
+	}
+	change := plan.Update[0]
+	after := current[0]
+	after.Price = 120
+	if change.Before != current[0] || change.After != after {
+		t.Errorf("изменение %+v -> %+v, ожидалось %+v -> %+v", change.Before, change.After, current[0], after)
+	}
+	if !slices.Equal(change.Columns, []string{"price"}) {
+		t.Errorf("Columns = %v, ожидалось [price]", change.Columns)
+	}
+	// Записываются только измененные столбцы: остаток из файла не должен перезаписать списанный заказами
+	if want := (database.BeerUpdate{Price: ptr(120.0)}); !reflect.DeepEqual(change.Fields, want) {
+		t.Errorf("Fields = %+v, ожидалось %+v", change.Fields, want)
+	}
+}
+
+func TestPlanImportConflicts(t *testing.T) {
+	current := []models.Beer{
+		{ID: 1, Name: "Лагер", Price: 100},
+		{ID: 2, Name: "Эль", Price: 100},
+		{ID: 3, Name: "эль", Price: 110},
+	}
+	rows, err := ReadCSV(strings.NewReader("id,name,price\n" +
+		"9,Бок,100\n" +
+		"1,Лагер,110\n" +
+		",лагер,120\n" +
+		",Эль,100\n" +
+		",Портер,100\n" +
+		",ПОРТЕР,100\n"))
+	if err != nil {
+		t.Fatalf("ReadCSV: %v", err)
+	}
+
+	_, err = planImport(current, rows)
+	var importErr *ImportError
+	if !errors.As(err, &importErr) {
+		t.Fatalf("planImport вернула ошибку %v, ожидалась *ImportError", err)
+	}
+	want := []string{
+		"строка 2: пиво с ID 9 не найдено",
+		"строка 4: пиво с ID 1 уже изменяется в строке 3",
+		`строка 5: пиво с названием "Эль" не одно, укажите ID`,
+		`строка 7: пиво "ПОРТЕР" уже добавляется в строке 6`,
+	}
+	if !slices.Equal(importErr.Problems, want) {
+		t.Errorf("ошибки:\n%s\nожидалось:\n%s", strings.Join(importErr.Problems, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,151 @@
+package catalog
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/health"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/metrics"
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// changesChannel - канал NOTIFY, в который триггеры отправляют ID измененного пива (см. database/schema.go).
+	changesChannel = "beer_changes"
+
+	listenerMinReconnect = 10 * time.Second // Пауза перед первой попыткой переподключения слушателя
+	listenerMaxReconnect = time.Minute      // Максимальная пауза между попытками переподключения
+	listenerPingInterval = 90 * time.Second // Проверка соединения слушателя, когда уведомлений нет
+	changesBatchWindow   = 200 * time.Millisecond
+)
+
+// Run поддерживает актуальность каталога, пока не будет отменен ctx.
+//
+// Изменения пива и отзывов приходят от триггеров базы данных через LISTEN/NOTIFY
+// (отдельным соединением по строке подключения connStr) и применяются к каталогу по одному пиву.
+// Раз в interval, а также после переподключения слушателя, когда уведомления могли быть
+// пропущены, каталог перезагружается целиком.
+// onUpdate вызывается после каждого обновления каталога с пивом, которое снова появилось
+// в наличии (список может быть пустым), и признаком того, что у какого-либо пива изменился
+// остаток; onUpdate может быть nil.
+func (c *Catalog) Run(ctx context.Context, db *sql.DB, connStr string, interval time.Duration, logger *slog.Logger, onUpdate func(restocked []models.Beer, stockChanged bool)) {
+	job := health.NewJob("catalog_refresh", interval)
+	defer job.Stopped()
+	listenerJob := health.NewJob("catalog_listener", 0)
+	defer listenerJob.Stopped()
+
+	listener := pq.NewListener(connStr, listenerMinReconnect, listenerMaxReconnect, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+			listenerJob.Succeeded()
+			logger.Info("Слушатель изменений каталога подключен")
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			listenerJob.Failed(err)
+			logger.Error("Слушатель изменений каталога отключен", logging.Error, err)
+		}
+	})
+	defer listener.Close()
+	// Если соединения еще нет, LISTEN будет выполнен после подключения
+	if err := listener.Listen(changesChannel); err != nil {
+		logger.Error("Ошибка при подписке на изменения каталога", logging.Error, err)
+	}
+
+	notifyUpdated := func(restocked []models.Beer, stockChanged bool) {
+		if onUpdate != nil {
+			onUpdate(restocked, stockChanged)
+		}
+	}
+	reload := func() {
+		restocked, stockChanged, err := c.refresh(ctx, db)
+		if err != nil {
+			job.Failed(err)
+			logger.Error("Ошибка при обновлении списка пива", logging.Error, err)
+			return
+		}
+		job.Succeeded()
+		metrics.CatalogUpdates.With("reload").Inc()
+		logger.Debug("Список пива обновлен", "beers", len(c.All()), "restocked", len(restocked))
+		notifyUpdated(restocked, stockChanged)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Обновление списка пива остановлено")
+			return
+		case <-ticker.C:
+			reload()
+		case <-ping.C:
+			go listener.Ping()
+		case notification := <-listener.Notify:
+			// nil приходит после переподключения: уведомления за время разрыва потеряны
+			if notification == nil {
+				reload()
+				continue
+			}
+			ids, reconnected := collectChanges(ctx, listener, notification, logger)
+			if reconnected {
+				reload()
+				continue
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			changed, err := database.GetBeersByIDs(ctx, db, ids)
+			if err != nil {
+				logger.Error("Ошибка при загрузке измененного пива", "beer_ids", ids, logging.Error, err)
+				continue
+			}
+			restocked, stockChanged := c.update(ids, changed)
+			metrics.CatalogUpdates.With("notify").Add(float64(len(ids)))
+			logger.Debug("Пиво обновлено по уведомлению", "beer_ids", ids)
+			notifyUpdated(restocked, stockChanged)
+		}
+	}
+}
+
+// collectChanges собирает ID пива из первого уведомления и тех, что пришли за ним
+// в течение changesBatchWindow, чтобы массовое изменение каталога загружалось одним запросом.
+// reconnected равно true, если за это время слушатель переподключился и каталог нужно перезагрузить.
+func collectChanges(ctx context.Context, listener *pq.Listener, first *pq.Notification, logger *slog.Logger) (ids []int, reconnected bool) {
+	seen := make(map[int]bool)
+	add := func(notification *pq.Notification) {
+		id, err := strconv.Atoi(notification.Extra)
+		if err != nil {
+			logger.Error("Некорректное уведомление об изменении пива", "payload", notification.Extra, logging.Error, err)
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	add(first)
+
+	window := time.NewTimer(changesBatchWindow)
+	defer window.Stop()
+	for {
+		select {
+		case notification := <-listener.Notify:
+			if notification == nil {
+				return ids, true
+			}
+			add(notification)
+		case <-window.C:
+			return ids, false
+		case <-ctx.Done():
+			return ids, false
+		}
+	}
+}
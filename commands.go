@@ -0,0 +1,234 @@
+package main
+
+import (
+	"beer_from_the_brewery/accounting"
+	"beer_from_the_brewery/catalog"
+	"beer_from_the_brewery/config"
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// command - команда обслуживания, которая выполняется вместо запуска бота,
+// например: go run . catalog import -apply catalog.csv
+type command struct {
+	name  string // Имя команды вместе с подкомандой
+	args  string // Аргументы для справки
+	usage string // Описание для справки
+	run   func(ctx context.Context, cfg *config.Config, db *sql.DB, args []string, out io.Writer) error
+}
+
+var commands = []command{
+	{"catalog export", "[-o файл.csv]", "выгружает каталог пива в CSV (по умолчанию в stdout)", exportCatalog},
+	{"catalog import", "[-apply] файл.csv", "проверяет CSV-файл каталога и показывает изменения; с -apply применяет их", importCatalog},
+	{"orders export", "-from ГГГГ-ММ-ДД [-to ГГГГ-ММ-ДД] [-format csv|xml] [-o файл]",
+		"выгружает заказы за период (даты включительно) в CSV или CommerceML для 1С (по умолчанию в stdout)", exportOrders},
+}
+
+// errUsage возвращается командой, вызванной с некорректными аргументами.
+var errUsage = errors.New("некорректные аргументы")
+
+// findCommand находит команду по аргументам после флагов и возвращает ее вместе с ее аргументами.
+func findCommand(args []string) (command, []string, bool) {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd, args[len(words):], true
+		}
+	}
+	return command{}, nil, false
+}
+
+// printCommands выводит список команд обслуживания.
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "Команды обслуживания (указываются после флагов):")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\n    \t%s\n", cmd.name, cmd.args, cmd.usage)
+	}
+}
+
+// runCommand выполняет команду cmd и возвращает код завершения процесса: 0 - команда выполнена,
+// 1 - ошибка выполнения, 2 - некорректные аргументы команды.
+func runCommand(ctx context.Context, cmd command, args []string, cfg *config.Config, db *sql.DB) int {
+	err := cmd.run(ctx, cfg, db, args, os.Stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "использование: %s %s\n", cmd.name, cmd.args)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// commandFlags создает набор флагов команды name; ошибки разбора выводятся в stderr.
+func commandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	return flags
+}
+
+// parseCommandFlags разбирает флаги команды; ошибки разбора (кроме -help) превращаются в errUsage.
+func parseCommandFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// exportCatalog выгружает каталог пива в CSV-файл в формате импорта.
+func exportCatalog(ctx context.Context, _ *config.Config, db *sql.DB, args []string, out io.Writer) error {
+	flags := commandFlags("catalog export")
+	output := flags.String("o", "", "файл для выгрузки; по умолчанию stdout")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%w: лишние аргументы %s", errUsage, strings.Join(flags.Args(), " "))
+	}
+
+	beers, err := database.GetBeers(ctx, db)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return catalog.WriteCSV(out, beers)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := catalog.WriteCSV(file, beers); err != nil {
+		file.Close()
+		return fmt.Errorf("ошибка при записи каталога: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("ошибка при записи каталога: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Выгружено сортов пива: %d\n", len(beers))
+	return nil
+}
+
+// importCatalog проверяет CSV-файл каталога ("-" - stdin) и выводит, какое пиво будет добавлено
+// и изменено; с флагом -apply применяет изменения в одной транзакции.
+func importCatalog(ctx context.Context, _ *config.Config, db *sql.DB, args []string, out io.Writer) error {
+	flags := commandFlags("catalog import")
+	apply := flags.Bool("apply", false, "применить изменения; без флага файл только проверяется")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: укажите один файл каталога", errUsage)
+	}
+
+	var in io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	rows, err := catalog.ReadCSV(in)
+	if err != nil {
+		return err
+	}
+	plan, err := catalog.PlanImport(ctx, db, rows)
+	if err != nil {
+		return err
+	}
+
+	for _, beer := range plan.Create {
+		fmt.Fprintf(out, "+ %s: price=%.2f quantity=%d type=%q\n", beer.Name, beer.Price, beer.Quantity, beer.Type)
+	}
+	for _, change := range plan.Update {
+		fmt.Fprintf(out, "~ #%d %s\n", change.After.ID, change.After.Name)
+		for _, column := range change.Columns {
+			fmt.Fprintf(out, "    %s: %q → %q\n", column,
+				catalog.ColumnValue(change.Before, column), catalog.ColumnValue(change.After, column))
+		}
+	}
+	fmt.Fprintf(out, "Добавится: %d, изменится: %d, без изменений: %d\n", len(plan.Create), len(plan.Update), len(plan.Unchanged))
+
+	if plan.Empty() {
+		return nil
+	}
+	if !*apply {
+		fmt.Fprintln(out, "Проверка без изменений; чтобы применить, запустите с флагом -apply")
+		return nil
+	}
+	if err := catalog.ApplyImport(ctx, db, plan); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Каталог обновлен")
+	return nil
+}
+
+// exportOrders выгружает заказы за период для бухгалтерии: строки заказов в CSV или документы
+// CommerceML (-format xml). Даты периода задаются в часовом поясе TIMEZONE.
+func exportOrders(ctx context.Context, cfg *config.Config, db *sql.DB, args []string, out io.Writer) error {
+	flags := commandFlags("orders export")
+	from := flags.String("from", "", "первый день периода, ГГГГ-ММ-ДД")
+	to := flags.String("to", "", "последний день периода, ГГГГ-ММ-ДД; по умолчанию равен -from")
+	format := flags.String("format", "csv", "формат выгрузки: csv или xml (CommerceML)")
+	output := flags.String("o", "", "файл для выгрузки; по умолчанию stdout")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%w: лишние аргументы %s", errUsage, strings.Join(flags.Args(), " "))
+	}
+	if *from == "" {
+		return fmt.Errorf("%w: не задан -from", errUsage)
+	}
+	if *format != "csv" && *format != "xml" {
+		return fmt.Errorf("%w: неизвестный формат %q", errUsage, *format)
+	}
+	start, end, err := utils.ParseDateRange(*from, *to, cfg.Location)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	orders, err := accounting.LoadOrders(ctx, db, start, end)
+	if err != nil {
+		return err
+	}
+	write := func(w io.Writer) error {
+		if *format == "xml" {
+			return accounting.WriteCommerceML(w, orders, time.Now(), cfg.Location)
+		}
+		return accounting.WriteCSV(w, orders, cfg.Location)
+	}
+	if *output == "" {
+		return write(out)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return fmt.Errorf("ошибка при записи заказов: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("ошибка при записи заказов: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Выгружено заказов: %d\n", len(orders))
+	return nil
+}
@@ -0,0 +1,457 @@
+// Package config загружает и проверяет настройки бота.
+//
+// Каждый параметр можно задать флагом командной строки, переменной окружения или строкой
+// в файле формата .env (в порядке убывания приоритета). Файл задается флагом -config или
+// переменной CONFIG_FILE; если он не задан, читается файл .env в текущем каталоге, если он есть.
+package config
+
+import (
+	"beer_from_the_brewery/logging"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Часовые пояса доступны и в образах без базы tzdata
+
+	"github.com/joho/godotenv"
+)
+
+// Способы получения обновлений от Telegram.
+const (
+	TransportPolling = "polling" // Запросы getUpdates (long polling)
+	TransportWebhook = "webhook" // Telegram отправляет обновления на WebhookURL
+)
+
+// defaultFile - файл с параметрами, который читается, если другой файл не задан.
+const defaultFile = ".env"
+
+// Config - настройки бота.
+type Config struct {
+	BotToken     string            // Токен бота Telegram
+	AdminIDs     map[int64]bool    // ID пользователей Telegram, которым доступны команды администратора
+	TemplatesDir string            // Каталог, переопределяющий встроенные шаблоны сообщений
+	LogLevel     slog.Level        // Минимальный уровень записей журнала
+	HTTPAddr     string            // Адрес служебного HTTP-сервера (/metrics, /healthz, /readyz); пустой - сервер не запускается
+	APIKeys      map[string]string // Ключи API администрирования (ключ - имя клиента); пустой - API отключен
+	Command      []string          // Команда обслуживания и ее аргументы после флагов; пустая - запуск бота
+	Location     *time.Location    // Часовой пояс дат в выгрузках и отчетах
+	AdminChatID  int64             // Чат администраторов для ежедневного отчета и предупреждений; 0 - не отправляются
+	ReportTime   time.Duration     // Время отправки ежедневного отчета от начала суток в часовом поясе Location
+
+	Transport   string        // Способ получения обновлений: TransportPolling или TransportWebhook
+	PollTimeout time.Duration // Время ожидания обновлений в одном запросе getUpdates
+	WebhookURL  string        // Адрес HTTPS, на который Telegram отправляет обновления
+	WebhookAddr string        // Адрес, на котором бот принимает обновления в режиме webhook
+
+	ShutdownTimeout           time.Duration // Время на завершение обработчиков и фоновых задач при остановке
+	CatalogRefreshInterval    time.Duration // Периодичность обновления каталога пива
+	CatalogMaxAge             time.Duration // Каталог старше считается устаревшим (/readyz)
+	RecommendationsInterval   time.Duration // Периодичность обновления рекомендаций
+	SubscriptionCheckInterval time.Duration // Периодичность проверки подписок
+
+	Database Database // Подключение к базе данных
+}
+
+// Database - параметры подключения к PostgreSQL.
+type Database struct {
+	URL string // Строка подключения целиком; если задана, остальные параметры адреса и TLS не используются
+
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+
+	SSLMode     string // disable, allow, prefer, require, verify-ca или verify-full
+	SSLRootCert string // Сертификат центра сертификации для проверки сервера
+	SSLCert     string // Сертификат клиента
+	SSLKey      string // Закрытый ключ клиента
+
+	MaxOpenConns    int           // Максимальное число открытых соединений (0 - без ограничения)
+	MaxIdleConns    int           // Максимальное число простаивающих соединений
+	ConnMaxLifetime time.Duration // Максимальное время жизни соединения
+	ConnMaxIdleTime time.Duration // Максимальное время простоя соединения
+	ConnectTimeout  time.Duration // Время на установку соединения и начальную проверку
+}
+
+// ConnString возвращает строку подключения к базе данных для драйвера lib/pq.
+func (d Database) ConnString() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	query := url.Values{}
+	query.Set("sslmode", d.SSLMode)
+	if d.SSLRootCert != "" {
+		query.Set("sslrootcert", d.SSLRootCert)
+	}
+	if d.SSLCert != "" {
+		query.Set("sslcert", d.SSLCert)
+	}
+	if d.SSLKey != "" {
+		query.Set("sslkey", d.SSLKey)
+	}
+	// connect_timeout задается в целых секундах; 0 означает ожидание без ограничения
+	query.Set("connect_timeout", strconv.Itoa(max(1, int(d.ConnectTimeout/time.Second))))
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     net.JoinHostPort(d.Host, strconv.Itoa(d.Port)),
+		Path:     "/" + d.Name,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// Error - ошибка загрузки настроек со списком всех незаданных и некорректных параметров.
+type Error struct {
+	Missing []string // Незаданные обязательные параметры
+	Invalid []string // Параметры с некорректными значениями и причины
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("некорректные настройки")
+	if len(e.Missing) > 0 {
+		b.WriteString("\nне заданы обязательные параметры:")
+		for _, name := range e.Missing {
+			b.WriteString("\n  " + name)
+		}
+	}
+	if len(e.Invalid) > 0 {
+		b.WriteString("\nнекорректные значения:")
+		for _, problem := range e.Invalid {
+			b.WriteString("\n  " + problem)
+		}
+	}
+	return b.String()
+}
+
+// param описывает один параметр настроек.
+type param struct {
+	env   string             // Имя переменной окружения и ключа в файле
+	flag  string             // Имя флага командной строки
+	def   string             // Значение по умолчанию
+	usage string             // Описание для -help
+	set   func(string) error // Разбирает значение и записывает его в Config
+}
+
+// name возвращает имя параметра для сообщений об ошибках.
+func (p param) name() string {
+	return fmt.Sprintf("%s (-%s)", p.env, p.flag)
+}
+
+// params возвращает описание всех параметров, записывающих значения в c.
+func (c *Config) params() []param {
+	db := &c.Database
+	return []param{
+		{"BOT_TOKEN", "bot-token", "", "токен бота Telegram", stringVar(&c.BotToken)},
+		{"ADMIN_IDS", "admin-ids", "", "ID администраторов в Telegram через запятую", adminIDsVar(&c.AdminIDs)},
+		{"TEMPLATES_DIR", "templates-dir", "", "каталог с шаблонами сообщений, переопределяющими встроенные", stringVar(&c.TemplatesDir)},
+		{"LOG_LEVEL", "log-level", "info", "уровень журнала: debug, info, warn или error", levelVar(&c.LogLevel)},
+		{"HTTP_ADDR", "http-addr", "", "адрес служебного HTTP-сервера, например :9090", stringVar(&c.HTTPAddr)},
+		{"API_KEYS", "api-keys", "", "ключи API администрирования в виде имя:ключ через запятую", apiKeysVar(&c.APIKeys)},
+		{"TIMEZONE", "timezone", "Local", "часовой пояс дат в выгрузках и отчетах, например Europe/Moscow", locationVar(&c.Location)},
+		{"ADMIN_CHAT_ID", "admin-chat-id", "", "ID чата администраторов для ежедневного отчета и предупреждений о низком остатке", chatIDVar(&c.AdminChatID)},
+		{"REPORT_TIME", "report-time", "09:00", "время ежедневного отчета (ЧЧ:ММ) в часовом поясе TIMEZONE", clockVar(&c.ReportTime)},
+
+		{"BOT_TRANSPORT", "transport", TransportPolling, "способ получения обновлений: polling или webhook", transportVar(&c.Transport)},
+		{"POLL_TIMEOUT", "poll-timeout", "60s", "время ожидания обновлений в одном запросе getUpdates", durationVar(&c.PollTimeout)},
+		{"WEBHOOK_URL", "webhook-url", "", "адрес HTTPS, на который Telegram отправляет обновления (режим webhook)", stringVar(&c.WebhookURL)},
+		{"WEBHOOK_ADDR", "webhook-addr", ":8443", "адрес, на котором бот принимает обновления (режим webhook)", stringVar(&c.WebhookAddr)},
+
+		{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "10s", "время на завершение работы при остановке", durationVar(&c.ShutdownTimeout)},
+		{"CATALOG_REFRESH_INTERVAL", "catalog-refresh-interval", "5m", "периодичность обновления каталога пива", durationVar(&c.CatalogRefreshInterval)},
+		{"CATALOG_MAX_AGE", "catalog-max-age", "15m", "возраст каталога, после которого бот не готов (/readyz)", durationVar(&c.CatalogMaxAge)},
+		{"RECOMMENDATIONS_INTERVAL", "recommendations-interval", "30m", "периодичность обновления рекомендаций", durationVar(&c.RecommendationsInterval)},
+		{"SUBSCRIPTION_CHECK_INTERVAL", "subscription-check-interval", "10m", "периодичность проверки подписок", durationVar(&c.SubscriptionCheckInterval)},
+
+		{"DATABASE_URL", "db-url", "", "строка подключения к базе данных (вместо параметров POSTGRES_*)", stringVar(&db.URL)},
+		{"POSTGRES_HOST", "db-host", "", "хост базы данных", stringVar(&db.Host)},
+		{"POSTGRES_PORT", "db-port", "5432", "порт базы данных", intVar(&db.Port)},
+		{"POSTGRES_USER", "db-user", "", "пользователь базы данных", stringVar(&db.User)},
+		{"POSTGRES_PASSWORD", "db-password", "", "пароль базы данных", stringVar(&db.Password)},
+		{"POSTGRES_DB", "db-name", "", "название базы данных", stringVar(&db.Name)},
+		{"POSTGRES_SSLMODE", "db-sslmode", "disable", "режим TLS: disable, allow, prefer, require, verify-ca или verify-full", sslModeVar(&db.SSLMode)},
+		{"POSTGRES_SSLROOTCERT", "db-sslrootcert", "", "сертификат центра сертификации для проверки сервера", stringVar(&db.SSLRootCert)},
+		{"POSTGRES_SSLCERT", "db-sslcert", "", "сертификат клиента", stringVar(&db.SSLCert)},
+		{"POSTGRES_SSLKEY", "db-sslkey", "", "закрытый ключ клиента", stringVar(&db.SSLKey)},
+		{"DB_MAX_OPEN_CONNS", "db-max-open-conns", "10", "максимальное число открытых соединений (0 - без ограничения)", intVar(&db.MaxOpenConns)},
+		{"DB_MAX_IDLE_CONNS", "db-max-idle-conns", "5", "максимальное число простаивающих соединений", intVar(&db.MaxIdleConns)},
+		{"DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "30m", "максимальное время жизни соединения", durationVar(&db.ConnMaxLifetime)},
+		{"DB_CONN_MAX_IDLE_TIME", "db-conn-max-idle-time", "5m", "максимальное время простоя соединения", durationVar(&db.ConnMaxIdleTime)},
+		{"DB_CONNECT_TIMEOUT", "db-connect-timeout", "5s", "время на подключение к базе данных", durationVar(&db.ConnectTimeout)},
+	}
+}
+
+// Load загружает настройки из аргументов командной строки args (без имени программы),
+// переменных окружения и файла. Аргументы после флагов считаются командой обслуживания (Command). Если какие-либо параметры не заданы или некорректны,
+// возвращает *Error со списком всех таких параметров. Для -help возвращает flag.ErrHelp.
+func Load(args []string) (*Config, error) {
+	c := &Config{}
+	params := c.params()
+
+	flags := flag.NewFlagSet("beer_from_the_brewery", flag.ContinueOnError)
+	file := flags.String("config", "", "файл с параметрами в формате .env (CONFIG_FILE); по умолчанию .env, если он есть")
+	flagValues := make(map[string]*string, len(params))
+	for _, p := range params {
+		usage := p.usage + " (" + p.env + ")"
+		flagValues[p.flag] = flags.String(p.flag, p.def, usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	c.Command = flags.Args()
+	setFlags := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	path := *file
+	if !setFlags["config"] {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	fileValues, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := &Error{}
+	for _, p := range params {
+		value := p.def
+		if setFlags[p.flag] {
+			value = *flagValues[p.flag]
+		} else if env := os.Getenv(p.env); env != "" {
+			value = env
+		} else if fromFile := fileValues[p.env]; fromFile != "" {
+			value = fromFile
+		}
+		if err := p.set(strings.TrimSpace(value)); err != nil {
+			problems.Invalid = append(problems.Invalid, fmt.Sprintf("%s: %v", p.name(), err))
+		}
+	}
+	c.validate(params, problems)
+
+	if len(problems.Missing) > 0 || len(problems.Invalid) > 0 {
+		return nil, problems
+	}
+	return c, nil
+}
+
+// readFile читает параметры из файла path. Если path пустой, читается файл .env,
+// а его отсутствие не считается ошибкой.
+func readFile(path string) (map[string]string, error) {
+	optional := path == ""
+	if optional {
+		path = defaultFile
+	}
+	values, err := godotenv.Read(path)
+	if err != nil {
+		if optional && errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка при чтении файла настроек %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// validate проверяет обязательные параметры и согласованность значений.
+func (c *Config) validate(params []param, problems *Error) {
+	byEnv := make(map[string]param, len(params))
+	for _, p := range params {
+		byEnv[p.env] = p
+	}
+	require := func(env, value string) {
+		if value == "" {
+			problems.Missing = append(problems.Missing, byEnv[env].name())
+		}
+	}
+	invalid := func(env, format string, args ...any) {
+		problems.Invalid = append(problems.Invalid, byEnv[env].name()+": "+fmt.Sprintf(format, args...))
+	}
+
+	// Командам обслуживания нужна только база данных
+	if len(c.Command) == 0 {
+		require("BOT_TOKEN", c.BotToken)
+	}
+	if len(c.APIKeys) > 0 && c.HTTPAddr == "" {
+		invalid("API_KEYS", "API работает на служебном HTTP-сервере, задайте HTTP_ADDR")
+	}
+
+	if c.Transport == TransportWebhook {
+		require("WEBHOOK_URL", c.WebhookURL)
+		require("WEBHOOK_ADDR", c.WebhookAddr)
+		if c.WebhookURL != "" {
+			if u, err := url.Parse(c.WebhookURL); err != nil || u.Scheme != "https" || u.Host == "" {
+				invalid("WEBHOOK_URL", "ожидается адрес https://...")
+			}
+		}
+	}
+
+	db := c.Database
+	if db.URL == "" {
+		require("POSTGRES_HOST", db.Host)
+		require("POSTGRES_USER", db.User)
+		require("POSTGRES_PASSWORD", db.Password)
+		require("POSTGRES_DB", db.Name)
+	}
+	if db.MaxOpenConns > 0 && db.MaxIdleConns > db.MaxOpenConns {
+		invalid("DB_MAX_IDLE_CONNS", "больше DB_MAX_OPEN_CONNS (%d)", db.MaxOpenConns)
+	}
+	if c.CatalogMaxAge <= c.CatalogRefreshInterval {
+		invalid("CATALOG_MAX_AGE", "должен быть больше CATALOG_REFRESH_INTERVAL (%s)", c.CatalogRefreshInterval)
+	}
+}
+
+func stringVar(p *string) func(string) error {
+	return func(value string) error {
+		*p = value
+		return nil
+	}
+}
+
+func intVar(p *int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("ожидается целое число, получено %q", value)
+		}
+		if n < 0 {
+			return fmt.Errorf("число не может быть отрицательным: %d", n)
+		}
+		*p = n
+		return nil
+	}
+}
+
+func durationVar(p *time.Duration) func(string) error {
+	return func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("ожидается длительность (например, 30s или 5m), получено %q", value)
+		}
+		if d <= 0 {
+			return fmt.Errorf("длительность должна быть положительной: %s", value)
+		}
+		*p = d
+		return nil
+	}
+}
+
+func levelVar(p *slog.Level) func(string) error {
+	return func(value string) (err error) {
+		*p, err = logging.ParseLevel(value)
+		return err
+	}
+}
+
+// chatIDVar разбирает ID чата Telegram: у групп он отрицательный, пустое значение - 0.
+func chatIDVar(p *int64) func(string) error {
+	return func(value string) error {
+		if value == "" {
+			*p = 0
+			return nil
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ожидается ID чата, получено %q", value)
+		}
+		*p = id
+		return nil
+	}
+}
+
+// clockVar разбирает время суток ЧЧ:ММ и записывает его как смещение от начала суток.
+func clockVar(p *time.Duration) func(string) error {
+	return func(value string) error {
+		t, err := time.Parse("15:04", value)
+		if err != nil {
+			return fmt.Errorf("ожидается время ЧЧ:ММ, получено %q", value)
+		}
+		*p = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		return nil
+	}
+}
+
+func locationVar(p **time.Location) func(string) error {
+	return func(value string) (err error) {
+		*p, err = time.LoadLocation(value)
+		return err
+	}
+}
+
+func transportVar(p *string) func(string) error {
+	return func(value string) error {
+		switch value {
+		case TransportPolling, TransportWebhook:
+			*p = value
+			return nil
+		}
+		return fmt.Errorf("ожидается %s или %s, получено %q", TransportPolling, TransportWebhook, value)
+	}
+}
+
+func sslModeVar(p *string) func(string) error {
+	return func(value string) error {
+		switch value {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+			*p = value
+			return nil
+		}
+		return fmt.Errorf("неизвестный режим TLS %q", value)
+	}
+}
+
+// adminIDsVar разбирает список ID администраторов через запятую.
+func adminIDsVar(p *map[int64]bool) func(string) error {
+	return func(value string) error {
+		ids := make(map[int64]bool)
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return fmt.Errorf("неверный ID администратора %q", field)
+			}
+			ids[id] = true
+		}
+		*p = ids
+		return nil
+	}
+}
+
+// minAPIKeyLength - минимальная длина ключа API.
+const minAPIKeyLength = 16
+
+// apiKeysVar разбирает ключи API в виде имя:ключ через запятую.
+// Ошибки не содержат самих записей, чтобы ключи не попали в журнал.
+func apiKeysVar(p *map[string]string) func(string) error {
+	return func(value string) error {
+		keys := make(map[string]string)
+		for i, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			name, key, ok := strings.Cut(field, ":")
+			if !ok || name == "" {
+				return fmt.Errorf("запись %d (длина %d) не в формате имя:ключ", i+1, len(field))
+			}
+			if len(key) < minAPIKeyLength {
+				return fmt.Errorf("ключ клиента %s короче %d символов", name, minAPIKeyLength)
+			}
+			if _, ok := keys[key]; ok {
+				return fmt.Errorf("ключ клиента %s совпадает с ключом другого клиента", name)
+			}
+			keys[key] = name
+		}
+		*p = keys
+		return nil
+	}
+}
@@ -0,0 +1,270 @@
+package database
+
+import (
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// broadcastRecipientsQuery возвращает запрос получателей рассылки: пользователей, не отписавшихся
+// от рассылок, а если задан тип пива - только тех из них, кто заказывал пиво этого типа.
+// typeParam - номер параметра запроса с типом пива (пустая строка - все пользователи).
+func broadcastRecipientsQuery(typeParam int) string {
+	return fmt.Sprintf(`
+		SELECT u.id FROM users u
+		WHERE NOT u.broadcast_opt_out
+			AND ($%[1]d = '' OR EXISTS (
+				SELECT 1 FROM orders o
+				JOIN order_items oi ON oi.order_id = o.id
+				JOIN beers b ON b.id = oi.beer_id
+				WHERE o.user_id = u.id AND b.type = $%[1]d))`, typeParam)
+}
+
+// CountBroadcastRecipients возвращает количество получателей рассылки для сегмента beerType
+// (пустая строка - все пользователи).
+func CountBroadcastRecipients(ctx context.Context, db *sql.DB, beerType string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT count(*) FROM ("+broadcastRecipientsQuery(1)+") r", beerType).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при подсчете получателей рассылки: %w", err)
+	}
+	return count, nil
+}
+
+// CreateBroadcast сохраняет рассылку вместе со списком получателей и возвращает ее ID.
+// Список получателей фиксируется в момент создания.
+func CreateBroadcast(ctx context.Context, db *sql.DB, broadcast models.Broadcast) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	buttons, err := json.Marshal(broadcast.Buttons)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось сохранить кнопки рассылки: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	var broadcastID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO broadcasts (author_id, text, photo_file_id, buttons, beer_type)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		broadcast.AuthorID, broadcast.Text, broadcast.PhotoFileID, string(buttons), broadcast.BeerType).Scan(&broadcastID)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось создать рассылку: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO broadcast_deliveries (broadcast_id, user_id) SELECT $1, id FROM ("+broadcastRecipientsQuery(2)+") r",
+		broadcastID, broadcast.BeerType)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось сохранить получателей рассылки: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("не удалось зафиксировать рассылку: %w", err)
+	}
+	return broadcastID, nil
+}
+
+// GetBroadcast получает рассылку по ID. Для несуществующей рассылки возвращает nil.
+func GetBroadcast(ctx context.Context, db *sql.DB, broadcastID int64) (*models.Broadcast, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	broadcasts, err := queryBroadcasts(ctx, db, "WHERE id = $1", broadcastID)
+	if err != nil || len(broadcasts) == 0 {
+		return nil, err
+	}
+	return &broadcasts[0], nil
+}
+
+// GetBroadcastsInProgress получает рассылки, отправка которых не завершена (например, прервана перезапуском).
+func GetBroadcastsInProgress(ctx context.Context, db *sql.DB) ([]models.Broadcast, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return queryBroadcasts(ctx, db, "WHERE status = $1", models.BroadcastSending)
+}
+
+// queryBroadcasts выполняет запрос рассылок с условием where.
+func queryBroadcasts(ctx context.Context, db *sql.DB, where string, args ...any) ([]models.Broadcast, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, author_id, text, photo_file_id, buttons, beer_type, status, created_at
+		FROM broadcasts `+where+`
+		ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении рассылок: %w", err)
+	}
+	defer rows.Close()
+
+	var broadcasts []models.Broadcast
+	for rows.Next() {
+		var broadcast models.Broadcast
+		var buttons []byte
+		if err := rows.Scan(&broadcast.ID, &broadcast.AuthorID, &broadcast.Text, &broadcast.PhotoFileID, &buttons,
+			&broadcast.BeerType, &broadcast.Status, &broadcast.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении рассылки: %w", err)
+		}
+		if err := json.Unmarshal(buttons, &broadcast.Buttons); err != nil {
+			return nil, fmt.Errorf("ошибка в кнопках рассылки #%d: %w", broadcast.ID, err)
+		}
+		broadcasts = append(broadcasts, broadcast)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении рассылок: %w", err)
+	}
+	return broadcasts, nil
+}
+
+// TakePendingDeliveries отмечает пропущенными доставки получателям, которые отписались от рассылок,
+// и возвращает ID получателей, которым сообщение еще не отправлено.
+func TakePendingDeliveries(ctx context.Context, db *sql.DB, broadcastID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE broadcast_deliveries d SET status = 'skipped'
+		FROM users u
+		WHERE d.user_id = u.id AND d.broadcast_id = $1 AND d.status = 'pending' AND u.broadcast_opt_out`, broadcastID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при исключении отписавшихся получателей: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT user_id FROM broadcast_deliveries WHERE broadcast_id = $1 AND status = 'pending' ORDER BY user_id", broadcastID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении получателей рассылки: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении получателя рассылки: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении получателей рассылки: %w", err)
+	}
+	return userIDs, nil
+}
+
+// SetDeliveryResult сохраняет результат доставки рассылки получателю.
+// errText - текст ошибки для недоставленного сообщения.
+func SetDeliveryResult(ctx context.Context, db *sql.DB, broadcastID, userID int64, status, errText string, attempts int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE broadcast_deliveries
+		SET status = $3, error = $4, attempts = $5, sent_at = CASE WHEN $3 = 'sent' THEN now() END
+		WHERE broadcast_id = $1 AND user_id = $2`,
+		broadcastID, userID, status, errText, attempts)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении результата доставки: %w", err)
+	}
+	return nil
+}
+
+// FinishBroadcast завершает рассылку со статусом status (отправлена или остановлена).
+// Неотправленные сообщения остановленной рассылки остаются в статусе pending.
+func FinishBroadcast(ctx context.Context, db *sql.DB, broadcastID int64, status string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "UPDATE broadcasts SET status = $2, finished_at = now() WHERE id = $1 AND status = 'sending'", broadcastID, status)
+	if err != nil {
+		return fmt.Errorf("ошибка при завершении рассылки: %w", err)
+	}
+	return nil
+}
+
+// GetBroadcastStats возвращает итоги доставки рассылки.
+func GetBroadcastStats(ctx context.Context, db *sql.DB, broadcastID int64) (models.BroadcastStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var stats models.BroadcastStats
+	err := db.QueryRowContext(ctx, `
+		SELECT count(*),
+			count(*) FILTER (WHERE status = 'sent'),
+			count(*) FILTER (WHERE status = 'failed'),
+			count(*) FILTER (WHERE status = 'skipped'),
+			count(*) FILTER (WHERE status = 'pending')
+		FROM broadcast_deliveries
+		WHERE broadcast_id = $1`, broadcastID).
+		Scan(&stats.Total, &stats.Sent, &stats.Failed, &stats.Skipped, &stats.Pending)
+	if err != nil {
+		return stats, fmt.Errorf("ошибка при получении итогов рассылки: %w", err)
+	}
+	return stats, nil
+}
+
+// GetFailedDeliveries получает до limit недоставленных сообщений рассылки с текстами ошибок.
+func GetFailedDeliveries(ctx context.Context, db *sql.DB, broadcastID int64, limit int) ([]models.BroadcastDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_id, status, error, attempts, sent_at
+		FROM broadcast_deliveries
+		WHERE broadcast_id = $1 AND status = 'failed'
+		ORDER BY user_id
+		LIMIT $2`, broadcastID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении недоставленных сообщений: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.BroadcastDelivery
+	for rows.Next() {
+		var delivery models.BroadcastDelivery
+		var sentAt sql.NullTime
+		if err := rows.Scan(&delivery.UserID, &delivery.Status, &delivery.Error, &delivery.Attempts, &sentAt); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении результата доставки: %w", err)
+		}
+		if sentAt.Valid {
+			delivery.SentAt = &sentAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении недоставленных сообщений: %w", err)
+	}
+	return deliveries, nil
+}
+
+// SetBroadcastOptOut включает (optOut = true) или выключает отказ пользователя от рассылок.
+func SetBroadcastOptOut(ctx context.Context, db *sql.DB, userID int64, optOut bool) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, "UPDATE users SET broadcast_opt_out = $2 WHERE id = $1", userID, optOut); err != nil {
+		return fmt.Errorf("ошибка при изменении подписки на рассылки: %w", err)
+	}
+	return nil
+}
+
+// GetBroadcastOptOut проверяет, отказался ли пользователь от рассылок.
+func GetBroadcastOptOut(ctx context.Context, db *sql.DB, userID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var optOut bool
+	err := db.QueryRowContext(ctx, "SELECT broadcast_opt_out FROM users WHERE id = $1", userID).Scan(&optOut)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("ошибка при получении подписки на рассылки: %w", err)
+	}
+	return optOut, nil
+}
@@ -1,180 +1,526 @@
 package database
 
 import (
+	"beer_from_the_brewery/config"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/metrics"
 	"beer_from_the_brewery/models"
+	"cmp"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"sync"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq" // Импорт драйвера PostgreSQL
+	"github.com/lib/pq"
 )
 
-// ConnectToDatabase устанавливает соединение с базой данных.
-func ConnectToDatabase() (*sql.DB, error) {
-	// Загрузка переменных окружения из .env файла
-	err := godotenv.Load()
-	if err != nil {
-		return nil, fmt.Errorf("ошибка при загрузке .env файла: %w", err)
-	}
-	// Получение параметров подключения из переменных окружения
-	user, ok := os.LookupEnv("POSTGRES_USER")
-	if !ok || user == "" {
-		return nil, fmt.Errorf("переменная окружения POSTGRES_USER не задана")
-	}
-	pass, ok := os.LookupEnv("POSTGRES_PASSWORD")
-	if !ok || pass == "" {
-		return nil, fmt.Errorf("переменная окружения POSTGRES_PASSWORD не задана")
-	}
-	host, ok := os.LookupEnv("POSTGRES_HOST")
-	if !ok || host == "" {
-		return nil, fmt.Errorf("переменная окружения POSTGRES_HOST не задана")
-	}
-	port, ok := os.LookupEnv("POSTGRES_PORT")
-	if !ok || port == "" {
-		return nil, fmt.Errorf("переменная окружения POSTGRES_PORT не задана")
-	}
-	dbname, ok := os.LookupEnv("POSTGRES_DB")
-	if !ok || dbname == "" {
-		return nil, fmt.Errorf("переменная окружения POSTGRES_DB не задана")
-	}
-
-	// Формируем строку подключения, используя переменные окружения
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", user, pass, host, port, dbname)
-
-	// Открываем соединение с базой данных
-	db, err := sql.Open("postgres", connStr)
+// ConnectToDatabase устанавливает соединение с базой данных с параметрами cfg.
+func ConnectToDatabase(ctx context.Context, cfg config.Database) (*sql.DB, error) {
+	// Открываем соединение с базой данных; все запросы проходят через замер времени и ошибок (см. instrument.go)
+	connector, err := pq.NewConnector(cfg.ConnString())
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при открытии соединения с базой данных: %w", err)
 	}
+	db := sql.OpenDB(instrumentedConnector{connector: connector})
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
 	// Проверяем соединение
-	err = db.Ping()
-	if err != nil {
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("ошибка при проверке соединения с базой данных: %w", err)
 	}
 
 	return db, nil
 }
 
-// GetBeers получает список всего пива из базы данных.
-func GetBeers(ctx context.Context, db *sql.DB) ([]models.Beer, error) {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-	rows, err := db.QueryContext(ctx, "SELECT id, name, price, quantity, type, image_url, description FROM beers")
+// beerSelect выбирает пиво вместе со средней оценкой и количеством опубликованных отзывов.
+// Таблица beers доступна в запросе под псевдонимом b.
+const beerSelect = `
+	SELECT b.id, b.name, b.price, b.quantity, b.type, b.image_url, b.description,
+		COALESCE(r.rating, 0), COALESCE(r.rating_count, 0)
+	FROM beers b
+	LEFT JOIN (
+		SELECT beer_id, AVG(rating)::float8 AS rating, COUNT(*) AS rating_count
+		FROM reviews
+		WHERE NOT hidden
+		GROUP BY beer_id
+	) r ON r.beer_id = b.id`
+
+// rowScanner обобщает *sql.Row и *sql.Rows для чтения одной строки.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanBeer считывает пиво из строки, выбранной запросом beerSelect.
+func scanBeer(row rowScanner) (models.Beer, error) {
+	var beer models.Beer
+	err := row.Scan(&beer.ID, &beer.Name, &beer.Price, &beer.Quantity, &beer.Type, &beer.ImageURL, &beer.Description, &beer.Rating, &beer.RatingCount)
+	return beer, err
+}
+
+// queryBeers выполняет запрос, построенный на основе beerSelect, и считывает все найденное пиво.
+func queryBeers(ctx context.Context, db *sql.DB, query string, args ...any) ([]models.Beer, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при выполнении запросsа: %w", err)
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
 	}
 	defer rows.Close()
 
 	var beers []models.Beer
 	for rows.Next() {
-		var beer models.Beer
-		err := rows.Scan(&beer.ID, &beer.Name, &beer.Price, &beer.Quantity, &beer.Type, &beer.ImageURL, &beer.Description)
+		beer, err := scanBeer(rows)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
 		}
 		beers = append(beers, beer)
 	}
 
-	return beers, nil
+	return beers, rows.Err()
+}
+
+// GetBeers получает список всего пива из базы данных.
+func GetBeers(ctx context.Context, db *sql.DB) ([]models.Beer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return queryBeers(ctx, db, beerSelect+" ORDER BY b.id")
 }
 
 // SearchBeers ищет пиво по названию в базе данных.
 func SearchBeers(ctx context.Context, db *sql.DB, searchQuery string) ([]models.Beer, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	rows, err := db.QueryContext(ctx, "SELECT id, name, price, quantity, type, image_url, description FROM beers WHERE lower(name) LIKE lower($1)", "%"+searchQuery+"%")
-	if err != nil {
-		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	return queryBeers(ctx, db, beerSelect+" WHERE lower(b.name) LIKE lower($1) ORDER BY b.id", "%"+searchQuery+"%")
+}
+
+// GetBeer получает пиво по ID из базы данных. Возвращает nil, если пиво не найдено.
+func GetBeer(ctx context.Context, db *sql.DB, beerID int) (*models.Beer, error) {
+	beers, err := GetBeersByIDs(ctx, db, []int{beerID})
+	if err != nil || len(beers) == 0 {
+		return nil, err
 	}
-	defer rows.Close()
+	return &beers[0], nil
+}
 
-	var beers []models.Beer
-	for rows.Next() {
-		var beer models.Beer
-		err := rows.Scan(&beer.ID, &beer.Name, &beer.Price, &beer.Quantity, &beer.Type, &beer.ImageURL, &beer.Description)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
-		}
-		beers = append(beers, beer)
+// CreateBeer добавляет пиво в каталог и возвращает его ID.
+func CreateBeer(ctx context.Context, db *sql.DB, beer models.Beer) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var beerID int
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO beers (name, description, price, quantity, image_url, type)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		beer.Name, beer.Description, beer.Price, beer.Quantity, beer.ImageURL, beer.Type).Scan(&beerID)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при добавлении пива: %w", err)
 	}
+	return beerID, nil
+}
 
-	return beers, nil
+// BeerUpdate содержит изменяемые поля пива; nil означает, что поле не изменяется.
+type BeerUpdate struct {
+	Name        *string
+	Description *string
+	Price       *float64
+	Quantity    *int
+	ImageURL    *string
+	Type        *string
 }
 
-// GetBeerByID получает информацию о пиве по его ID.
-func GetBeerByID(ctx context.Context, db *sql.DB, beerID int) (*models.Beer, error) {
+// updateBeerQuery изменяет поля пива с ID $1, для которых переданы значения (не NULL).
+const updateBeerQuery = `
+	UPDATE beers SET
+		name = COALESCE($2, name),
+		description = COALESCE($3, description),
+		price = COALESCE($4, price),
+		quantity = COALESCE($5, quantity),
+		image_url = COALESCE($6, image_url),
+		type = COALESCE($7, type)
+	WHERE id = $1`
+
+// UpdateBeer изменяет заданные поля пива. Возвращает false, если пиво не найдено.
+func UpdateBeer(ctx context.Context, db *sql.DB, beerID int, update BeerUpdate) (bool, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	var beer models.Beer
-	err := db.QueryRowContext(ctx, "SELECT id, name, price, quantity, type, image_url, description FROM beers WHERE id = $1", beerID).Scan(&beer.ID, &beer.Name, &beer.Price, &beer.Quantity, &beer.Type, &beer.ImageURL, &beer.Description)
+
+	result, err := db.ExecContext(ctx, updateBeerQuery,
+		beerID, update.Name, update.Description, update.Price, update.Quantity, update.ImageURL, update.Type)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
+		return false, fmt.Errorf("ошибка при изменении пива: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка при изменении пива: %w", err)
+	}
+	return updated > 0, nil
+}
+
+// ImportBeers в одной транзакции добавляет пиво created и изменяет пиво updated (ключ - ID пива).
+// Изменяются только заданные поля, как в UpdateBeer, поэтому остальные поля (например, остаток,
+// уменьшенный заказом после проверки файла) не перезаписываются устаревшими значениями.
+// Если хотя бы одно изменение не удалось, не применяется ни одно.
+// Возвращает ID добавленного пива в порядке created.
+func ImportBeers(ctx context.Context, db *sql.DB, created []models.Beer, updated map[int]BeerUpdate) ([]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	// Изменяем пиво по возрастанию ID, чтобы параллельные транзакции блокировали строки в одном порядке
+	beerIDs := make([]int, 0, len(updated))
+	for beerID := range updated {
+		beerIDs = append(beerIDs, beerID)
+	}
+	slices.Sort(beerIDs)
+	for _, beerID := range beerIDs {
+		update := updated[beerID]
+		result, err := tx.ExecContext(ctx, updateBeerQuery,
+			beerID, update.Name, update.Description, update.Price, update.Quantity, update.ImageURL, update.Type)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при изменении пива с ID %d: %w", beerID, err)
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return nil, fmt.Errorf("пиво с ID %d не найдено", beerID)
 		}
-		return nil, fmt.Errorf("ошибка при получении пива по ID: %w", err)
-	}
-	return &beer, nil
-
-}
-
-// UpdateBeerList периодически обновляет список доступного пива.
-func UpdateBeerList(ctx context.Context, db *sql.DB, beers *[]models.Beer, beersMutex *sync.Mutex, logger *log.Logger) { // Добавили context и logger
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			logger.Println("Обновление списка пива остановлено.")
-			return
-		case <-ticker.C:
-			newBeers, err := GetBeers(ctx, db)
-			if err != nil {
-				logger.Printf("Ошибка при обновлении списка пива: %s", err.Error())
-			} else {
-				beersMutex.Lock()
-				*beers = newBeers
-				beersMutex.Unlock()
-			}
+	}
+
+	createdIDs := make([]int, 0, len(created))
+	for _, beer := range created {
+		var beerID int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO beers (name, description, price, quantity, image_url, type)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id`,
+			beer.Name, beer.Description, beer.Price, beer.Quantity, beer.ImageURL, beer.Type).Scan(&beerID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при добавлении пива %q: %w", beer.Name, err)
 		}
+		createdIDs = append(createdIDs, beerID)
+	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось зафиксировать импорт каталога: %w", err)
 	}
+	logging.FromContext(ctx).Info("Каталог импортирован", "created", len(created), "updated", len(updated))
+	return createdIDs, nil
 }
 
-// CreateOrder создает новый заказ в базе данных.
-func CreateOrder(ctx context.Context, db *sql.DB, userID int64, cartItems []models.CartItem) error {
+// CreateOrder создает новый заказ в базе данных и возвращает его ID.
+// userID - ID пользователя Telegram, заказ связывается с записью в таблице users.
+func CreateOrder(ctx context.Context, db *sql.DB, userID int64, cartItems []models.CartItem) (int64, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("не удалось начать транзакцию: %w", err)
+		return 0, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	orderID, total, err := insertOrder(ctx, tx, userID, cartItems, fmt.Sprintf("telegram:%d", userID))
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil { // Фиксируем транзакцию, если всё прошло успешно
+		return 0, fmt.Errorf("не удалось зафиксировать заказ: %w", err)
 	}
-	defer tx.Rollback()
+	orderPlaced(ctx, orderID, len(cartItems), total)
+	return orderID, nil
+}
 
+// insertOrder создает заказ пользователя userID в транзакции tx, списывая пиво с остатка,
+// и записывает оформление в историю статусов от имени changedBy. Возвращает ID и сумму заказа.
+func insertOrder(ctx context.Context, tx *sql.Tx, userID int64, cartItems []models.CartItem, changedBy string) (int64, float64, error) {
 	// Создаем запись в таблице orders, используя RETURNING id
 	orderDate := time.Now()
-	orderStatus := "new"
+	orderStatus := models.OrderNew
 
 	var orderID int64 // Объявляем переменную для хранения orderID
-	row := tx.QueryRow("INSERT INTO orders (user_id, order_date, status) VALUES ($1, $2, $3) RETURNING id", userID, orderDate, orderStatus)
+	row := tx.QueryRowContext(ctx, "INSERT INTO orders (user_id, order_date, status, stock_taken) VALUES ($1, $2, $3, true) RETURNING id", userID, orderDate, orderStatus)
 	if err := row.Scan(&orderID); err != nil { // Считываем orderID из результата запроса
-		return fmt.Errorf("не удалось получить ID заказа: %w", err)
+		return 0, 0, fmt.Errorf("не удалось получить ID заказа: %w", err)
+	}
+
+	// Создаем записи в таблице order_items для каждого товара в корзине, запоминая текущую цену,
+	// и списываем заказанное пиво с остатка. Корзина собирается из map, поэтому пиво обходится
+	// по возрастанию ID: параллельные заказы блокируют строки beers в одном порядке и не взаимоблокируются
+	items := slices.Clone(cartItems)
+	slices.SortFunc(items, func(a, b models.CartItem) int { return cmp.Compare(a.BeerID, b.BeerID) })
+	var total float64
+	for _, cartItem := range items {
+		if err := takeFromStock(ctx, tx, cartItem.BeerID, cartItem.Quantity); err != nil {
+			return 0, 0, err
+		}
+		var sum float64
+		err := tx.QueryRowContext(ctx, "INSERT INTO order_items (order_id, beer_id, quantity, price) SELECT $1, id, $3, price FROM beers WHERE id = $2 RETURNING quantity * price", orderID, cartItem.BeerID, cartItem.Quantity).Scan(&sum)
+		if err == sql.ErrNoRows {
+			return 0, 0, fmt.Errorf("не удалось добавить позицию заказа: пиво с ID %d не найдено", cartItem.BeerID)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("не удалось добавить позицию заказа: %w", err)
+		}
+		total += sum
+	}
+
+	if _, err := insertOrderStatusHistory(ctx, tx, orderID, "", orderStatus, changedBy); err != nil {
+		return 0, 0, err
+	}
+	return orderID, total, nil
+}
+
+// orderPlaced учитывает зафиксированный заказ в метриках и журнале.
+func orderPlaced(ctx context.Context, orderID int64, items int, total float64) {
+	metrics.Checkouts.Inc()
+	metrics.OrderTotals.Observe(total)
+	logging.FromContext(ctx).Debug("Заказ сохранен", logging.OrderID, orderID, "items", items, "total", total)
+}
+
+// InsufficientStockError возвращается CreateOrder, если пива в наличии меньше, чем в заказе.
+type InsufficientStockError struct {
+	BeerID    int
+	Available int // Сколько пива осталось
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("пива с ID %d в наличии только %d", e.BeerID, e.Available)
+}
+
+// takeFromStock списывает quantity бутылок пива с остатка в транзакции заказа.
+// Возвращает *InsufficientStockError, если пива не хватает.
+func takeFromStock(ctx context.Context, tx *sql.Tx, beerID, quantity int) error {
+	result, err := tx.ExecContext(ctx, "UPDATE beers SET quantity = quantity - $2 WHERE id = $1 AND quantity >= $2", beerID, quantity)
+	if err != nil {
+		return fmt.Errorf("не удалось списать пиво с остатка: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated > 0 {
+		return err
+	}
+	var available int
+	err = tx.QueryRowContext(ctx, "SELECT quantity FROM beers WHERE id = $1", beerID).Scan(&available)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("не удалось добавить позицию заказа: пиво с ID %d не найдено", beerID)
+	}
+	if err != nil {
+		return fmt.Errorf("не удалось списать пиво с остатка: %w", err)
+	}
+	return &InsufficientStockError{BeerID: beerID, Available: available}
+}
+
+// rollback откатывает транзакцию, если она не была зафиксирована, и записывает ошибку отката
+// в журнал из ctx. Вызывается через defer сразу после начала транзакции.
+func rollback(ctx context.Context, tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		logging.FromContext(ctx).Error("Ошибка при откате транзакции", logging.Error, err)
 	}
+}
 
-	// Создаем записи в таблице order_items для каждого товара в корзине
-	for _, cartItem := range cartItems {
-		_, err = tx.Exec("INSERT INTO order_items (order_id, beer_id, quantity) VALUES ($1, $2, $3)", orderID, cartItem.BeerID, cartItem.Quantity)
+// GetOrder получает заказ по ID вместе с профилем покупателя.
+func GetOrder(ctx context.Context, db *sql.DB, orderID int64) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	order, err := scanOrder(db.QueryRowContext(ctx, `
+		SELECT o.id, o.user_id, o.order_date, o.status,
+			(SELECT COALESCE(SUM(oi.quantity * oi.price), 0)::float8 FROM order_items oi WHERE oi.order_id = o.id),
+			u.username, u.first_name, u.last_name, u.language_code, u.first_seen_at, u.last_seen_at
+		FROM orders o
+		LEFT JOIN users u ON u.id = o.user_id
+		WHERE o.id = $1`, orderID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка при получении заказа по ID: %w", err)
+	}
+	return &order, nil
+}
+
+// scanOrder считывает заказ вместе с суммой и профилем покупателя (профиль может отсутствовать).
+func scanOrder(row rowScanner) (models.Order, error) {
+	var order models.Order
+	var username, firstName, lastName, languageCode sql.NullString
+	var firstSeenAt, lastSeenAt sql.NullTime
+	err := row.Scan(&order.ID, &order.UserID, &order.OrderDate, &order.Status, &order.Total,
+		&username, &firstName, &lastName, &languageCode, &firstSeenAt, &lastSeenAt)
+	if err != nil {
+		return order, err
+	}
+	order.Customer = models.User{
+		ID:           order.UserID,
+		Username:     username.String,
+		FirstName:    firstName.String,
+		LastName:     lastName.String,
+		LanguageCode: languageCode.String,
+		FirstSeenAt:  firstSeenAt.Time,
+		LastSeenAt:   lastSeenAt.Time,
+	}
+	return order, nil
+}
+
+// GetOrderItems получает позиции заказа.
+func GetOrderItems(ctx context.Context, db *sql.DB, orderID int64) ([]models.OrderItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT beer_id, quantity, COALESCE(price, 0)::float8 FROM order_items WHERE order_id = $1 ORDER BY id", orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.OrderItem
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(&item.BeerID, &item.Quantity, &item.Price); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetUserOrders получает последние заказы пользователя (без профиля покупателя).
+func GetUserOrders(ctx context.Context, db *sql.DB, userID int64, limit int) ([]models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT o.id, o.user_id, o.order_date, o.status,
+			COALESCE(SUM(oi.quantity * oi.price), 0)::float8
+		FROM orders o
+		LEFT JOIN order_items oi ON oi.order_id = o.id
+		WHERE o.user_id = $1
+		GROUP BY o.id
+		ORDER BY o.order_date DESC
+		LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		if err := rows.Scan(&order.ID, &order.UserID, &order.OrderDate, &order.Status, &order.Total); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		order.Customer.ID = order.UserID
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+// OrderFilter задает условия выборки заказов; пустые поля не ограничивают выборку.
+type OrderFilter struct {
+	Status string    // Статус заказа
+	UserID int64     // Покупатель
+	From   time.Time // Заказы, оформленные не раньше
+	To     time.Time // Заказы, оформленные раньше
+	Limit  int       // Максимальное количество заказов; 0 - без ограничения
+	Offset int       // Сколько заказов пропустить
+}
+
+// ListOrders получает заказы вместе с профилями покупателей, начиная с новых.
+func ListOrders(ctx context.Context, db *sql.DB, filter OrderFilter) ([]models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Status != "" {
+		where("o.status = $%d", filter.Status)
+	}
+	if filter.UserID != 0 {
+		where("o.user_id = $%d", filter.UserID)
+	}
+	if !filter.From.IsZero() {
+		where("o.order_date >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("o.order_date < $%d", filter.To)
+	}
+	query := `
+		SELECT o.id, o.user_id, o.order_date, o.status,
+			(SELECT COALESCE(SUM(oi.quantity * oi.price), 0)::float8 FROM order_items oi WHERE oi.order_id = o.id),
+			u.username, u.first_name, u.last_name, u.language_code, u.first_seen_at, u.last_seen_at
+		FROM orders o
+		LEFT JOIN users u ON u.id = o.user_id`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	var limit any // NULL в LIMIT означает отсутствие ограничения
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	args = append(args, limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY o.order_date DESC, o.id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
 		if err != nil {
-			return fmt.Errorf("не удалось добавить позицию заказа: %w", err)
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+// GetOrderItemsByOrderIDs получает позиции заказов с указанными ID одним запросом.
+// Возвращает позиции по ID заказа.
+func GetOrderItemsByOrderIDs(ctx context.Context, db *sql.DB, orderIDs []int64) (map[int64][]models.OrderItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT order_id, beer_id, quantity, COALESCE(price, 0)::float8
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, id`, pq.Array(orderIDs))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	items := make(map[int64][]models.OrderItem)
+	for rows.Next() {
+		var orderID int64
+		var item models.OrderItem
+		if err := rows.Scan(&orderID, &item.BeerID, &item.Quantity, &item.Price); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
 		}
+		items[orderID] = append(items[orderID], item)
 	}
+	return items, rows.Err()
+}
 
-	return tx.Commit() // Фиксируем транзакцию, если всё прошло успешно
+// GetBeersByIDs получает пиво с указанными ID одним запросом. Пиво, которого нет в базе данных,
+// в результат не попадает.
+func GetBeersByIDs(ctx context.Context, db *sql.DB, ids []int) ([]models.Beer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return queryBeers(ctx, db, beerSelect+" WHERE b.id = ANY($1) ORDER BY b.id", pq.Array(ids))
 }
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ToggleFavorite добавляет пиво в избранное пользователя или убирает его оттуда.
+// Возвращает true, если пиво было добавлено, и false, если удалено.
+func ToggleFavorite(ctx context.Context, db *sql.DB, userID int64, beerID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "DELETE FROM favorites WHERE user_id = $1 AND beer_id = $2", userID, beerID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при удалении из избранного: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка при удалении из избранного: %w", err)
+	}
+	if removed > 0 {
+		return false, nil
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO favorites (user_id, beer_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, beerID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при добавлении в избранное: %w", err)
+	}
+	return true, nil
+}
+
+// GetFavoriteIDs возвращает множество ID пива, добавленного пользователем в избранное.
+func GetFavoriteIDs(ctx context.Context, db *sql.DB, userID int64) (map[int]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT beer_id FROM favorites WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	favoriteIDs := make(map[int]bool)
+	for rows.Next() {
+		var beerID int
+		if err := rows.Scan(&beerID); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		favoriteIDs[beerID] = true
+	}
+	return favoriteIDs, rows.Err()
+}
+
+// GetFavoriteBeers получает избранное пиво пользователя с актуальными ценой и остатком.
+func GetFavoriteBeers(ctx context.Context, db *sql.DB, userID int64) ([]models.Beer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return queryBeers(ctx, db, beerSelect+`
+		JOIN favorites f ON f.beer_id = b.id
+		WHERE f.user_id = $1
+		ORDER BY f.created_at`, userID)
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"beer_from_the_brewery/metrics"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+)
+
+// instrumentedConnector подключается к базе данных через connector и измеряет время
+// и ошибки всех запросов (метрики beer_bot_db_query_*).
+type instrumentedConnector struct {
+	connector driver.Connector
+}
+
+func (c instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn}, nil
+}
+
+func (c instrumentedConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+// instrumentedConn передает запросы соединению драйвера, замеряя их выполнение.
+// Драйвер PostgreSQL (lib/pq) поддерживает все используемые здесь интерфейсы.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	observeQuery(query, start, err)
+	return rows, err
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	observeQuery(query, start, err)
+	return result, err
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// observeQuery записывает время выполнения запроса query и ошибку, если она есть.
+// Запросы различаются по виду (select, insert, update, delete и т. д.), а не по тексту,
+// чтобы число меток метрики не зависело от количества запросов в коде.
+func observeQuery(query string, start time.Time, err error) {
+	operation := queryOperation(query)
+	metrics.DBQueryDuration.With(operation).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, driver.ErrSkip) && !errors.Is(err, context.Canceled) {
+		metrics.DBQueryErrors.With(operation).Inc()
+	}
+}
+
+// queryOperation возвращает вид запроса - первое слово его текста в нижнем регистре.
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch operation := strings.ToLower(fields[0]); operation {
+	case "select", "insert", "update", "delete", "with", "create", "alter", "drop", "listen", "notify":
+		return operation
+	}
+	return "other"
+}
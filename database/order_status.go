@@ -0,0 +1,170 @@
+package database
+
+import (
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/metrics"
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// orderTransitions - статусы, в которые можно перевести заказ из каждого статуса.
+// Из отмененного заказа и заказа с возвращенными деньгами перейти никуда нельзя.
+var orderTransitions = map[string][]string{
+	models.OrderNew:       {models.OrderConfirmed, models.OrderCancelled},
+	models.OrderConfirmed: {models.OrderPacking, models.OrderCancelled},
+	models.OrderPacking:   {models.OrderReady, models.OrderCancelled},
+	models.OrderReady:     {models.OrderShipped, models.OrderDelivered, models.OrderCancelled},
+	models.OrderShipped:   {models.OrderDelivered, models.OrderCancelled},
+	models.OrderDelivered: {models.OrderRefunded},
+}
+
+// ErrUnknownOrderStatus возвращается ChangeOrderStatus для статуса не из models.OrderStatuses.
+var ErrUnknownOrderStatus = errors.New("неизвестный статус заказа")
+
+// OrderTransitionError возвращается ChangeOrderStatus, если заказ нельзя перевести в новый статус.
+type OrderTransitionError struct {
+	OrderID  int64
+	From, To string
+}
+
+func (e *OrderTransitionError) Error() string {
+	return fmt.Sprintf("заказ #%d нельзя перевести из статуса %s в статус %s", e.OrderID, e.From, e.To)
+}
+
+// NextOrderStatuses возвращает статусы, в которые можно перевести заказ из статуса status.
+// Заказ со статусом, записанным до появления списка статусов, можно перевести в любой статус.
+func NextOrderStatuses(status string) []string {
+	if !slices.Contains(models.OrderStatuses, status) {
+		return models.OrderStatuses
+	}
+	return orderTransitions[status]
+}
+
+// OrderStatusHook - обработчик изменения статуса заказа. Вызывается после фиксации изменения
+// в той же горутине, что и ChangeOrderStatus, поэтому долгую работу нужно выполнять в фоне.
+type OrderStatusHook func(ctx context.Context, change models.OrderStatusChange)
+
+var (
+	orderStatusHooksMu sync.RWMutex
+	orderStatusHooks   []OrderStatusHook
+)
+
+// OnOrderStatusChange подписывает hook на все изменения статусов заказов.
+func OnOrderStatusChange(hook OrderStatusHook) {
+	orderStatusHooksMu.Lock()
+	defer orderStatusHooksMu.Unlock()
+	orderStatusHooks = append(orderStatusHooks, hook)
+}
+
+// ChangeOrderStatus переводит заказ в статус status, если такой переход разрешен, записывает
+// изменение в историю от имени changedBy и вызывает обработчики OnOrderStatusChange.
+// При отмене заказа, списавшего пиво с остатка, пиво возвращается на остаток.
+// Возвращает ErrUnknownOrderStatus, *OrderTransitionError или sql.ErrNoRows, если заказ не найден.
+func ChangeOrderStatus(ctx context.Context, db *sql.DB, orderID int64, status, changedBy string) (*models.OrderStatusChange, error) {
+	if !slices.Contains(models.OrderStatuses, status) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownOrderStatus, status)
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer rollback(dbCtx, tx)
+
+	change := models.OrderStatusChange{OrderID: orderID, To: status, ChangedBy: changedBy}
+	var stockTaken bool
+	err = tx.QueryRowContext(dbCtx, "SELECT user_id, status, stock_taken FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&change.UserID, &change.From, &stockTaken)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении заказа: %w", err)
+	}
+	if !slices.Contains(NextOrderStatuses(change.From), status) {
+		return nil, &OrderTransitionError{OrderID: orderID, From: change.From, To: status}
+	}
+
+	if _, err := tx.ExecContext(dbCtx, "UPDATE orders SET status = $2 WHERE id = $1", orderID, status); err != nil {
+		return nil, fmt.Errorf("ошибка при изменении статуса заказа: %w", err)
+	}
+	// Заказы, оформленные до списания остатка, пиво с остатка не списывали, и возвращать его нельзя
+	if status == models.OrderCancelled && stockTaken {
+		_, err := tx.ExecContext(dbCtx, `
+			UPDATE beers b SET quantity = b.quantity + i.quantity
+			FROM (SELECT beer_id, SUM(quantity) AS quantity FROM order_items WHERE order_id = $1 GROUP BY beer_id) i
+			WHERE b.id = i.beer_id`, orderID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при возврате пива на остаток: %w", err)
+		}
+		if _, err := tx.ExecContext(dbCtx, "UPDATE orders SET stock_taken = false WHERE id = $1", orderID); err != nil {
+			return nil, fmt.Errorf("ошибка при возврате пива на остаток: %w", err)
+		}
+	}
+	if change.ChangedAt, err = insertOrderStatusHistory(dbCtx, tx, orderID, change.From, status, changedBy); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при изменении статуса заказа: %w", err)
+	}
+	metrics.OrderStatusChanges.With(status).Inc()
+	logging.FromContext(ctx).Info("Статус заказа изменен", logging.OrderID, orderID,
+		"previous", change.From, "status", status, "changed_by", changedBy)
+
+	orderStatusHooksMu.RLock()
+	hooks := slices.Clone(orderStatusHooks)
+	orderStatusHooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, change)
+	}
+	return &change, nil
+}
+
+// insertOrderStatusHistory записывает изменение статуса заказа в историю и возвращает его время.
+// Пустой from означает оформление заказа.
+func insertOrderStatusHistory(ctx context.Context, tx *sql.Tx, orderID int64, from, to, changedBy string) (time.Time, error) {
+	var changedAt time.Time
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO order_status_history (order_id, from_status, to_status, changed_by)
+		VALUES ($1, NULLIF($2, ''), $3, $4)
+		RETURNING changed_at`, orderID, from, to, changedBy).Scan(&changedAt)
+	if err != nil {
+		return changedAt, fmt.Errorf("ошибка при записи истории статусов заказа: %w", err)
+	}
+	return changedAt, nil
+}
+
+// GetOrderStatusHistory получает историю статусов заказа, начиная с оформления.
+func GetOrderStatusHistory(ctx context.Context, db *sql.DB, orderID int64) ([]models.OrderStatusChange, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT h.order_id, o.user_id, COALESCE(h.from_status, ''), h.to_status, h.changed_by, h.changed_at
+		FROM order_status_history h
+		JOIN orders o ON o.id = h.order_id
+		WHERE h.order_id = $1
+		ORDER BY h.changed_at, h.id`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var history []models.OrderStatusChange
+	for rows.Next() {
+		var change models.OrderStatusChange
+		if err := rows.Scan(&change.OrderID, &change.UserID, &change.From, &change.To, &change.ChangedBy, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetBeerCooccurrence подсчитывает, в скольких заказах каждая пара сортов пива встречалась вместе.
+// Результат симметричен: counts[a][b] == counts[b][a].
+func GetBeerCooccurrence(ctx context.Context, db *sql.DB) (map[int]map[int]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT a.beer_id, b.beer_id, COUNT(DISTINCT a.order_id)
+		FROM order_items a
+		JOIN order_items b ON b.order_id = a.order_id AND b.beer_id <> a.beer_id
+		GROUP BY a.beer_id, b.beer_id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int]map[int]int)
+	for rows.Next() {
+		var beerID, otherID, orders int
+		if err := rows.Scan(&beerID, &otherID, &orders); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		if counts[beerID] == nil {
+			counts[beerID] = make(map[int]int)
+		}
+		counts[beerID][otherID] = orders
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SalesSummary - итоги продаж за период.
+type SalesSummary struct {
+	Orders             int     // Количество заказов
+	Revenue            float64 // Выручка по ценам на момент оформления
+	NewCustomers       int     // Покупатели, оформившие первый заказ в этом периоде
+	ReturningCustomers int     // Покупатели, которые заказывали и раньше
+}
+
+// BeerSales - продажи одного сорта пива за период.
+type BeerSales struct {
+	BeerID   int
+	Name     string  // Название пива (пустое, если пиво удалено из каталога)
+	Quantity int     // Продано бутылок
+	Revenue  float64 // Выручка по ценам на момент оформления
+}
+
+// GetSalesSummary подсчитывает заказы, выручку и покупателей за период с from (включительно) до to.
+// Отмененные заказы и заказы с возвращенными деньгами не учитываются.
+func GetSalesSummary(ctx context.Context, db *sql.DB, from, to time.Time) (SalesSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var summary SalesSummary
+	err := db.QueryRowContext(ctx, `
+		WITH period AS (
+			SELECT id, user_id FROM orders
+			WHERE order_date >= $1 AND order_date < $2 AND status NOT IN ('cancelled', 'refunded')
+		), customers AS (
+			SELECT DISTINCT user_id,
+				EXISTS (SELECT 1 FROM orders p WHERE p.user_id = period.user_id AND p.order_date < $1
+					AND p.status NOT IN ('cancelled', 'refunded')) AS returning
+			FROM period
+		)
+		SELECT
+			(SELECT COUNT(*) FROM period),
+			(SELECT COALESCE(SUM(oi.quantity * oi.price), 0)::float8 FROM order_items oi JOIN period ON period.id = oi.order_id),
+			(SELECT COUNT(*) FROM customers WHERE NOT returning),
+			(SELECT COUNT(*) FROM customers WHERE returning)`, from, to,
+	).Scan(&summary.Orders, &summary.Revenue, &summary.NewCustomers, &summary.ReturningCustomers)
+	if err != nil {
+		return summary, fmt.Errorf("ошибка при подсчете продаж: %w", err)
+	}
+	return summary, nil
+}
+
+// GetTopBeers возвращает не больше limit сортов пива, которых за период продано больше всего бутылок.
+// Как и в GetSalesSummary, отмененные заказы и заказы с возвращенными деньгами не учитываются.
+func GetTopBeers(ctx context.Context, db *sql.DB, from, to time.Time, limit int) ([]BeerSales, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT oi.beer_id, COALESCE(b.name, ''), SUM(oi.quantity), COALESCE(SUM(oi.quantity * oi.price), 0)::float8
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		LEFT JOIN beers b ON b.id = oi.beer_id
+		WHERE o.order_date >= $1 AND o.order_date < $2 AND o.status NOT IN ('cancelled', 'refunded')
+		GROUP BY oi.beer_id, b.name
+		ORDER BY 3 DESC, 4 DESC, oi.beer_id
+		LIMIT $3`, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var sales []BeerSales
+	for rows.Next() {
+		var s BeerSales
+		if err := rows.Scan(&s.BeerID, &s.Name, &s.Quantity, &s.Revenue); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		sales = append(sales, s)
+	}
+	return sales, rows.Err()
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// reviewSelect выбирает отзывы вместе с именем автора и названием пива.
+const reviewSelect = `
+	SELECT r.id, r.user_id, r.beer_id, COALESCE(r.order_id, 0), r.rating, r.text, r.hidden, r.created_at,
+		COALESCE(NULLIF(u.first_name, ''), u.username, ''), b.name
+	FROM reviews r
+	LEFT JOIN users u ON u.id = r.user_id
+	JOIN beers b ON b.id = r.beer_id`
+
+// CanReviewBeer проверяет, что пользователь получил заказ и пиво входило в этот заказ.
+func CanReviewBeer(ctx context.Context, db *sql.DB, userID int64, orderID int64, beerID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var allowed bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM orders o
+			JOIN order_items oi ON oi.order_id = o.id
+			WHERE o.id = $1 AND o.user_id = $2 AND oi.beer_id = $3 AND o.status = 'delivered'
+		)`, orderID, userID, beerID).Scan(&allowed)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при проверке заказа: %w", err)
+	}
+	return allowed, nil
+}
+
+// SaveRating сохраняет оценку пользователя и возвращает ID отзыва.
+// Повторная оценка того же пива заменяет предыдущую.
+func SaveRating(ctx context.Context, db *sql.DB, userID int64, orderID int64, beerID int, rating int) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var reviewID int64
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO reviews (user_id, beer_id, order_id, rating)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, beer_id) DO UPDATE SET
+			order_id = EXCLUDED.order_id,
+			rating = EXCLUDED.rating,
+			created_at = now()
+		RETURNING id`, userID, beerID, orderID, rating).Scan(&reviewID)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при сохранении оценки: %w", err)
+	}
+	return reviewID, nil
+}
+
+// SetReviewText сохраняет текст отзыва.
+func SetReviewText(ctx context.Context, db *sql.DB, reviewID int64, text string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, "UPDATE reviews SET text = $2 WHERE id = $1", reviewID, text); err != nil {
+		return fmt.Errorf("ошибка при сохранении отзыва: %w", err)
+	}
+	return nil
+}
+
+// SetReviewHidden скрывает отзыв или возвращает его в публикацию.
+func SetReviewHidden(ctx context.Context, db *sql.DB, reviewID int64, hidden bool) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "UPDATE reviews SET hidden = $2 WHERE id = $1", reviewID, hidden)
+	if err != nil {
+		return fmt.Errorf("ошибка при модерации отзыва: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при модерации отзыва: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("отзыв с ID %d не найден", reviewID)
+	}
+	return nil
+}
+
+// GetBeerReviews получает последние отзывы о пиве.
+// includeHidden - включать ли скрытые модератором отзывы.
+func GetBeerReviews(ctx context.Context, db *sql.DB, beerID int, includeHidden bool, limit int) ([]models.Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return queryReviews(ctx, db, reviewSelect+`
+		WHERE r.beer_id = $1 AND (NOT r.hidden OR $2)
+		ORDER BY r.created_at DESC
+		LIMIT $3`, beerID, includeHidden, limit)
+}
+
+// GetLatestReviews получает последние отзывы обо всем пиве, включая скрытые, для модерации.
+func GetLatestReviews(ctx context.Context, db *sql.DB, limit int) ([]models.Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return queryReviews(ctx, db, reviewSelect+`
+		ORDER BY r.created_at DESC
+		LIMIT $1`, limit)
+}
+
+// queryReviews выполняет запрос, построенный на основе reviewSelect, и считывает найденные отзывы.
+func queryReviews(ctx context.Context, db *sql.DB, query string, args ...any) ([]models.Review, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []models.Review
+	for rows.Next() {
+		var review models.Review
+		err := rows.Scan(&review.ID, &review.UserID, &review.BeerID, &review.OrderID, &review.Rating, &review.Text, &review.Hidden, &review.CreatedAt,
+			&review.AuthorName, &review.BeerName)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
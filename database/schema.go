@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// schemaStatements содержит идемпотентные DDL-запросы, которые приводят схему базы данных
+// к виду, ожидаемому ботом. Запросы выполняются по порядку при каждом запуске,
+// поэтому новые изменения схемы добавляются только в конец списка.
+var schemaStatements = []string{
+	// Пользователи: идентификатор совпадает с ID пользователя в Telegram.
+	`CREATE TABLE IF NOT EXISTS users (
+		id BIGINT PRIMARY KEY,
+		username TEXT,
+		first_name TEXT,
+		last_name TEXT
+	)`,
+	`ALTER TABLE users ALTER COLUMN id TYPE BIGINT`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS language_code TEXT`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+
+	// Заказы ссылаются на пользователей. Ограничение создается как NOT VALID,
+	// чтобы не проверять заказы, оформленные до появления таблицы users.
+	`ALTER TABLE orders ALTER COLUMN user_id TYPE BIGINT`,
+	`DO $$
+	BEGIN
+		ALTER TABLE orders ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+	EXCEPTION
+		WHEN duplicate_object THEN NULL;
+	END $$`,
+	`CREATE INDEX IF NOT EXISTS orders_user_id_idx ON orders (user_id)`,
+
+	// Избранное пиво пользователей.
+	`CREATE TABLE IF NOT EXISTS favorites (
+		user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		beer_id INTEGER NOT NULL REFERENCES beers (id) ON DELETE CASCADE,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, beer_id)
+	)`,
+
+	// Подписки на поступление пива, которого нет в наличии.
+	`CREATE TABLE IF NOT EXISTS stock_subscriptions (
+		user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		beer_id INTEGER NOT NULL REFERENCES beers (id) ON DELETE CASCADE,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, beer_id)
+	)`,
+
+	// Оценки и отзывы покупателей: один отзыв на пиво от каждого пользователя.
+	`CREATE TABLE IF NOT EXISTS reviews (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		beer_id INTEGER NOT NULL REFERENCES beers (id) ON DELETE CASCADE,
+		order_id BIGINT REFERENCES orders (id) ON DELETE SET NULL,
+		rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+		text TEXT NOT NULL DEFAULT '',
+		hidden BOOLEAN NOT NULL DEFAULT false,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		UNIQUE (user_id, beer_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS reviews_beer_id_idx ON reviews (beer_id)`,
+
+	// Цена пива на момент оформления заказа. У заказов, оформленных раньше, цена неизвестна (NULL).
+	`ALTER TABLE order_items ADD COLUMN IF NOT EXISTS price NUMERIC(10, 2)`,
+
+	// Подписки на регулярные заказы: шаблон корзины, периодичность и дата следующего заказа.
+	`CREATE TABLE IF NOT EXISTS subscriptions (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		frequency_days INTEGER NOT NULL CHECK (frequency_days > 0),
+		next_run_at TIMESTAMPTZ NOT NULL,
+		status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused', 'cancelled')),
+		reminded BOOLEAN NOT NULL DEFAULT false,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS subscriptions_next_run_at_idx ON subscriptions (next_run_at) WHERE status = 'active'`,
+	`CREATE TABLE IF NOT EXISTS subscription_items (
+		subscription_id BIGINT NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+		beer_id INTEGER NOT NULL REFERENCES beers (id) ON DELETE CASCADE,
+		quantity INTEGER NOT NULL CHECK (quantity > 0),
+		PRIMARY KEY (subscription_id, beer_id)
+	)`,
+
+	// Язык, выбранный пользователем командой /language (NULL - язык из профиля Telegram).
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS language TEXT`,
+
+	// Рассылки администратора и результаты их доставки каждому получателю.
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS broadcast_opt_out BOOLEAN NOT NULL DEFAULT false`,
+	`CREATE TABLE IF NOT EXISTS broadcasts (
+		id BIGSERIAL PRIMARY KEY,
+		author_id BIGINT NOT NULL,
+		text TEXT NOT NULL DEFAULT '',
+		photo_file_id TEXT NOT NULL DEFAULT '',
+		buttons JSONB NOT NULL DEFAULT '[]',
+		beer_type TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'sending' CHECK (status IN ('sending', 'finished', 'cancelled')),
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		finished_at TIMESTAMPTZ
+	)`,
+	`CREATE TABLE IF NOT EXISTS broadcast_deliveries (
+		broadcast_id BIGINT NOT NULL REFERENCES broadcasts (id) ON DELETE CASCADE,
+		user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed', 'skipped')),
+		error TEXT NOT NULL DEFAULT '',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		sent_at TIMESTAMPTZ,
+		PRIMARY KEY (broadcast_id, user_id)
+	)`,
+
+	// Уведомления об изменении пива (канал beer_changes, в уведомлении - ID пива) для обновления
+	// каталога бота без полной перезагрузки. Изменение отзывов меняет рейтинг пива в каталоге.
+	`CREATE OR REPLACE FUNCTION notify_beer_change() RETURNS trigger AS $$
+	BEGIN
+		IF TG_TABLE_NAME = 'reviews' THEN
+			IF TG_OP <> 'INSERT' THEN
+				PERFORM pg_notify('beer_changes', OLD.beer_id::text);
+			END IF;
+			IF TG_OP <> 'DELETE' AND (TG_OP = 'INSERT' OR NEW.beer_id <> OLD.beer_id) THEN
+				PERFORM pg_notify('beer_changes', NEW.beer_id::text);
+			END IF;
+		ELSIF TG_OP = 'DELETE' THEN
+			PERFORM pg_notify('beer_changes', OLD.id::text);
+		ELSE
+			PERFORM pg_notify('beer_changes', NEW.id::text);
+		END IF;
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS beers_notify_change ON beers`,
+	`CREATE TRIGGER beers_notify_change AFTER INSERT OR DELETE ON beers
+		FOR EACH ROW EXECUTE FUNCTION notify_beer_change()`,
+	`DROP TRIGGER IF EXISTS beers_notify_update ON beers`,
+	`CREATE TRIGGER beers_notify_update AFTER UPDATE ON beers
+		FOR EACH ROW WHEN (OLD IS DISTINCT FROM NEW) EXECUTE FUNCTION notify_beer_change()`,
+	`DROP TRIGGER IF EXISTS reviews_notify_change ON reviews`,
+	`CREATE TRIGGER reviews_notify_change AFTER INSERT OR UPDATE OR DELETE ON reviews
+		FOR EACH ROW EXECUTE FUNCTION notify_beer_change()`,
+
+	// Низкий остаток: порог пива (NULL - общий порог из settings) и пиво, о котором уже отправлено
+	// предупреждение. Отметка снимается, когда остаток снова поднимается выше порога.
+	`ALTER TABLE beers ADD COLUMN IF NOT EXISTS low_stock_threshold INTEGER CHECK (low_stock_threshold >= 0)`,
+	`CREATE TABLE IF NOT EXISTS settings (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS low_stock_alerts (
+		beer_id INTEGER PRIMARY KEY REFERENCES beers (id) ON DELETE CASCADE,
+		alerted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+
+	// Статусы заказа (models.OrderStatuses) и история их изменений. Ограничение создается как NOT VALID,
+	// чтобы не проверять заказы со статусами, записанными до появления списка статусов.
+	`DO $$
+	BEGIN
+		ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (status IN
+			('new', 'confirmed', 'packing', 'ready', 'shipped', 'delivered', 'cancelled', 'refunded')) NOT VALID;
+	EXCEPTION
+		WHEN duplicate_object THEN NULL;
+	END $$`,
+	`CREATE TABLE IF NOT EXISTS order_status_history (
+		id BIGSERIAL PRIMARY KEY,
+		order_id BIGINT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+		from_status TEXT,
+		to_status TEXT NOT NULL,
+		changed_by TEXT NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS order_status_history_order_id_idx ON order_status_history (order_id)`,
+	// Заказ списал пиво с остатка; заказы, оформленные до списания остатка, при отмене пиво не возвращают.
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS stock_taken BOOLEAN NOT NULL DEFAULT false`,
+}
+
+// MigrateSchema создает недостающие таблицы, столбцы и индексы.
+func MigrateSchema(ctx context.Context, db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	for i, statement := range schemaStatements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("ошибка при обновлении схемы (шаг %d): %w", i+1, err)
+		}
+	}
+	return nil
+}
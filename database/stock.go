@@ -0,0 +1,281 @@
+package database
+
+import (
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SubscribeToRestock подписывает пользователя на уведомление о поступлении пива.
+// Возвращает false, если пользователь уже был подписан.
+func SubscribeToRestock(ctx context.Context, db *sql.DB, userID int64, beerID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "INSERT INTO stock_subscriptions (user_id, beer_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, beerID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при подписке на поступление: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка при подписке на поступление: %w", err)
+	}
+	return inserted > 0, nil
+}
+
+// TakeRestockSubscribers удаляет все подписки на поступление пива и возвращает ID подписчиков.
+// Подписки удаляются одним запросом, поэтому каждый подписчик будет уведомлен только один раз.
+// Если уведомление не удалось отправить, подписку нужно восстановить функцией SubscribeToRestock.
+func TakeRestockSubscribers(ctx context.Context, db *sql.DB, beerID int) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "DELETE FROM stock_subscriptions WHERE beer_id = $1 RETURNING user_id", beerID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// SetBeerQuantity устанавливает количество пива в наличии и возвращает предыдущее значение.
+func SetBeerQuantity(ctx context.Context, db *sql.DB, beerID int, quantity int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var previous int
+	err := db.QueryRowContext(ctx, `
+		UPDATE beers SET quantity = $2
+		FROM (SELECT id, quantity FROM beers WHERE id = $1 FOR UPDATE) old
+		WHERE beers.id = old.id
+		RETURNING old.quantity`, beerID, quantity).Scan(&previous)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("пиво с ID %d не найдено", beerID)
+		}
+		return 0, fmt.Errorf("ошибка при изменении количества пива: %w", err)
+	}
+	return previous, nil
+}
+
+// ErrNegativeStock возвращается, если изменение количества пива сделало бы остаток отрицательным.
+var ErrNegativeStock = errors.New("остаток пива не может быть отрицательным")
+
+// AdjustBeerQuantity изменяет количество пива в наличии на delta и возвращает новое и предыдущее значения.
+// Возвращает ErrNegativeStock, если остаток стал бы отрицательным, и sql.ErrNoRows, если пиво не найдено.
+func AdjustBeerQuantity(ctx context.Context, db *sql.DB, beerID int, delta int) (quantity, previous int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err = db.QueryRowContext(ctx, `
+		UPDATE beers SET quantity = beers.quantity + $2
+		FROM (SELECT id, quantity FROM beers WHERE id = $1 FOR UPDATE) old
+		WHERE beers.id = old.id AND old.quantity + $2 >= 0
+		RETURNING beers.quantity, old.quantity`, beerID, delta).Scan(&quantity, &previous)
+	if err == sql.ErrNoRows {
+		// Пиво не найдено или остаток стал бы отрицательным
+		var exists bool
+		if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM beers WHERE id = $1)", beerID).Scan(&exists); err != nil {
+			return 0, 0, fmt.Errorf("ошибка при изменении количества пива: %w", err)
+		}
+		if exists {
+			return 0, 0, ErrNegativeStock
+		}
+		return 0, 0, sql.ErrNoRows
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка при изменении количества пива: %w", err)
+	}
+	return quantity, previous, nil
+}
+
+// FindRestocked возвращает пиво, которого не было в наличии в старом списке, но которое появилось в новом.
+func FindRestocked(oldBeers, newBeers []models.Beer) []models.Beer {
+	outOfStock := make(map[int]bool)
+	for _, beer := range oldBeers {
+		if beer.Quantity <= 0 {
+			outOfStock[beer.ID] = true
+		}
+	}
+
+	var restocked []models.Beer
+	for _, beer := range newBeers {
+		if outOfStock[beer.ID] && beer.Quantity > 0 {
+			restocked = append(restocked, beer)
+		}
+	}
+	return restocked
+}
+
+// DefaultLowStockThreshold - общий порог низкого остатка, пока администратор не задал другой.
+const DefaultLowStockThreshold = 5
+
+// lowStockThresholdSetting - имя общего порога низкого остатка в таблице settings.
+const lowStockThresholdSetting = "low_stock_threshold"
+
+// lowStockThreshold - выражение SQL для порога низкого остатка пива b: свой порог пива,
+// общий порог из settings или DefaultLowStockThreshold.
+var lowStockThreshold = fmt.Sprintf(`COALESCE(b.low_stock_threshold,
+	(SELECT value::int FROM settings WHERE name = '%s'), %d)`, lowStockThresholdSetting, DefaultLowStockThreshold)
+
+// LowStockBeer - пиво, остаток которого не больше порога низкого остатка.
+type LowStockBeer struct {
+	ID        int
+	Name      string
+	Quantity  int
+	Threshold int  // Порог низкого остатка этого пива
+	Own       bool // Порог задан для этого пива, а не общий
+}
+
+// GetLowStockThreshold возвращает общий порог низкого остатка.
+func GetLowStockThreshold(ctx context.Context, db *sql.DB) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	threshold := DefaultLowStockThreshold
+	err := db.QueryRowContext(ctx, "SELECT value::int FROM settings WHERE name = $1", lowStockThresholdSetting).Scan(&threshold)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("ошибка при получении порога низкого остатка: %w", err)
+	}
+	return threshold, nil
+}
+
+// SetLowStockThreshold задает общий порог низкого остатка для пива без своего порога.
+func SetLowStockThreshold(ctx context.Context, db *sql.DB, threshold int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO settings (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value`, lowStockThresholdSetting, strconv.Itoa(threshold))
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении порога низкого остатка: %w", err)
+	}
+	return nil
+}
+
+// SetBeerLowStockThreshold задает порог низкого остатка пива; nil - пиво использует общий порог.
+// Возвращает sql.ErrNoRows, если пиво не найдено.
+func SetBeerLowStockThreshold(ctx context.Context, db *sql.DB, beerID int, threshold *int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "UPDATE beers SET low_stock_threshold = $2 WHERE id = $1", beerID, threshold)
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении порога низкого остатка: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении порога низкого остатка: %w", err)
+	}
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// querier обобщает *sql.DB и *sql.Tx для выполнения запросов.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryLowStock выполняет запрос, выбирающий id, name, quantity, порог и признак своего порога пива,
+// и считывает найденное пиво.
+func queryLowStock(ctx context.Context, q querier, query string, args ...any) ([]LowStockBeer, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var beers []LowStockBeer
+	for rows.Next() {
+		var beer LowStockBeer
+		if err := rows.Scan(&beer.ID, &beer.Name, &beer.Quantity, &beer.Threshold, &beer.Own); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		beers = append(beers, beer)
+	}
+	return beers, rows.Err()
+}
+
+// GetLowStockBeers возвращает пиво, остаток которого не больше его порога, начиная с наименьшего остатка.
+func GetLowStockBeers(ctx context.Context, db *sql.DB) ([]LowStockBeer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return queryLowStock(ctx, db, `
+		SELECT b.id, b.name, b.quantity, `+lowStockThreshold+`, b.low_stock_threshold IS NOT NULL
+		FROM beers b
+		WHERE b.quantity <= `+lowStockThreshold+`
+		ORDER BY b.quantity, b.id`)
+}
+
+// TakeLowStockAlerts отмечает пиво, остаток которого опустился до порога, и возвращает пиво,
+// о котором еще не предупреждали. Отметки пива, остаток которого снова выше порога (после пополнения),
+// снимаются, поэтому о каждом снижении остатка предупреждают один раз. Если предупреждение
+// не удалось отправить, отметки нужно снять функцией ClearLowStockAlerts.
+func TakeLowStockAlerts(ctx context.Context, db *sql.DB) ([]LowStockBeer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM low_stock_alerts a
+		USING beers b
+		WHERE a.beer_id = b.id AND b.quantity > `+lowStockThreshold)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при снятии отметок низкого остатка: %w", err)
+	}
+	beers, err := queryLowStock(ctx, tx, `
+		WITH alerted AS (
+			INSERT INTO low_stock_alerts (beer_id)
+			SELECT b.id FROM beers b WHERE b.quantity <= `+lowStockThreshold+`
+			ON CONFLICT (beer_id) DO NOTHING
+			RETURNING beer_id
+		)
+		SELECT b.id, b.name, b.quantity, `+lowStockThreshold+`, b.low_stock_threshold IS NOT NULL
+		FROM beers b
+		JOIN alerted ON alerted.beer_id = b.id
+		ORDER BY b.quantity, b.id`)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при отметке низкого остатка: %w", err)
+	}
+	return beers, nil
+}
+
+// ClearLowStockAlerts снимает отметки низкого остатка пива beerIDs, чтобы о нем предупредили снова
+// (например, если предупреждение не удалось отправить).
+func ClearLowStockAlerts(ctx context.Context, db *sql.DB, beerIDs []int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM low_stock_alerts WHERE beer_id = ANY($1)`, pq.Array(beerIDs))
+	if err != nil {
+		return fmt.Errorf("ошибка при снятии отметок низкого остатка: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CreateSubscription создает подписку на регулярный заказ и возвращает ее ID.
+// firstRunAt - дата и время первого заказа по подписке.
+func CreateSubscription(ctx context.Context, db *sql.DB, userID int64, frequencyDays int, firstRunAt time.Time, items []models.CartItem) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	var subscriptionID int64
+	err = tx.QueryRowContext(ctx, "INSERT INTO subscriptions (user_id, frequency_days, next_run_at) VALUES ($1, $2, $3) RETURNING id", userID, frequencyDays, firstRunAt).Scan(&subscriptionID)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось создать подписку: %w", err)
+	}
+
+	for _, item := range items {
+		_, err = tx.ExecContext(ctx, "INSERT INTO subscription_items (subscription_id, beer_id, quantity) VALUES ($1, $2, $3)", subscriptionID, item.BeerID, item.Quantity)
+		if err != nil {
+			return 0, fmt.Errorf("не удалось добавить позицию подписки: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("не удалось зафиксировать подписку: %w", err)
+	}
+	return subscriptionID, nil
+}
+
+// GetUserSubscriptions получает действующие и приостановленные подписки пользователя.
+func GetUserSubscriptions(ctx context.Context, db *sql.DB, userID int64) ([]models.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return querySubscriptions(ctx, db, `
+		SELECT id, user_id, frequency_days, next_run_at, status, reminded
+		FROM subscriptions
+		WHERE user_id = $1 AND status <> 'cancelled'
+		ORDER BY id`, userID)
+}
+
+// GetSubscriptionsDueBefore получает действующие подписки, следующий заказ по которым оформляется до момента before.
+func GetSubscriptionsDueBefore(ctx context.Context, db *sql.DB, before time.Time) ([]models.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return querySubscriptions(ctx, db, `
+		SELECT id, user_id, frequency_days, next_run_at, status, reminded
+		FROM subscriptions
+		WHERE status = 'active' AND next_run_at <= $1
+		ORDER BY next_run_at`, before)
+}
+
+// querySubscriptions выполняет запрос подписок и загружает позиции каждой из них.
+func querySubscriptions(ctx context.Context, db *sql.DB, query string, args ...any) ([]models.Subscription, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []models.Subscription
+	for rows.Next() {
+		var subscription models.Subscription
+		err := rows.Scan(&subscription.ID, &subscription.UserID, &subscription.FrequencyDays, &subscription.NextRunAt, &subscription.Status, &subscription.Reminded)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+	}
+
+	for i := range subscriptions {
+		items, err := getSubscriptionItems(ctx, db, subscriptions[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions[i].Items = items
+	}
+	return subscriptions, nil
+}
+
+// getSubscriptionItems получает шаблон корзины подписки.
+func getSubscriptionItems(ctx context.Context, db *sql.DB, subscriptionID int64) ([]models.CartItem, error) {
+	rows, err := db.QueryContext(ctx, "SELECT beer_id, quantity FROM subscription_items WHERE subscription_id = $1 ORDER BY beer_id", subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.CartItem
+	for rows.Next() {
+		var item models.CartItem
+		if err := rows.Scan(&item.BeerID, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении данных: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// SetSubscriptionStatus изменяет статус подписки пользователя.
+// При возобновлении подписки просроченная дата следующего заказа переносится на сутки вперед,
+// чтобы покупатель успел получить напоминание.
+func SetSubscriptionStatus(ctx context.Context, db *sql.DB, subscriptionID int64, userID int64, status string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE subscriptions SET
+			status = $3,
+			next_run_at = CASE WHEN $3 = 'active' THEN GREATEST(next_run_at, now() + interval '1 day') ELSE next_run_at END,
+			reminded = CASE WHEN $3 = 'active' THEN false ELSE reminded END
+		WHERE id = $1 AND user_id = $2 AND status <> 'cancelled'`, subscriptionID, userID, status)
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении статуса подписки: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении статуса подписки: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("подписка с ID %d не найдена", subscriptionID)
+	}
+	return nil
+}
+
+// MarkSubscriptionReminded отмечает, что покупателю отправлено напоминание о следующем заказе.
+func MarkSubscriptionReminded(ctx context.Context, db *sql.DB, subscriptionID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, "UPDATE subscriptions SET reminded = true WHERE id = $1", subscriptionID); err != nil {
+		return fmt.Errorf("ошибка при обновлении подписки: %w", err)
+	}
+	return nil
+}
+
+// ErrSubscriptionChanged возвращается RunSubscription, если подписку изменили после того,
+// как она была получена для исполнения (заказ уже оформлен, подписка приостановлена или отменена).
+var ErrSubscriptionChanged = errors.New("подписка изменена")
+
+// RunSubscription оформляет заказ items по подписке и в той же транзакции переносит следующий заказ
+// на nextRunAt, сбрасывая отметку о напоминании, поэтому заказ за один период не оформляется дважды.
+// Если items пуст, заказ не оформляется, а только переносится дата; тогда возвращается ID 0.
+// Возвращает *InsufficientStockError, если пива не хватает, и ErrSubscriptionChanged,
+// если дата следующего заказа или статус подписки уже не совпадают с subscription.
+func RunSubscription(ctx context.Context, db *sql.DB, subscription models.Subscription, items []models.CartItem, nextRunAt time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE subscriptions SET next_run_at = $3, reminded = false
+		WHERE id = $1 AND next_run_at = $2 AND status = 'active'`, subscription.ID, subscription.NextRunAt, nextRunAt)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при обновлении подписки: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return 0, fmt.Errorf("ошибка при обновлении подписки: %w", err)
+	} else if updated == 0 {
+		return 0, ErrSubscriptionChanged
+	}
+
+	var orderID int64
+	var total float64
+	if len(items) > 0 {
+		orderID, total, err = insertOrder(ctx, tx, subscription.UserID, items, fmt.Sprintf("subscription:%d", subscription.ID))
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("не удалось зафиксировать заказ по подписке: %w", err)
+	}
+	if orderID != 0 {
+		orderPlaced(ctx, orderID, len(items), total)
+	}
+	return orderID, nil
+}
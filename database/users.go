@@ -0,0 +1,91 @@
+package database
+
+import (
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UpsertUser сохраняет профиль пользователя Telegram и возвращает язык, на котором с ним нужно общаться:
+// выбранный командой /language, а если он не выбран - язык из профиля Telegram.
+// Новый пользователь получает время первого обращения, у существующего обновляются
+// имя, язык и время последнего обращения.
+func UpsertUser(ctx context.Context, db *sql.DB, user models.User) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	seenAt := user.LastSeenAt
+	if seenAt.IsZero() {
+		seenAt = time.Now()
+	}
+
+	var language string
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO users (id, username, first_name, last_name, language_code, first_seen_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			username = EXCLUDED.username,
+			first_name = EXCLUDED.first_name,
+			last_name = EXCLUDED.last_name,
+			language_code = EXCLUDED.language_code,
+			last_seen_at = EXCLUDED.last_seen_at
+		RETURNING COALESCE(language, language_code, '')`,
+		user.ID, user.Username, user.FirstName, user.LastName, user.LanguageCode, seenAt).Scan(&language)
+	if err != nil {
+		return "", fmt.Errorf("ошибка при сохранении пользователя: %w", err)
+	}
+	return language, nil
+}
+
+// GetUserLanguage возвращает язык пользователя: выбранный командой /language или язык из профиля Telegram.
+// Для неизвестного пользователя возвращает пустую строку.
+func GetUserLanguage(ctx context.Context, db *sql.DB, userID int64) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var language string
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(language, language_code, '') FROM users WHERE id = $1", userID).Scan(&language)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("ошибка при получении языка пользователя: %w", err)
+	}
+	return language, nil
+}
+
+// SetUserLanguage сохраняет язык, выбранный пользователем.
+func SetUserLanguage(ctx context.Context, db *sql.DB, userID int64, language string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, "UPDATE users SET language = $2 WHERE id = $1", userID, language); err != nil {
+		return fmt.Errorf("ошибка при сохранении языка пользователя: %w", err)
+	}
+	return nil
+}
+
+// GetUserByID получает профиль пользователя по его ID.
+func GetUserByID(ctx context.Context, db *sql.DB, userID int64) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	var username, firstName, lastName, languageCode, language sql.NullString
+	err := db.QueryRowContext(ctx, "SELECT id, username, first_name, last_name, language_code, language, first_seen_at, last_seen_at FROM users WHERE id = $1", userID).
+		Scan(&user.ID, &username, &firstName, &lastName, &languageCode, &language, &user.FirstSeenAt, &user.LastSeenAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка при получении пользователя по ID: %w", err)
+	}
+	user.Username = username.String
+	user.FirstName = firstName.String
+	user.LastName = lastName.String
+	user.LanguageCode = languageCode.String
+	user.Language = language.String
+	return &user, nil
+}
@@ -0,0 +1,211 @@
+// Package health отслеживает состояние фоновых задач бота и отдает результаты проверок
+// по HTTP в формате JSON: /healthz (бот жив) и /readyz (бот готов обслуживать пользователей).
+//
+// Фоновые задачи регистрируются функцией NewJob и сообщают о каждом выполнении;
+// дополнительные проверки (например, соединение с базой данных) добавляются функцией AddCheck.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kind - вид проверки.
+type Kind int
+
+const (
+	// Liveness - проверка того, что бот жив; при ее провале процесс нужно перезапустить.
+	Liveness Kind = iota
+	// Readiness - проверка того, что бот может обслуживать пользователей (например, доступна база данных).
+	Readiness
+)
+
+// checkTimeout - время, отведенное на одну проверку.
+const checkTimeout = 2 * time.Second
+
+// Check выполняет проверку и возвращает дополнительные сведения для отчета (могут быть nil)
+// и ошибку, если проверка не пройдена.
+type Check func(ctx context.Context) (map[string]any, error)
+
+type namedCheck struct {
+	name  string
+	kind  Kind
+	check Check
+}
+
+var (
+	mu     sync.Mutex
+	checks []namedCheck
+	jobs   = make(map[string]*Job)
+)
+
+// AddCheck регистрирует проверку name вида kind. Проверки Liveness выполняются и в /readyz.
+func AddCheck(kind Kind, name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks = append(checks, namedCheck{name: name, kind: kind, check: check})
+}
+
+// Job - состояние фоновой задачи, которая выполняется периодически.
+type Job struct {
+	name     string
+	interval time.Duration // Период выполнения; 0 - задача работает непрерывно и не сообщает о выполнениях
+
+	mu          sync.Mutex
+	startedAt   time.Time
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+	stopped     bool
+}
+
+// NewJob регистрирует фоновую задачу name, которая выполняется раз в interval.
+// Задача, зарегистрированная повторно с тем же именем (после перезапуска), заменяет прежнюю.
+func NewJob(name string, interval time.Duration) *Job {
+	job := &Job{name: name, interval: interval, startedAt: time.Now()}
+	mu.Lock()
+	jobs[name] = job
+	mu.Unlock()
+	return job
+}
+
+// Succeeded отмечает успешное выполнение задачи.
+func (j *Job) Succeeded() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.lastRun = time.Now()
+	j.lastSuccess = j.lastRun
+}
+
+// Failed отмечает выполнение задачи, завершившееся ошибкой err.
+func (j *Job) Failed(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.lastRun = time.Now()
+	j.lastErrorAt = j.lastRun
+	j.lastError = err.Error()
+}
+
+// Stopped отмечает остановку задачи.
+func (j *Job) Stopped() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stopped = true
+}
+
+// SinceSuccess возвращает время с последнего успешного выполнения задачи;
+// ok равно false, если задача еще ни разу не выполнилась успешно.
+func (j *Job) SinceSuccess() (since time.Duration, ok bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.lastSuccess.IsZero() {
+		return 0, false
+	}
+	return time.Since(j.lastSuccess), true
+}
+
+// report возвращает состояние задачи для отчета и признак того, что задача работает:
+// не остановлена и выполнялась не реже, чем раз в два периода.
+func (j *Job) report() (map[string]any, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	report := map[string]any{"state": "running"}
+	alive := true
+	lastRun := j.lastRun
+	if lastRun.IsZero() {
+		lastRun = j.startedAt
+	}
+	switch {
+	case j.stopped:
+		report["state"], alive = "stopped", false
+	case j.interval > 0 && time.Since(lastRun) > 2*j.interval:
+		report["state"], alive = "stuck", false
+	case !j.lastErrorAt.IsZero() && j.lastErrorAt.After(j.lastSuccess):
+		report["state"] = "failing"
+	}
+
+	if j.interval > 0 {
+		report["interval_seconds"] = j.interval.Seconds()
+	}
+	if !j.lastSuccess.IsZero() {
+		report["last_success"] = j.lastSuccess
+		report["seconds_since_success"] = time.Since(j.lastSuccess).Seconds()
+	}
+	if j.lastError != "" {
+		report["last_error"] = j.lastError
+		report["last_error_at"] = j.lastErrorAt
+	}
+	return report, alive
+}
+
+// Report - ответ /healthz и /readyz.
+type Report struct {
+	Status string                    `json:"status"` // "ok" или "fail"
+	Checks map[string]map[string]any `json:"checks"` // Результаты проверок по имени
+	Jobs   map[string]map[string]any `json:"jobs"`   // Состояние фоновых задач по имени
+}
+
+// Run выполняет проверки вида kind (для Readiness - также проверки Liveness) и собирает отчет.
+// Отчет считается неуспешным, если не пройдена хотя бы одна проверка или какая-либо задача
+// остановлена или зависла.
+func Run(ctx context.Context, kind Kind) Report {
+	mu.Lock()
+	selected := make([]namedCheck, 0, len(checks))
+	for _, c := range checks {
+		if c.kind <= kind {
+			selected = append(selected, c)
+		}
+	}
+	jobList := make([]*Job, 0, len(jobs))
+	for _, job := range jobs {
+		jobList = append(jobList, job)
+	}
+	mu.Unlock()
+	sort.Slice(jobList, func(i, j int) bool { return jobList[i].name < jobList[j].name })
+
+	report := Report{Status: "ok", Checks: make(map[string]map[string]any), Jobs: make(map[string]map[string]any)}
+	for _, c := range selected {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		details, err := c.check(checkCtx)
+		cancel()
+
+		result := map[string]any{"status": "ok"}
+		for key, value := range details {
+			result[key] = value
+		}
+		if err != nil {
+			result["status"], result["error"] = "fail", err.Error()
+			report.Status = "fail"
+		}
+		report.Checks[c.name] = result
+	}
+	for _, job := range jobList {
+		result, alive := job.report()
+		result["status"] = "ok"
+		if !alive {
+			result["status"] = "fail"
+			report.Status = "fail"
+		}
+		report.Jobs[job.name] = result
+	}
+	return report
+}
+
+// Handler возвращает HTTP-обработчик, выполняющий проверки вида kind.
+// При успехе отвечает 200, иначе 503; тело ответа - Report в формате JSON.
+func Handler(kind Kind) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := Run(r.Context(), kind)
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,186 @@
+// Package i18n содержит каталоги сообщений бота и выбирает перевод с учетом языка и формы множественного числа.
+//
+// Каталоги хранятся в файлах locales/<язык>.json. Значение ключа - либо строка, либо объект
+// с формами множественного числа (one, few, many, other). В строках используются плейсхолдеры
+// пакета fmt; для перестановки аргументов в переводе применяются явные индексы (%[2]s).
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultLanguage - язык, используемый, если язык пользователя не поддерживается.
+const DefaultLanguage = "ru"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// message - запись каталога: обычная строка или набор форм множественного числа.
+type message struct {
+	text   string
+	plural map[string]string
+}
+
+// UnmarshalJSON разбирает запись каталога из строки или объекта с формами множественного числа.
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &m.plural)
+}
+
+// catalogs содержит каталоги сообщений по кодам языков.
+var catalogs = loadCatalogs()
+
+// loadCatalogs загружает встроенные каталоги сообщений. Ошибка в каталоге - ошибка сборки,
+// поэтому функция завершает программу с panic.
+func loadCatalogs() map[string]map[string]message {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("i18n: не удалось прочитать каталоги сообщений: %v", err))
+	}
+
+	loaded := make(map[string]map[string]message, len(entries))
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("i18n: не удалось прочитать %s: %v", entry.Name(), err))
+		}
+		var catalog map[string]message
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("i18n: ошибка в каталоге %s: %v", entry.Name(), err))
+		}
+		loaded[strings.TrimSuffix(entry.Name(), ".json")] = catalog
+	}
+	return loaded
+}
+
+// Languages возвращает коды поддерживаемых языков в алфавитном порядке.
+func Languages() []string {
+	languages := make([]string, 0, len(catalogs))
+	for language := range catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Normalize приводит код языка Telegram (например, "en-US") к поддерживаемому языку.
+// Для неподдерживаемых и пустых кодов возвращает DefaultLanguage.
+func Normalize(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if _, ok := catalogs[code]; ok {
+		return code
+	}
+	return DefaultLanguage
+}
+
+// Match проверяет, совпадает ли text с переводом key на любом из поддерживаемых языков.
+// Используется для распознавания нажатий на кнопки обычной клавиатуры.
+func Match(text, key string) bool {
+	for _, catalog := range catalogs {
+		if msg, ok := catalog[key]; ok && msg.text == text {
+			return true
+		}
+	}
+	return false
+}
+
+// Localizer переводит сообщения на выбранный язык.
+type Localizer struct {
+	lang string
+}
+
+// New создает Localizer для кода языка. Неподдерживаемые языки заменяются на DefaultLanguage.
+func New(code string) Localizer {
+	return Localizer{lang: Normalize(code)}
+}
+
+// Lang возвращает код языка Localizer.
+func (l Localizer) Lang() string {
+	if l.lang == "" {
+		return DefaultLanguage
+	}
+	return l.lang
+}
+
+// T возвращает перевод сообщения key, подставляя args в плейсхолдеры.
+// Если перевода нет, используется DefaultLanguage, а затем сам ключ.
+func (l Localizer) T(key string, args ...any) string {
+	msg, ok := l.lookup(key)
+	if !ok {
+		return key
+	}
+	text := msg.text
+	if msg.plural != nil {
+		text = msg.plural["other"]
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// N возвращает перевод сообщения key в форме множественного числа для n.
+// Число n передается в плейсхолдеры первым аргументом, за ним следуют args.
+func (l Localizer) N(key string, n int, args ...any) string {
+	msg, ok := l.lookup(key)
+	if !ok {
+		return key
+	}
+	text := msg.text
+	if msg.plural != nil {
+		text = selectPluralForm(msg.plural, pluralCategory(l.Lang(), n))
+	}
+	return fmt.Sprintf(text, append([]any{n}, args...)...)
+}
+
+// lookup ищет сообщение в каталоге языка Localizer, а затем в каталоге DefaultLanguage.
+func (l Localizer) lookup(key string) (message, bool) {
+	if msg, ok := catalogs[l.Lang()][key]; ok {
+		return msg, true
+	}
+	msg, ok := catalogs[DefaultLanguage][key]
+	return msg, ok
+}
+
+// pluralCategory возвращает категорию множественного числа CLDR для n в языке lang.
+func pluralCategory(lang string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	switch lang {
+	case "ru":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+// selectPluralForm выбирает форму сообщения для категории, используя other и many как запасные варианты.
+func selectPluralForm(forms map[string]string, category string) string {
+	for _, candidate := range []string{category, "other", "many"} {
+		if form, ok := forms[candidate]; ok {
+			return form
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+// Package logging настраивает структурированный журнал бота (log/slog в формате JSON)
+// и передает логгер, привязанный к обновлению Telegram, через context.Context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Имена атрибутов, по которым записи журнала связываются с обновлением Telegram.
+const (
+	UpdateID = "update_id" // ID обновления Telegram
+	ChatID   = "chat_id"   // ID чата, из которого пришло обновление
+	UserID   = "user_id"   // ID пользователя Telegram
+	Handler  = "handler"   // Обработчик обновления (команда, действие кнопки или тип сообщения)
+	OrderID  = "order_id"  // ID заказа, с которым работает обработчик
+	Error    = "error"     // Текст ошибки
+)
+
+// New создает логгер, который пишет записи уровня level и выше в w в формате JSON.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		AddSource: true,
+		Level:     level,
+	}))
+}
+
+// ParseLevel разбирает уровень журнала: debug, info, warn или error (без учета регистра).
+// Пустая строка означает info.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if strings.TrimSpace(s) == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("неизвестный уровень журнала %q: ожидается debug, info, warn или error", s)
+	}
+	return level, nil
+}
+
+type contextKey struct{}
+
+// NewContext возвращает копию ctx, содержащую логгер logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext возвращает логгер из ctx, а если его нет - логгер по умолчанию (slog.Default).
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
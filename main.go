@@ -1,26 +1,142 @@
 package main
 
 import (
+	"beer_from_the_brewery/api"
+	"beer_from_the_brewery/config"
 	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/health"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/metrics"
 	"beer_from_the_brewery/telegram"
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	_ "github.com/lib/pq" // Инициализация драйвера PostgreSQL
 )
 
 func main() {
-	// Создаем логгер, который пишет в stderr
-	logger := log.New(os.Stderr, "beer_bot: ", log.LstdFlags|log.Lshortfile)
+	os.Exit(run())
+}
+
+// run запускает бота и возвращает код завершения процесса: 0 - бот остановлен сигналом
+// SIGINT или SIGTERM без ошибок, 1 - бот не удалось запустить или остановить,
+// 2 - некорректные настройки. Если после флагов указана команда обслуживания (см. commands.go),
+// вместо запуска бота выполняется она. Отложенные вызовы (закрытие базы данных) выполняются
+// до выхода из процесса.
+func run() int {
+	// Загружаем настройки из флагов, переменных окружения и файла .env
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		printCommands(os.Stderr)
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// Аргументы после флагов - команда обслуживания, которая выполняется вместо запуска бота
+	var cmd command
+	var cmdArgs []string
+	if len(cfg.Command) > 0 {
+		var ok bool
+		if cmd, cmdArgs, ok = findCommand(cfg.Command); !ok {
+			fmt.Fprintf(os.Stderr, "неизвестная команда: %s\n", strings.Join(cfg.Command, " "))
+			printCommands(os.Stderr)
+			return 2
+		}
+	}
+
+	// Создаем логгер, который пишет в stderr записи в формате JSON
+	logger := logging.New(os.Stderr, cfg.LogLevel)
+	slog.SetDefault(logger)
+
+	// Корневой контекст отменяется при получении SIGINT или SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Подключаемся к базе данных
-	db, err := database.ConnectToDatabase()
+	db, err := database.ConnectToDatabase(ctx, cfg.Database)
 	if err != nil {
-		logger.Fatalf("Ошибка при подключении к базе данных: %v", err) // Fatalf завершает программу
+		logger.Error("Ошибка при подключении к базе данных", logging.Error, err)
+		return 1
 	}
-	defer db.Close() // Отложенное закрытие соединения с базой данных.
+	// Соединение с базой данных закрывается последним, после остановки бота
+	defer func() {
+		if err := db.Close(); err != nil {
+			logger.Error("Ошибка при закрытии соединения с базой данных", logging.Error, err)
+		}
+	}()
 
-	logger.Println("Успешное подключение к базе данных!")
+	logger.Info("Успешное подключение к базе данных")
 
-	telegram.StartBot(db, logger) // Передаем логгер в StartBot
+	// Приводим схему базы данных к актуальному виду
+	if err := database.MigrateSchema(ctx, db); err != nil {
+		logger.Error("Ошибка при обновлении схемы базы данных", logging.Error, err)
+		return 1
+	}
+	if len(cfg.Command) > 0 {
+		return runCommand(ctx, cmd, cmdArgs, cfg, db)
+	}
+
+	// Проверяем соединение с базой данных при каждом запросе /healthz и /readyz:
+	// без базы данных бот не может обслуживать пользователей
+	health.AddCheck(health.Liveness, "database", func(ctx context.Context) (map[string]any, error) {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		start := time.Now()
+		err := db.PingContext(ctx)
+		return map[string]any{"latency_ms": time.Since(start).Milliseconds()}, err
+	})
+
+	// Запускаем служебный HTTP-сервер с метриками Prometheus, проверками состояния и API администрирования
+	// (если заданы ключи API), если задан его адрес.
+	// Если сервер не удалось запустить, бот останавливается с ошибкой.
+	failed := make(chan struct{})
+	if addr := cfg.HTTPAddr; addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		mux.Handle("GET /healthz", health.Handler(health.Liveness))
+		mux.Handle("GET /readyz", health.Handler(health.Readiness))
+		if len(cfg.APIKeys) > 0 {
+			mux.Handle("/api/", api.Handler(db, cfg.APIKeys, logger))
+			logger.Info("API администрирования включено", "clients", len(cfg.APIKeys))
+		}
+		server := &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			logger.Info("HTTP-сервер запущен", "addr", addr)
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Ошибка HTTP-сервера", logging.Error, err)
+				close(failed)
+				stop()
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				logger.Error("Ошибка при остановке HTTP-сервера", logging.Error, err)
+			}
+		}()
+	}
+
+	if err := telegram.StartBot(ctx, cfg, db, logger); err != nil { // Передаем контекст и логгер в StartBot
+		logger.Error("Ошибка работы бота", logging.Error, err)
+		return 1
+	}
+	select {
+	case <-failed:
+		return 1
+	default:
+	}
+	return 0
 }
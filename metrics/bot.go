@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Метрики бота. Метрики очереди исходящих сообщений регистрируются при запуске бота (см. telegram.StartBot).
+var (
+	Updates = NewCounterVec("beer_bot_updates_total",
+		"Обработанные обновления Telegram по типу и обработчику.", "type", "handler")
+	HandlerDuration = NewHistogramVec("beer_bot_handler_duration_seconds",
+		"Время обработки обновления в секундах.", DefaultBuckets, "handler")
+
+	DBQueryDuration = NewHistogramVec("beer_bot_db_query_duration_seconds",
+		"Время выполнения запросов к базе данных в секундах по виду запроса.", DefaultBuckets, "operation")
+	DBQueryErrors = NewCounterVec("beer_bot_db_query_errors_total",
+		"Запросы к базе данных, завершившиеся ошибкой, по виду запроса.", "operation")
+
+	CartAdditions = NewCounter("beer_bot_cart_additions_total",
+		"Добавления пива в корзину.")
+	Checkouts = NewCounter("beer_bot_checkouts_total",
+		"Оформленные заказы (из корзины и по подпискам).")
+	OrderTotals = NewHistogram("beer_bot_order_total",
+		"Суммы оформленных заказов.", []float64{250, 500, 1000, 2000, 3000, 5000, 10000, 20000})
+	OrderStatusChanges = NewCounterVec("beer_bot_order_status_changes_total",
+		"Изменения статуса заказов по новому статусу.", "status")
+
+	CatalogUpdates = NewCounterVec("beer_bot_catalog_updates_total",
+		"Обновления каталога пива: полные перезагрузки (reload) и пиво, обновленное по уведомлениям базы данных (notify).", "source")
+)
+
+// catalogRefreshedAt - время последнего успешного обновления каталога (Unix, в наносекундах).
+var catalogRefreshedAt atomic.Int64
+
+func init() {
+	NewGaugeFunc("beer_bot_catalog_refresh_age_seconds",
+		"Время в секундах с последнего успешного обновления каталога пива (-1, если каталог еще не загружен).",
+		func() float64 {
+			age, ok := CatalogAge()
+			if !ok {
+				return -1
+			}
+			return age.Seconds()
+		})
+}
+
+// CatalogRefreshed отмечает успешное обновление каталога пива.
+func CatalogRefreshed() {
+	catalogRefreshedAt.Store(time.Now().UnixNano())
+}
+
+// CatalogAge возвращает время с последнего успешного обновления каталога;
+// ok равно false, если каталог еще не загружался.
+func CatalogAge() (age time.Duration, ok bool) {
+	refreshedAt := catalogRefreshedAt.Load()
+	if refreshedAt == 0 {
+		return 0, false
+	}
+	return time.Since(time.Unix(0, refreshedAt)), true
+}
@@ -0,0 +1,352 @@
+// Package metrics содержит счетчики, измерители и гистограммы работы бота и отдает их
+// в текстовом формате Prometheus (https://prometheus.io/docs/instrumenting/exposition_formats/).
+//
+// Метрики создаются функциями New* и сразу регистрируются; Handler отдает все
+// зарегистрированные метрики, например по адресу /metrics.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets - границы гистограмм длительности по умолчанию (в секундах).
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric - метрика, которую можно записать в формате Prometheus.
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      []metric
+)
+
+// register добавляет метрику в реестр. Повторная регистрация имени - ошибка программиста.
+func register(m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	for _, existing := range registry {
+		if existing.name() == m.name() {
+			panic("metrics: метрика " + m.name() + " уже зарегистрирована")
+		}
+	}
+	registry = append(registry, m)
+}
+
+// Write записывает все зарегистрированные метрики в w в текстовом формате Prometheus.
+func Write(w io.Writer) error {
+	registryMutex.Lock()
+	metrics := append([]metric(nil), registry...)
+	registryMutex.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+	buf := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(buf)
+	}
+	return buf.Flush()
+}
+
+// Handler возвращает HTTP-обработчик, отдающий метрики.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// desc - имя, описание и имена меток метрики.
+type desc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (d desc) name() string { return d.metricName }
+
+// writeHeader записывает строки HELP и TYPE метрики.
+func (d desc) writeHeader(w *bufio.Writer, kind string) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, help, d.metricName, kind)
+}
+
+// float - число с плавающей точкой, изменяемое атомарно.
+type float struct {
+	bits atomic.Uint64
+}
+
+func (f *float) add(v float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (f *float) set(v float64) { f.bits.Store(math.Float64bits(v)) }
+
+func (f *float) load() float64 { return math.Float64frombits(f.bits.Load()) }
+
+// Counter - монотонно растущий счетчик.
+type Counter struct {
+	value float
+}
+
+// Inc увеличивает счетчик на 1.
+func (c *Counter) Inc() { c.value.add(1) }
+
+// Add увеличивает счетчик на v (v не может быть отрицательным).
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: счетчик нельзя уменьшать")
+	}
+	c.value.add(v)
+}
+
+// Gauge - значение, которое может как расти, так и уменьшаться.
+type Gauge struct {
+	value float
+}
+
+// Set устанавливает значение.
+func (g *Gauge) Set(v float64) { g.value.set(v) }
+
+// Add изменяет значение на v.
+func (g *Gauge) Add(v float64) { g.value.add(v) }
+
+// Histogram подсчитывает наблюдения по интервалам (bucket) и их сумму.
+type Histogram struct {
+	buckets []float64 // Верхние границы интервалов по возрастанию (без +Inf)
+
+	mu     sync.Mutex
+	counts []uint64 // Наблюдений в каждом интервале (не накопительно); последний элемент - +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+// Observe добавляет наблюдение v.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v) // Первая граница >= v
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// vec хранит дочерние метрики по значениям меток.
+type vec[T any] struct {
+	desc
+	newChild func() *T
+
+	mu       sync.Mutex
+	children map[string]*T
+	values   map[string][]string
+}
+
+func newVec[T any](d desc, newChild func() *T) *vec[T] {
+	return &vec[T]{desc: d, newChild: newChild, children: make(map[string]*T), values: make(map[string][]string)}
+}
+
+// with возвращает дочернюю метрику для значений меток, создавая ее при первом обращении.
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: метрика %s ожидает %d меток, передано %d", v.metricName, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	child, ok := v.children[key]
+	if !ok {
+		child = v.newChild()
+		v.children[key] = child
+		v.values[key] = append([]string(nil), values...)
+	}
+	return child
+}
+
+// each вызывает fn для дочерних метрик в порядке значений меток.
+func (v *vec[T]) each(fn func(labels string, child *T)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	v.mu.Unlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v.mu.Lock()
+		child, values := v.children[key], v.values[key]
+		v.mu.Unlock()
+		fn(formatLabels(v.labels, values), child)
+	}
+}
+
+// CounterVec - счетчики с метками.
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// NewCounterVec создает и регистрирует счетчик с метками labels.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(desc{name, help, labels}, func() *Counter { return &Counter{} })}
+	register(c)
+	return c
+}
+
+// With возвращает счетчик для значений меток (в порядке, заданном при создании).
+func (c *CounterVec) With(values ...string) *Counter { return c.with(values) }
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w, "counter")
+	c.each(func(labels string, counter *Counter) {
+		writeSample(w, c.metricName, labels, counter.value.load())
+	})
+}
+
+// NewCounter создает и регистрирует счетчик без меток.
+func NewCounter(name, help string) *Counter {
+	c := NewCounterVec(name, help)
+	return c.With()
+}
+
+// HistogramVec - гистограммы с метками.
+type HistogramVec struct {
+	*vec[Histogram]
+}
+
+// NewHistogramVec создает и регистрирует гистограмму с границами интервалов buckets и метками labels.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{newVec(desc{name, help, labels}, func() *Histogram { return newHistogram(buckets) })}
+	register(h)
+	return h
+}
+
+// With возвращает гистограмму для значений меток (в порядке, заданном при создании).
+func (h *HistogramVec) With(values ...string) *Histogram { return h.with(values) }
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w, "histogram")
+	h.each(func(labels string, histogram *Histogram) {
+		histogram.mu.Lock()
+		counts := append([]uint64(nil), histogram.counts...)
+		sum, count := histogram.sum, histogram.count
+		histogram.mu.Unlock()
+
+		var cumulative uint64
+		for i, upper := range histogram.buckets {
+			cumulative += counts[i]
+			writeSample(w, h.metricName+"_bucket", joinLabels(labels, `le="`+formatFloat(upper)+`"`), float64(cumulative))
+		}
+		writeSample(w, h.metricName+"_bucket", joinLabels(labels, `le="+Inf"`), float64(count))
+		writeSample(w, h.metricName+"_sum", labels, sum)
+		writeSample(w, h.metricName+"_count", labels, float64(count))
+	})
+}
+
+// NewHistogram создает и регистрирует гистограмму без меток.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return NewHistogramVec(name, help, buckets).With()
+}
+
+// gaugeMetric - измеритель без меток.
+type gaugeMetric struct {
+	desc
+	gauge *Gauge
+}
+
+// NewGauge создает и регистрирует измеритель без меток.
+func NewGauge(name, help string) *Gauge {
+	g := &gaugeMetric{desc: desc{metricName: name, help: help}, gauge: &Gauge{}}
+	register(g)
+	return g.gauge
+}
+
+func (g *gaugeMetric) write(w *bufio.Writer) {
+	g.writeHeader(w, "gauge")
+	writeSample(w, g.metricName, "", g.gauge.value.load())
+}
+
+// funcMetric - метрика, значение которой вычисляется при каждом чтении.
+type funcMetric struct {
+	desc
+	kind string
+	fn   func() float64
+}
+
+// NewGaugeFunc регистрирует измеритель, значение которого возвращает fn.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&funcMetric{desc: desc{metricName: name, help: help}, kind: "gauge", fn: fn})
+}
+
+// NewCounterFunc регистрирует счетчик, значение которого возвращает fn
+// (например, счетчик, который ведет другой пакет).
+func NewCounterFunc(name, help string, fn func() float64) {
+	register(&funcMetric{desc: desc{metricName: name, help: help}, kind: "counter", fn: fn})
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	f.writeHeader(w, f.kind)
+	writeSample(w, f.metricName, "", f.fn())
+}
+
+// writeSample записывает строку значения метрики.
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+// formatLabels формирует список меток name="value" с экранированием значений.
+func formatLabels(names, values []string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escape.Replace(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+// joinLabels добавляет к списку меток labels метку extra.
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+// formatFloat записывает число так, как его ожидает Prometheus.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
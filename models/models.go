@@ -1,14 +1,18 @@
 package models
 
+import "time"
+
 // Beer представляет информацию о пиве.
 type Beer struct {
-	ID          int     `json:"id"`          // Уникальный идентификатор пива.
-	Name        string  `json:"name"`        // Название пива.
-	Description string  `json:"description"` // Описание пива.
-	Price       float64 `json:"price"`       // Цена пива.
-	Quantity    int     `json:"quantity"`    // Количество пива в наличии.
-	ImageURL    string  `json:"image_url"`   // URL изображения пива.
-	Type        string  `json:"type"`        // Тип пива (например, "Лагер", "Стаут" и т.д.).
+	ID          int     `json:"id"`           // Уникальный идентификатор пива.
+	Name        string  `json:"name"`         // Название пива.
+	Description string  `json:"description"`  // Описание пива.
+	Price       float64 `json:"price"`        // Цена пива.
+	Quantity    int     `json:"quantity"`     // Количество пива в наличии.
+	ImageURL    string  `json:"image_url"`    // URL изображения пива.
+	Type        string  `json:"type"`         // Тип пива (например, "Лагер", "Стаут" и т.д.).
+	Rating      float64 `json:"rating"`       // Средняя оценка покупателей (0, если оценок нет).
+	RatingCount int     `json:"rating_count"` // Количество опубликованных оценок.
 }
 
 // CartItem представляет элемент в корзине пользователя.
@@ -16,3 +20,141 @@ type CartItem struct {
 	BeerID   int `json:"beer_id"`  // ID пива в корзине.
 	Quantity int `json:"quantity"` // Количество пива в корзине.
 }
+
+// User представляет пользователя Telegram, взаимодействовавшего с ботом.
+type User struct {
+	ID           int64     `json:"id"`            // Идентификатор пользователя в Telegram.
+	Username     string    `json:"username"`      // Имя пользователя в Telegram (без @).
+	FirstName    string    `json:"first_name"`    // Имя пользователя.
+	LastName     string    `json:"last_name"`     // Фамилия пользователя.
+	LanguageCode string    `json:"language_code"` // Код языка из профиля Telegram.
+	Language     string    `json:"language"`      // Язык, выбранный пользователем командой /language.
+	FirstSeenAt  time.Time `json:"first_seen_at"` // Время первого обращения к боту.
+	LastSeenAt   time.Time `json:"last_seen_at"`  // Время последнего обращения к боту.
+}
+
+// Order представляет заказ вместе с информацией о покупателе.
+type Order struct {
+	ID        int64     `json:"id"`         // Уникальный идентификатор заказа.
+	UserID    int64     `json:"user_id"`    // Идентификатор пользователя, сделавшего заказ.
+	OrderDate time.Time `json:"order_date"` // Дата и время заказа.
+	Status    string    `json:"status"`     // Статус заказа.
+	Total     float64   `json:"total"`      // Сумма заказа по ценам на момент оформления.
+	Customer  User      `json:"customer"`   // Покупатель.
+}
+
+// Статусы заказа. Разрешенные переходы между ними проверяет database.ChangeOrderStatus.
+const (
+	OrderNew       = "new"       // Заказ оформлен покупателем.
+	OrderConfirmed = "confirmed" // Заказ подтвержден магазином.
+	OrderPacking   = "packing"   // Заказ собирается.
+	OrderReady     = "ready"     // Заказ собран и готов к отправке или самовывозу.
+	OrderShipped   = "shipped"   // Заказ передан в доставку.
+	OrderDelivered = "delivered" // Заказ получен покупателем.
+	OrderCancelled = "cancelled" // Заказ отменен до получения, пиво возвращено на остаток.
+	OrderRefunded  = "refunded"  // Деньги за полученный заказ возвращены.
+)
+
+// OrderStatuses - все статусы заказа в порядке обработки.
+var OrderStatuses = []string{OrderNew, OrderConfirmed, OrderPacking, OrderReady, OrderShipped, OrderDelivered, OrderCancelled, OrderRefunded}
+
+// OrderStatusChange представляет изменение статуса заказа.
+type OrderStatusChange struct {
+	OrderID   int64     `json:"order_id"`   // Идентификатор заказа.
+	UserID    int64     `json:"user_id"`    // Идентификатор покупателя.
+	From      string    `json:"from"`       // Прежний статус (пустой при оформлении заказа).
+	To        string    `json:"to"`         // Новый статус.
+	ChangedBy string    `json:"changed_by"` // Кто изменил статус, например "telegram:<ID пользователя>" или "api:<клиент>".
+	ChangedAt time.Time `json:"changed_at"` // Время изменения.
+}
+
+// OrderItem представляет позицию оформленного заказа.
+type OrderItem struct {
+	BeerID   int     `json:"beer_id"`  // ID пива.
+	Quantity int     `json:"quantity"` // Количество пива в заказе.
+	Price    float64 `json:"price"`    // Цена за единицу на момент оформления (0, если неизвестна).
+}
+
+// Review представляет оценку и отзыв покупателя о пиве.
+type Review struct {
+	ID         int64     `json:"id"`          // Уникальный идентификатор отзыва.
+	UserID     int64     `json:"user_id"`     // Идентификатор автора отзыва.
+	BeerID     int       `json:"beer_id"`     // Идентификатор пива.
+	OrderID    int64     `json:"order_id"`    // Идентификатор заказа, после которого оставлен отзыв.
+	Rating     int       `json:"rating"`      // Оценка от 1 до 5.
+	Text       string    `json:"text"`        // Текст отзыва (может быть пустым).
+	Hidden     bool      `json:"hidden"`      // Скрыт ли отзыв модератором.
+	CreatedAt  time.Time `json:"created_at"`  // Время создания отзыва.
+	AuthorName string    `json:"author_name"` // Имя автора отзыва.
+	BeerName   string    `json:"beer_name"`   // Название пива.
+}
+
+// Статусы подписки на регулярные заказы.
+const (
+	SubscriptionActive    = "active"    // Заказы оформляются по расписанию.
+	SubscriptionPaused    = "paused"    // Заказы временно не оформляются.
+	SubscriptionCancelled = "cancelled" // Подписка отменена.
+)
+
+// Subscription представляет подписку на регулярный заказ.
+type Subscription struct {
+	ID            int64      `json:"id"`             // Уникальный идентификатор подписки.
+	UserID        int64      `json:"user_id"`        // Идентификатор пользователя.
+	FrequencyDays int        `json:"frequency_days"` // Периодичность заказа в днях.
+	NextRunAt     time.Time  `json:"next_run_at"`    // Дата и время следующего заказа.
+	Status        string     `json:"status"`         // Статус подписки.
+	Reminded      bool       `json:"reminded"`       // Отправлено ли напоминание о следующем заказе.
+	Items         []CartItem `json:"items"`          // Шаблон корзины.
+}
+
+// Статусы рассылки.
+const (
+	BroadcastSending   = "sending"   // Рассылка отправляется.
+	BroadcastFinished  = "finished"  // Рассылка отправлена всем получателям.
+	BroadcastCancelled = "cancelled" // Рассылка остановлена администратором.
+)
+
+// Статусы доставки рассылки получателю.
+const (
+	DeliveryPending = "pending" // Сообщение еще не отправлено.
+	DeliverySent    = "sent"    // Сообщение доставлено.
+	DeliveryFailed  = "failed"  // Сообщение не удалось доставить.
+	DeliverySkipped = "skipped" // Получатель отписался от рассылок до отправки.
+)
+
+// BroadcastButton представляет кнопку под сообщением рассылки: ссылку или добавление пива в корзину.
+type BroadcastButton struct {
+	Text   string `json:"text"`              // Текст кнопки.
+	URL    string `json:"url,omitempty"`     // Ссылка (для кнопки-ссылки).
+	BeerID int    `json:"beer_id,omitempty"` // Идентификатор пива (для кнопки добавления в корзину).
+}
+
+// Broadcast представляет рассылку администратора покупателям.
+type Broadcast struct {
+	ID          int64             `json:"id"`            // Уникальный идентификатор рассылки.
+	AuthorID    int64             `json:"author_id"`     // Идентификатор администратора, создавшего рассылку.
+	Text        string            `json:"text"`          // Текст сообщения или подпись к фото.
+	PhotoFileID string            `json:"photo_file_id"` // Идентификатор фото в Telegram (пустой, если фото нет).
+	Buttons     []BroadcastButton `json:"buttons"`       // Кнопки под сообщением.
+	BeerType    string            `json:"beer_type"`     // Сегмент: покупатели пива этого типа (пустой - все пользователи).
+	Status      string            `json:"status"`        // Статус рассылки.
+	CreatedAt   time.Time         `json:"created_at"`    // Время создания рассылки.
+}
+
+// BroadcastStats содержит итоги доставки рассылки.
+type BroadcastStats struct {
+	Total   int `json:"total"`   // Всего получателей.
+	Sent    int `json:"sent"`    // Доставлено.
+	Failed  int `json:"failed"`  // Не доставлено.
+	Skipped int `json:"skipped"` // Пропущено: получатель отписался.
+	Pending int `json:"pending"` // Ожидают отправки.
+}
+
+// BroadcastDelivery содержит результат доставки рассылки одному получателю.
+type BroadcastDelivery struct {
+	UserID   int64      `json:"user_id"`  // Идентификатор получателя.
+	Status   string     `json:"status"`   // Статус доставки.
+	Error    string     `json:"error"`    // Текст ошибки (для недоставленных).
+	Attempts int        `json:"attempts"` // Количество попыток отправки.
+	SentAt   *time.Time `json:"sent_at"`  // Время доставки.
+}
@@ -0,0 +1,408 @@
+// Package outbox содержит очередь исходящих запросов к Telegram Bot API с ограничением частоты.
+//
+// Очередь соблюдает общий лимит бота и лимит на каждый чат, сохраняет порядок сообщений
+// внутри чата, повторяет запросы после ответа 429 (с учетом retry_after) и временных ошибок
+// с экспоненциальной задержкой и сообщает отправителю результат доставки.
+package outbox
+
+import (
+	"beer_from_the_brewery/health"
+	"beer_from_the_brewery/logging"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// ErrStopped возвращается для запросов, которые не были отправлены из-за остановки очереди.
+var ErrStopped = errors.New("очередь исходящих сообщений остановлена")
+
+// Sender отправляет запрос в Telegram. Реализуется *tgbotapi.BotAPI.
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
+// Priority - приоритет запроса в очереди.
+type Priority int
+
+const (
+	// Interactive - ответы пользователю; отправляются раньше массовых рассылок.
+	Interactive Priority = iota
+	// Bulk - массовые рассылки и уведомления, которые могут подождать.
+	Bulk
+)
+
+// Options задает лимиты и политику повторов очереди.
+type Options struct {
+	GlobalRate  float64       // Сообщений в секунду для всего бота
+	GlobalBurst int           // Допустимый всплеск сверх GlobalRate
+	ChatRate    float64       // Сообщений в секунду в один чат
+	ChatBurst   int           // Допустимый всплеск в один чат
+	MaxAttempts int           // Максимальное число попыток отправки запроса
+	BaseBackoff time.Duration // Задержка перед первым повтором после временной ошибки
+	MaxBackoff  time.Duration // Максимальная задержка между повторами
+}
+
+// DefaultOptions возвращает лимиты, рекомендованные Telegram: не более 30 сообщений в секунду
+// для бота и около одного сообщения в секунду в один чат (короткие всплески допускаются).
+func DefaultOptions() Options {
+	return Options{
+		GlobalRate:  30,
+		GlobalBurst: 30,
+		ChatRate:    1,
+		ChatBurst:   3,
+		MaxAttempts: 5,
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+	}
+}
+
+// Result - результат доставки запроса.
+type Result struct {
+	ChatID   int64
+	Message  tgbotapi.Message // Отправленное сообщение (при успехе)
+	Attempts int              // Количество сделанных попыток
+	Err      error            // Последняя ошибка или nil при успешной доставке
+}
+
+// Stats - счетчики работы очереди с момента запуска.
+type Stats struct {
+	Queued      int64 // Запросов в очереди сейчас
+	Delivered   int64 // Успешно доставлено
+	Failed      int64 // Не доставлено после всех попыток или из-за постоянной ошибки
+	Retried     int64 // Повторных попыток
+	RateLimited int64 // Ответов 429 от Telegram
+	Errors      int64 // Попыток, завершившихся ошибкой Telegram API или сети
+}
+
+// job - запрос в очереди.
+type job struct {
+	chatID   int64
+	request  tgbotapi.Chattable
+	priority Priority
+	attempts int
+	done     chan Result
+}
+
+// chatQueue - очередь запросов одного чата. Запросы чата отправляются по одному, чтобы сохранить порядок.
+type chatQueue struct {
+	jobs     []*job
+	limit    bucket
+	notUntil time.Time // Не отправлять раньше этого времени (retry_after или задержка повтора)
+	inFlight bool
+}
+
+// Queue - очередь исходящих запросов. Создается New, запускается Run.
+type Queue struct {
+	sender Sender
+	opts   Options
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	chats   map[int64]*chatQueue
+	global  bucket
+	stopped bool
+	wake    chan struct{}
+
+	queued, delivered, failed, retried, rateLimited, apiErrors atomic.Int64
+}
+
+// New создает очередь, отправляющую запросы через sender.
+func New(sender Sender, opts Options, logger *slog.Logger) *Queue {
+	return &Queue{
+		sender: sender,
+		opts:   opts,
+		logger: logger,
+		chats:  make(map[int64]*chatQueue),
+		global: newBucket(opts.GlobalRate, opts.GlobalBurst),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Enqueue ставит запрос в очередь чата chatID и возвращает канал, в который будет записан результат доставки.
+func (q *Queue) Enqueue(chatID int64, request tgbotapi.Chattable, priority Priority) <-chan Result {
+	done := make(chan Result, 1)
+
+	q.mu.Lock()
+	if q.stopped {
+		q.mu.Unlock()
+		done <- Result{ChatID: chatID, Err: ErrStopped}
+		return done
+	}
+	chat, ok := q.chats[chatID]
+	if !ok {
+		chat = &chatQueue{limit: newBucket(q.opts.ChatRate, q.opts.ChatBurst)}
+		q.chats[chatID] = chat
+	}
+	chat.jobs = append(chat.jobs, &job{chatID: chatID, request: request, priority: priority, done: done})
+	q.mu.Unlock()
+
+	q.queued.Add(1)
+	q.signal()
+	return done
+}
+
+// Send ставит запрос в очередь и ждет результата доставки или отмены ctx.
+func (q *Queue) Send(ctx context.Context, chatID int64, request tgbotapi.Chattable, priority Priority) Result {
+	select {
+	case result := <-q.Enqueue(chatID, request, priority):
+		return result
+	case <-ctx.Done():
+		return Result{ChatID: chatID, Err: ctx.Err()}
+	}
+}
+
+// Stats возвращает текущие счетчики очереди.
+func (q *Queue) Stats() Stats {
+	return Stats{
+		Queued:      q.queued.Load(),
+		Delivered:   q.delivered.Load(),
+		Failed:      q.failed.Load(),
+		Retried:     q.retried.Load(),
+		RateLimited: q.rateLimited.Load(),
+		Errors:      q.apiErrors.Load(),
+	}
+}
+
+// Run отправляет запросы из очереди, пока не будет отменен ctx.
+// После остановки неотправленные запросы завершаются с ошибкой ErrStopped.
+func (q *Queue) Run(ctx context.Context) {
+	job := health.NewJob("outbox", 0)
+	defer job.Stopped()
+	for {
+		next, wait := q.dispatch()
+		if next != nil {
+			go q.deliver(next)
+			continue
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			q.stop()
+			return
+		case <-q.wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// dispatch выбирает следующий запрос, который можно отправить сейчас, и резервирует под него лимиты.
+// Если такого запроса нет, возвращает время до появления возможности отправки (0 - ждать нового запроса).
+func (q *Queue) dispatch() (*job, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var best *chatQueue
+	var bestAt time.Time
+	for chatID, chat := range q.chats {
+		if chat.inFlight {
+			continue
+		}
+		at := chat.limit.readyAt(now)
+		if chat.notUntil.After(at) {
+			at = chat.notUntil
+		}
+		if len(chat.jobs) == 0 {
+			// Состояние лимита больше не нужно, когда чат простаивает достаточно долго, чтобы лимит восстановился
+			if chat.limit.full(now) && !chat.notUntil.After(now) {
+				delete(q.chats, chatID)
+			}
+			continue
+		}
+		if best == nil || before(chat, at, best, bestAt, now) {
+			best, bestAt = chat, at
+		}
+	}
+	if best == nil {
+		return nil, 0
+	}
+
+	if globalAt := q.global.readyAt(now); globalAt.After(bestAt) {
+		bestAt = globalAt
+	}
+	if bestAt.After(now) {
+		return nil, bestAt.Sub(now)
+	}
+
+	best.limit.take(now)
+	q.global.take(now)
+	best.inFlight = true
+	return best.jobs[0], 0
+}
+
+// before сообщает, нужно ли отправить запрос чата a (готового в момент aAt) раньше запроса чата b.
+// Из готовых к отправке запросов первыми идут ответы пользователям, затем запросы, ждущие дольше.
+func before(a *chatQueue, aAt time.Time, b *chatQueue, bAt time.Time, now time.Time) bool {
+	aReady, bReady := !aAt.After(now), !bAt.After(now)
+	if aReady && bReady && a.jobs[0].priority != b.jobs[0].priority {
+		return a.jobs[0].priority < b.jobs[0].priority
+	}
+	return aAt.Before(bAt)
+}
+
+// deliver отправляет запрос и по результату завершает его или планирует повтор.
+// Если очередь остановлена, пока запрос отправлялся, повтора не будет: запрос завершается с ErrStopped.
+func (q *Queue) deliver(j *job) {
+	j.attempts++
+	message, err := q.sender.Send(j.request)
+	if err != nil {
+		q.apiErrors.Add(1)
+	}
+
+	q.mu.Lock()
+	chat := q.chats[j.chatID]
+	chat.inFlight = false
+
+	retryAfter, retry := q.retryDelay(j, err)
+	if retry && q.stopped {
+		retry, err = false, ErrStopped
+	}
+	if retry {
+		chat.notUntil = time.Now().Add(retryAfter)
+		q.mu.Unlock()
+		q.retried.Add(1)
+		q.logger.Warn("Повтор отправки запроса", logging.ChatID, j.chatID, "retry_after", retryAfter, "attempt", j.attempts, logging.Error, err)
+		q.signal()
+		return
+	}
+
+	chat.jobs = chat.jobs[1:]
+	q.mu.Unlock()
+
+	q.queued.Add(-1)
+	if err != nil {
+		q.failed.Add(1)
+	} else {
+		q.delivered.Add(1)
+	}
+	j.done <- Result{ChatID: j.chatID, Message: message, Attempts: j.attempts, Err: err}
+	q.signal()
+}
+
+// retryDelay решает, нужно ли повторить запрос после ошибки err, и возвращает задержку перед повтором.
+// Ответ 429 повторяется через retry_after, временные ошибки - с экспоненциальной задержкой,
+// а ошибки в самом запросе (400) и запрет доступа (403, например бот заблокирован) не повторяются.
+func (q *Queue) retryDelay(j *job, err error) (time.Duration, bool) {
+	if err == nil || j.attempts >= q.opts.MaxAttempts {
+		return 0, false
+	}
+
+	var apiErr tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.RetryAfter > 0 {
+			q.rateLimited.Add(1)
+			return time.Duration(apiErr.RetryAfter) * time.Second, true
+		}
+		if strings.HasPrefix(apiErr.Message, "Bad Request") || strings.HasPrefix(apiErr.Message, "Forbidden") ||
+			strings.HasPrefix(apiErr.Message, "Unauthorized") {
+			return 0, false
+		}
+	}
+
+	backoff := q.opts.BaseBackoff << (j.attempts - 1)
+	if backoff <= 0 || backoff > q.opts.MaxBackoff {
+		backoff = q.opts.MaxBackoff
+	}
+	return backoff, true
+}
+
+// stop останавливает прием запросов и завершает ожидающие запросы с ошибкой ErrStopped.
+// Запросы, которые отправляются в этот момент, завершаются в deliver без повторов.
+func (q *Queue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.stopped = true
+	for chatID, chat := range q.chats {
+		first := 0
+		if chat.inFlight {
+			first = 1
+		}
+		for _, j := range chat.jobs[first:] {
+			q.queued.Add(-1)
+			q.failed.Add(1)
+			j.done <- Result{ChatID: chatID, Attempts: j.attempts, Err: ErrStopped}
+		}
+		chat.jobs = chat.jobs[:first]
+	}
+}
+
+// signal будит цикл отправки после изменения очереди.
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// bucket - ограничитель частоты по алгоритму "token bucket".
+type bucket struct {
+	rate   float64 // Токенов в секунду
+	burst  float64 // Емкость
+	tokens float64
+	last   time.Time
+}
+
+// newBucket создает заполненный ограничитель на rate событий в секунду с всплеском burst.
+func newBucket(rate float64, burst int) bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return bucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// refill начисляет токены за время, прошедшее с последнего обращения.
+func (b *bucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// readyAt возвращает время, когда будет доступен токен.
+func (b *bucket) readyAt(now time.Time) time.Time {
+	if b.rate <= 0 {
+		return now
+	}
+	b.refill(now)
+	if b.tokens >= 1 {
+		return now
+	}
+	return now.Add(time.Duration((1 - b.tokens) / b.rate * float64(time.Second)))
+}
+
+// full сообщает, восстановился ли ограничитель полностью.
+func (b *bucket) full(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// take расходует токен.
+func (b *bucket) take(now time.Time) {
+	if b.rate <= 0 {
+		return
+	}
+	b.refill(now)
+	b.tokens--
+}
@@ -0,0 +1,273 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// fakeSender отвечает на запросы ошибками из errs по порядку, а когда они закончатся - успехом.
+// Если задан block, каждая отправка ждет значения из него.
+type fakeSender struct {
+	mu    sync.Mutex
+	errs  []error
+	sent  []string
+	block chan struct{}
+}
+
+func (s *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, c.(tgbotapi.MessageConfig).Text)
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return tgbotapi.Message{}, err
+	}
+	return tgbotapi.Message{MessageID: len(s.sent)}, nil
+}
+
+func (s *fakeSender) texts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.sent...)
+}
+
+// testOptions - лимиты, не задерживающие тесты.
+func testOptions() Options {
+	return Options{
+		GlobalRate:  1000,
+		GlobalBurst: 1000,
+		ChatRate:    1000,
+		ChatBurst:   1000,
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+	}
+}
+
+// startQueue запускает очередь и возвращает функцию, которая останавливает ее и дожидается остановки.
+func startQueue(t *testing.T, sender Sender, opts Options) (*Queue, func()) {
+	t.Helper()
+	q := New(sender, opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(ctx)
+	}()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+	t.Cleanup(stop)
+	return q, stop
+}
+
+// wait дожидается результата доставки.
+func wait(t *testing.T, done <-chan Result) Result {
+	t.Helper()
+	select {
+	case result := <-done:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("результат доставки не получен")
+		return Result{}
+	}
+}
+
+func message(text string) tgbotapi.Chattable {
+	return tgbotapi.NewMessage(1, text)
+}
+
+func TestDeliverRetries(t *testing.T) {
+	temporary := errors.New("connection reset")
+	badRequest := tgbotapi.Error{Message: "Bad Request: message is too long"}
+	tests := []struct {
+		name         string
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{"успешно с первой попытки", nil, nil, 1},
+		{"временная ошибка повторяется", []error{temporary, temporary}, nil, 3},
+		{"попытки закончились", []error{temporary, temporary, temporary}, temporary, 3},
+		{"ошибка в запросе не повторяется", []error{badRequest}, badRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &fakeSender{errs: tt.errs}
+			q, _ := startQueue(t, sender, testOptions())
+
+			result := wait(t, q.Enqueue(1, message("привет"), Interactive))
+			if !errors.Is(result.Err, tt.wantErr) {
+				t.Errorf("Err = %v, ожидалось %v", result.Err, tt.wantErr)
+			}
+			if result.Attempts != tt.wantAttempts {
+				t.Errorf("Attempts = %d, ожидалось %d", result.Attempts, tt.wantAttempts)
+			}
+			stats := q.Stats()
+			if stats.Queued != 0 || stats.Retried != int64(tt.wantAttempts-1) {
+				t.Errorf("Stats = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestChatOrder(t *testing.T) {
+	sender := &fakeSender{errs: []error{errors.New("timeout")}}
+	q, _ := startQueue(t, sender, testOptions())
+
+	var results []<-chan Result
+	for _, text := range []string{"1", "2", "3"} {
+		results = append(results, q.Enqueue(1, message(text), Interactive))
+	}
+	for _, done := range results {
+		if result := wait(t, done); result.Err != nil {
+			t.Fatalf("Err = %v", result.Err)
+		}
+	}
+	// Первое сообщение повторяется, но следующие не обгоняют его
+	want := []string{"1", "1", "2", "3"}
+	if got := sender.texts(); !slices.Equal(got, want) {
+		t.Errorf("порядок отправки %q, ожидалось %q", got, want)
+	}
+}
+
+func TestStopFailsPendingJobs(t *testing.T) {
+	sender := &fakeSender{block: make(chan struct{})}
+	q, stop := startQueue(t, sender, testOptions())
+
+	inFlight := q.Enqueue(1, message("отправляется"), Interactive)
+	pending := q.Enqueue(1, message("ждет"), Interactive)
+	// Дожидаемся, пока первый запрос начнет отправляться
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		q.mu.Lock()
+		started := q.chats[1] != nil && q.chats[1].inFlight
+		q.mu.Unlock()
+		if started {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("запрос не начал отправляться")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stop()
+	if result := wait(t, pending); !errors.Is(result.Err, ErrStopped) {
+		t.Errorf("ожидающий запрос: Err = %v, ожидалось ErrStopped", result.Err)
+	}
+	if result := wait(t, q.Enqueue(1, message("после остановки"), Interactive)); !errors.Is(result.Err, ErrStopped) {
+		t.Errorf("запрос после остановки: Err = %v, ожидалось ErrStopped", result.Err)
+	}
+
+	// Отправлявшийся запрос завершается ошибкой, которую можно повторить, но повтора уже не будет
+	sender.mu.Lock()
+	sender.errs = []error{errors.New("timeout")}
+	sender.mu.Unlock()
+	close(sender.block)
+	if result := wait(t, inFlight); !errors.Is(result.Err, ErrStopped) {
+		t.Errorf("отправлявшийся запрос: Err = %v, ожидалось ErrStopped", result.Err)
+	}
+	if stats := q.Stats(); stats.Queued != 0 {
+		t.Errorf("Queued = %d, ожидалось 0", stats.Queued)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	q := New(nil, Options{MaxAttempts: 5, BaseBackoff: time.Second, MaxBackoff: 3 * time.Second}, nil)
+	tests := []struct {
+		name      string
+		attempts  int
+		err       error
+		wantDelay time.Duration
+		wantRetry bool
+	}{
+		{"успех", 1, nil, 0, false},
+		{"429 ждет retry_after", 1, tgbotapi.Error{Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}}, 7 * time.Second, true},
+		{"400 не повторяется", 1, tgbotapi.Error{Message: "Bad Request: chat not found"}, 0, false},
+		{"403 не повторяется", 1, tgbotapi.Error{Message: "Forbidden: bot was blocked by the user"}, 0, false},
+		{"первый повтор", 1, errors.New("timeout"), time.Second, true},
+		{"задержка удваивается", 2, errors.New("timeout"), 2 * time.Second, true},
+		{"задержка ограничена", 4, errors.New("timeout"), 3 * time.Second, true},
+		{"попытки закончились", 5, errors.New("timeout"), 0, false},
+	}
+	for _, tt := range tests {
+		delay, retry := q.retryDelay(&job{attempts: tt.attempts}, tt.err)
+		if delay != tt.wantDelay || retry != tt.wantRetry {
+			t.Errorf("%s: retryDelay = %s, %v, ожидалось %s, %v", tt.name, delay, retry, tt.wantDelay, tt.wantRetry)
+		}
+	}
+	if got := q.Stats().RateLimited; got != 1 {
+		t.Errorf("RateLimited = %d, ожидалось 1", got)
+	}
+}
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	b := newBucket(2, 2) // 2 токена в секунду, всплеск 2
+
+	for i := 0; i < 2; i++ {
+		if at := b.readyAt(now); !at.Equal(now) {
+			t.Fatalf("токен %d: readyAt = +%s, ожидалось сразу", i+1, at.Sub(now))
+		}
+		b.take(now)
+	}
+	if at := b.readyAt(now); at.Sub(now) != 500*time.Millisecond {
+		t.Errorf("после всплеска readyAt = +%s, ожидалось +500ms", at.Sub(now))
+	}
+	if b.full(now) {
+		t.Error("пустой ограничитель считается полным")
+	}
+
+	later := now.Add(250 * time.Millisecond)
+	if at := b.readyAt(later); at.Sub(later) != 250*time.Millisecond {
+		t.Errorf("через 250ms readyAt = +%s, ожидалось +250ms", at.Sub(later))
+	}
+	if !b.full(now.Add(time.Second)) {
+		t.Error("ограничитель не восстановился за секунду")
+	}
+}
+
+func TestDispatchLimits(t *testing.T) {
+	opts := testOptions()
+	opts.ChatRate, opts.ChatBurst = 1, 1
+	q := New(nil, opts, nil)
+	q.Enqueue(1, message("чат 1, первое"), Bulk)
+	q.Enqueue(1, message("чат 1, второе"), Bulk)
+	q.Enqueue(2, message("чат 2"), Interactive)
+
+	// Ответ пользователю отправляется раньше рассылки
+	next, _ := q.dispatch()
+	if next == nil || next.chatID != 2 {
+		t.Fatalf("первым выбран %+v, ожидался запрос чата 2", next)
+	}
+	next, _ = q.dispatch()
+	if next == nil || next.chatID != 1 {
+		t.Fatalf("вторым выбран %+v, ожидался запрос чата 1", next)
+	}
+
+	// Запрос завершен, но лимит чата 1 исчерпан: следующий запрос ждет около секунды
+	q.mu.Lock()
+	q.chats[1].inFlight = false
+	q.chats[1].jobs = q.chats[1].jobs[1:]
+	q.mu.Unlock()
+	next, wait := q.dispatch()
+	if next != nil || wait <= 900*time.Millisecond || wait > time.Second {
+		t.Errorf("dispatch = %+v, %s, ожидалось ожидание около секунды", next, wait)
+	}
+}
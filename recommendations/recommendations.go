@@ -0,0 +1,95 @@
+// Package recommendations строит рекомендации "с этим также покупают" на основе истории заказов.
+package recommendations
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/health"
+	"beer_from_the_brewery/logging"
+	"context"
+	"database/sql"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Recommender хранит статистику совместных покупок пива и подбирает рекомендации.
+// Статистика считается целиком в базе данных и периодически обновляется.
+type Recommender struct {
+	mu     sync.RWMutex
+	counts map[int]map[int]int // Количество заказов, в которых пара сортов встречалась вместе
+}
+
+// New создает пустой Recommender. До первого обновления рекомендаций нет.
+func New() *Recommender {
+	return &Recommender{counts: make(map[int]map[int]int)}
+}
+
+// Refresh пересчитывает статистику совместных покупок по таблице order_items.
+func (r *Recommender) Refresh(ctx context.Context, db *sql.DB) error {
+	counts, err := database.GetBeerCooccurrence(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.counts = counts
+	r.mu.Unlock()
+	return nil
+}
+
+// Run периодически обновляет статистику, пока не будет отменен контекст.
+func (r *Recommender) Run(ctx context.Context, db *sql.DB, interval time.Duration, logger *slog.Logger) {
+	job := health.NewJob("recommendations", interval)
+	defer job.Stopped()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Обновление рекомендаций остановлено")
+			return
+		case <-ticker.C:
+			if err := r.Refresh(ctx, db); err != nil {
+				job.Failed(err)
+				logger.Error("Ошибка при обновлении рекомендаций", logging.Error, err)
+			} else {
+				job.Succeeded()
+			}
+		}
+	}
+}
+
+// Recommend возвращает ID пива, которое чаще всего покупали вместе с beerIDs,
+// в порядке убывания популярности. Сами beerIDs в результат не попадают.
+func (r *Recommender) Recommend(beerIDs []int) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	exclude := make(map[int]bool, len(beerIDs))
+	for _, beerID := range beerIDs {
+		exclude[beerID] = true
+	}
+
+	scores := make(map[int]int)
+	for _, beerID := range beerIDs {
+		for otherID, orders := range r.counts[beerID] {
+			if !exclude[otherID] {
+				scores[otherID] += orders
+			}
+		}
+	}
+
+	recommended := make([]int, 0, len(scores))
+	for beerID := range scores {
+		recommended = append(recommended, beerID)
+	}
+	sort.Slice(recommended, func(i, j int) bool {
+		if scores[recommended[i]] != scores[recommended[j]] {
+			return scores[recommended[i]] > scores[recommended[j]]
+		}
+		return recommended[i] < recommended[j]
+	})
+	return recommended
+}
@@ -0,0 +1,115 @@
+// Package render формирует форматированные сообщения бота в HTML-разметке Telegram.
+//
+// Разметка сообщений (карточки пива, корзина, история заказов) хранится в шаблонах
+// html/template, поэтому названия и описания пива экранируются автоматически.
+// Встроенные шаблоны лежат в templates/*.tmpl; их можно переопределить, не меняя код,
+// положив файлы *.tmpl с теми же {{define}} в каталог, заданный при создании Renderer.
+package render
+
+import (
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/models"
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ParseMode - режим разметки Telegram для сообщений, сформированных этим пакетом.
+const ParseMode = "HTML"
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Cart - данные шаблона "cart".
+type Cart struct {
+	Lines []CartLine // Позиции корзины
+	Total float64    // Общая стоимость
+}
+
+// CartLine - позиция корзины: пиво, количество и стоимость позиции.
+type CartLine struct {
+	Beer     models.Beer
+	Quantity int
+	Sum      float64
+}
+
+// Renderer формирует сообщения по шаблонам на языке пользователя.
+type Renderer struct {
+	templates *template.Template // Разобранные шаблоны; не исполняются напрямую, только их копии
+}
+
+// New загружает встроенные шаблоны и переопределяет их шаблонами из каталога dir (*.tmpl).
+// Пустой dir означает использование только встроенных шаблонов.
+func New(dir string) (*Renderer, error) {
+	templates, err := template.New("messages").Funcs(localizedFuncs(i18n.New(i18n.DefaultLanguage))).
+		ParseFS(defaultTemplates, "templates/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка в встроенных шаблонах сообщений: %w", err)
+	}
+
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при поиске шаблонов сообщений в %s: %w", dir, err)
+		}
+		if len(files) == 0 {
+			if _, err := os.Stat(dir); err != nil {
+				return nil, fmt.Errorf("каталог шаблонов сообщений недоступен: %w", err)
+			}
+		} else if templates, err = templates.ParseFiles(files...); err != nil {
+			return nil, fmt.Errorf("ошибка в шаблонах сообщений из %s: %w", dir, err)
+		}
+	}
+	return &Renderer{templates: templates}, nil
+}
+
+// Render исполняет шаблон name с данными data на языке loc и возвращает текст в HTML-разметке.
+func (r *Renderer) Render(name string, loc i18n.Localizer, data any) (string, error) {
+	// Функции шаблонов зависят от языка, поэтому исполняется копия шаблонов с функциями для loc.
+	// Исходные шаблоны никогда не исполняются, иначе html/template запретил бы их копировать.
+	templates, err := r.templates.Clone()
+	if err != nil {
+		return "", fmt.Errorf("ошибка при копировании шаблонов сообщений: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := templates.Funcs(localizedFuncs(loc)).ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("ошибка при формировании сообщения по шаблону %s: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Escape экранирует произвольный текст для вставки в сообщение с HTML-разметкой Telegram.
+func Escape(text string) string {
+	return html.EscapeString(text)
+}
+
+// localizedFuncs возвращает функции шаблонов для языка loc:
+//
+//	t      - перевод сообщения каталога (i18n.Localizer.T);
+//	n      - перевод с формой множественного числа (i18n.Localizer.N);
+//	date   - дата в формате языка пользователя;
+//	status - название статуса заказа.
+func localizedFuncs(loc i18n.Localizer) template.FuncMap {
+	return template.FuncMap{
+		"t": loc.T,
+		"n": loc.N,
+		"date": func(t time.Time) string {
+			return t.Format(loc.T("format.date"))
+		},
+		"status": func(status string) string {
+			// Для статусов без перевода выводится сам статус
+			key := "order.status." + status
+			if title := loc.T(key); title != key {
+				return title
+			}
+			return status
+		},
+	}
+}
@@ -0,0 +1,265 @@
+package render
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// MaxMessageLength - максимальная длина текста сообщения Telegram.
+// Telegram считает длину в кодовых единицах UTF-16.
+const MaxMessageLength = 4096
+
+// boundary - позиция в тексте, по которой его можно разрезать.
+type boundary struct {
+	pos  int      // Смещение в байтах
+	open []string // Открытые в этой позиции HTML-теги (открывающие теги целиком), которые нужно закрыть и открыть заново
+}
+
+// Split разбивает текст сообщения на части не длиннее limit кодовых единиц UTF-16.
+//
+// Текст режется по границе абзаца, строки или слова, а если их нет - между символами,
+// но никогда внутри разметки: в режиме HTML не разрезаются теги и мнемоники (&amp;),
+// а открытые теги закрываются в конце части и открываются заново в начале следующей;
+// в режимах Markdown и MarkdownV2 текст режется только вне выделенных фрагментов.
+// parseMode - режим разметки сообщения ("", "HTML", "Markdown" или "MarkdownV2").
+func Split(text, parseMode string, limit int) []string {
+	if limit <= 0 || utf16Len(text) <= limit {
+		return []string{text}
+	}
+
+	boundaries := findBoundaries(text, parseMode)
+	units := utf16Offsets(text)
+	var chunks []string
+	var prefix []string // Теги, которые нужно открыть в начале очередной части
+	start := 0
+	for {
+		opening := strings.Join(prefix, "")
+		if utf16Len(opening)+units[len(text)]-units[start] <= limit {
+			chunks = append(chunks, opening+text[start:])
+			return chunks
+		}
+
+		cut := chooseBoundary(text, units, boundaries, start, utf16Len(opening), limit)
+		chunks = append(chunks, opening+text[start:trimBreak(text, start, cut.pos)]+closingTags(cut.open))
+
+		prefix = cut.open
+		start = cut.pos
+		for start < len(text) && (text[start] == ' ' || text[start] == '\n') {
+			start++
+		}
+		if start == len(text) {
+			return chunks
+		}
+	}
+}
+
+// chooseBoundary выбирает позицию разреза после start, при которой часть помещается в limit.
+// Предпочтение отдается концу абзаца, затем концу строки, затем пробелу.
+// units - смещения байтов текста в кодовых единицах UTF-16, openingLen - длина тегов в начале части.
+func chooseBoundary(text string, units []int, boundaries []boundary, start, openingLen, limit int) boundary {
+	first := sort.Search(len(boundaries), func(i int) bool { return boundaries[i].pos > start })
+	var fits []boundary
+	for _, b := range boundaries[first:] {
+		length := openingLen + units[trimBreak(text, start, b.pos)] - units[start] + utf16Len(closingTags(b.open))
+		if length > limit {
+			break
+		}
+		fits = append(fits, b)
+	}
+
+	if len(fits) == 0 {
+		// Безопасной позиции нет (например, выделенный фрагмент длиннее limit) - режем между символами
+		pos := start
+		for pos < len(text) && openingLen+units[pos]-units[start] < limit {
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			pos += size
+		}
+		if pos == start {
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			pos += size
+		}
+		return boundary{pos: pos}
+	}
+
+	for _, separator := range []string{"\n\n", "\n", " "} {
+		for i := len(fits) - 1; i >= 0; i-- {
+			if strings.HasSuffix(text[:fits[i].pos], separator) {
+				return fits[i]
+			}
+		}
+	}
+	return fits[len(fits)-1]
+}
+
+// trimBreak возвращает конец части text[start:end] без пробелов и переводов строк, по которым она разрезана.
+func trimBreak(text string, start, end int) int {
+	for end > start && (text[end-1] == ' ' || text[end-1] == '\n') {
+		end--
+	}
+	return end
+}
+
+// findBoundaries возвращает позиции, по которым текст можно разрезать, не повредив разметку.
+func findBoundaries(text, parseMode string) []boundary {
+	switch parseMode {
+	case "HTML":
+		return htmlBoundaries(text)
+	case "Markdown", "MarkdownV2":
+		return markdownBoundaries(text, parseMode == "MarkdownV2")
+	}
+
+	var boundaries []boundary
+	for pos := range text {
+		if pos > 0 {
+			boundaries = append(boundaries, boundary{pos: pos})
+		}
+	}
+	return boundaries
+}
+
+// htmlBoundaries возвращает позиции вне тегов и мнемоник вместе со стеком открытых тегов.
+// Сразу после открывающего тега текст не режется, чтобы в конце части не остался пустой тег.
+func htmlBoundaries(text string) []boundary {
+	var boundaries []boundary
+	var open []string
+	for pos := 0; pos < len(text); {
+		opening := false
+		switch text[pos] {
+		case '<':
+			end := strings.IndexByte(text[pos:], '>')
+			if end < 0 {
+				return boundaries
+			}
+			tag := text[pos : pos+end+1]
+			if strings.HasPrefix(tag, "</") {
+				if len(open) > 0 {
+					open = open[:len(open)-1]
+				}
+			} else if !strings.HasSuffix(tag, "/>") {
+				// Копируем стек, чтобы не менять уже сохраненные позиции
+				open = append(append([]string(nil), open...), tag)
+				opening = true
+			}
+			pos += end + 1
+		case '&':
+			end := strings.IndexByte(text[pos:], ';')
+			if end < 0 {
+				end = 0
+			}
+			pos += end + 1
+		default:
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			pos += size
+		}
+		if pos < len(text) && !opening {
+			boundaries = append(boundaries, boundary{pos: pos, open: open})
+		}
+	}
+	return boundaries
+}
+
+// markdownBoundaries возвращает позиции вне выделенных фрагментов Markdown:
+// жирного, курсива, кода, блоков кода и ссылок, а в MarkdownV2 также подчеркивания,
+// зачеркивания и спойлеров. Экранированные символы (\*) разметкой не считаются.
+func markdownBoundaries(text string, v2 bool) []boundary {
+	var boundaries []boundary
+	var entity string // Открытый выделенный фрагмент (маркер) или пустая строка
+	inLink := false
+	for pos := 0; pos < len(text); {
+		step := 1
+		switch {
+		case text[pos] == '\\' && entity != "```" && entity != "`":
+			_, size := utf8.DecodeRuneInString(text[min(pos+1, len(text)-1):])
+			step = 1 + size
+		case strings.HasPrefix(text[pos:], "```"):
+			step = 3
+			entity = toggleMarker(entity, "```")
+		case entity == "```":
+			_, step = utf8.DecodeRuneInString(text[pos:])
+		case text[pos] == '`':
+			entity = toggleMarker(entity, "`")
+		case entity == "`":
+			_, step = utf8.DecodeRuneInString(text[pos:])
+		case text[pos] == '[' && !inLink:
+			inLink = true
+		case inLink && text[pos] == ')':
+			inLink = false
+		case inLink && text[pos] == ']' && !strings.HasPrefix(text[pos:], "]("):
+			inLink = false
+		case v2 && (strings.HasPrefix(text[pos:], "__") || strings.HasPrefix(text[pos:], "||")):
+			step = 2
+			entity = toggleMarker(entity, text[pos:pos+2])
+		case text[pos] == '*' || text[pos] == '_' || (v2 && text[pos] == '~'):
+			entity = toggleMarker(entity, text[pos:pos+1])
+		default:
+			_, step = utf8.DecodeRuneInString(text[pos:])
+		}
+		pos += step
+		if pos < len(text) && entity == "" && !inLink {
+			boundaries = append(boundaries, boundary{pos: pos})
+		}
+	}
+	return boundaries
+}
+
+// toggleMarker открывает выделенный фрагмент marker или закрывает его, если он уже открыт.
+// Маркеры внутри другого фрагмента (например, _ внутри *) не меняют состояние.
+func toggleMarker(entity, marker string) string {
+	switch entity {
+	case "":
+		return marker
+	case marker:
+		return ""
+	}
+	return entity
+}
+
+// closingTags возвращает закрывающие теги для открытых тегов open в обратном порядке.
+func closingTags(open []string) string {
+	var closing strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		name := strings.TrimPrefix(open[i], "<")
+		if end := strings.IndexAny(name, " >"); end >= 0 {
+			name = name[:end]
+		}
+		closing.WriteString("</" + name + ">")
+	}
+	return closing.String()
+}
+
+// utf16Offsets возвращает для каждого смещения в байтах (включая конец текста)
+// длину предшествующего текста в кодовых единицах UTF-16.
+func utf16Offsets(text string) []int {
+	units := make([]int, len(text)+1)
+	n := 0
+	for pos := 0; pos < len(text); {
+		r, size := utf8.DecodeRuneInString(text[pos:])
+		for i := pos; i < pos+size; i++ {
+			units[i] = n
+		}
+		n += utf16RuneLen(r)
+		pos += size
+	}
+	units[len(text)] = n
+	return units
+}
+
+// utf16Len возвращает длину строки в кодовых единицах UTF-16.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16RuneLen(r)
+	}
+	return n
+}
+
+// utf16RuneLen возвращает количество кодовых единиц UTF-16 для символа r:
+// символы вне базовой плоскости (например, эмодзи) кодируются суррогатной парой.
+func utf16RuneLen(r rune) int {
+	if utf16.IsSurrogate(r) || r < 0x10000 {
+		return 1
+	}
+	return 2
+}
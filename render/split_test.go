@@ -0,0 +1,151 @@
+package render
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		parseMode string
+		limit     int
+		want      []string
+	}{
+		{
+			name:  "короткий текст не режется",
+			text:  "привет",
+			limit: 10,
+			want:  []string{"привет"},
+		},
+		{
+			name:  "без ограничения",
+			text:  "aaaa bbbb",
+			limit: 0,
+			want:  []string{"aaaa bbbb"},
+		},
+		{
+			name:  "по пробелу",
+			text:  "aaaa bbbb cccc",
+			limit: 10,
+			want:  []string{"aaaa bbbb", "cccc"},
+		},
+		{
+			name:  "абзац важнее пробела",
+			text:  "aa bb\n\ncc dd",
+			limit: 10,
+			want:  []string{"aa bb", "cc dd"},
+		},
+		{
+			name:  "между символами, если нет пробелов",
+			text:  "abcdefgh",
+			limit: 3,
+			want:  []string{"abc", "def", "gh"},
+		},
+		{
+			name:  "кириллица считается по символам",
+			text:  "пиво пиво",
+			limit: 4,
+			want:  []string{"пиво", "пиво"},
+		},
+		{
+			name:  "эмодзи занимает две кодовые единицы",
+			text:  "😀😀😀",
+			limit: 4,
+			want:  []string{"😀😀", "😀"},
+		},
+		{
+			name:  "суррогатная пара не разрезается",
+			text:  "a😀b",
+			limit: 2,
+			want:  []string{"a", "😀", "b"},
+		},
+		{
+			name:      "тег закрывается и открывается заново",
+			text:      "<b>aaaa bbbb</b>",
+			parseMode: "HTML",
+			limit:     12,
+			want:      []string{"<b>aaaa</b>", "<b>bbbb</b>"},
+		},
+		{
+			name:      "вложенные теги с атрибутами",
+			text:      `<a href="x"><b>aaa bbb</b></a>`,
+			parseMode: "HTML",
+			limit:     26,
+			want:      []string{`<a href="x"><b>aaa</b></a>`, `<a href="x"><b>bbb</b></a>`},
+		},
+		{
+			name:      "мнемоника не разрезается",
+			text:      "ab&amp;cd",
+			parseMode: "HTML",
+			limit:     5,
+			want:      []string{"ab", "&amp;", "cd"},
+		},
+		{
+			name:      "тег не разрезается",
+			text:      "ab<i>c</i>",
+			parseMode: "HTML",
+			limit:     9,
+			want:      []string{"ab", "<i>c</i>"},
+		},
+		{
+			name:      "выделение Markdown не разрезается",
+			text:      "aa *bb cc* dd",
+			parseMode: "Markdown",
+			limit:     9,
+			want:      []string{"aa", "*bb cc*", "dd"},
+		},
+		{
+			name:      "экранированный маркер MarkdownV2 не открывает выделение",
+			text:      `aa \*bb cc`,
+			parseMode: "MarkdownV2",
+			limit:     6,
+			want:      []string{"aa", `\*bb`, "cc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.text, tt.parseMode, tt.limit)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Split(%q, %q, %d) = %q, ожидалось %q", tt.text, tt.parseMode, tt.limit, got, tt.want)
+			}
+			if tt.limit <= 0 {
+				return
+			}
+			for _, chunk := range got {
+				if n := utf16Len(chunk); n > tt.limit {
+					t.Errorf("часть %q длиной %d превышает лимит %d", chunk, n, tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestUTF16Len(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"пиво", 4},
+		{"🍺", 2},
+		{"🍺 и 🍻", 7},
+	}
+	for _, tt := range tests {
+		if got := utf16Len(tt.text); got != tt.want {
+			t.Errorf("utf16Len(%q) = %d, ожидалось %d", tt.text, got, tt.want)
+		}
+		if units := utf16Offsets(tt.text); units[len(tt.text)] != tt.want {
+			t.Errorf("utf16Offsets(%q) заканчивается на %d, ожидалось %d", tt.text, units[len(tt.text)], tt.want)
+		}
+	}
+}
+
+func TestClosingTags(t *testing.T) {
+	got := closingTags([]string{`<a href="x">`, "<b>", `<span class="tg-spoiler">`})
+	if want := "</span></b></a>"; got != want {
+		t.Errorf("closingTags = %q, ожидалось %q", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+// Package reports собирает отчеты о продажах за период для администраторов: заказы, выручку,
+// средний чек, популярное пиво, новых и повторных покупателей и заканчивающееся пиво.
+package reports
+
+import (
+	"beer_from_the_brewery/database"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TopBeersLimit - сколько самых продаваемых сортов пива попадает в отчет.
+const TopBeersLimit = 5
+
+// Report - отчет о продажах за период с From (включительно) до To.
+type Report struct {
+	From, To time.Time
+	database.SalesSummary
+	TopBeers []database.BeerSales    // Самые продаваемые сорта пива
+	LowStock []database.LowStockBeer // Пиво, остаток которого не больше порога
+}
+
+// AverageCheck возвращает среднюю сумму заказа или 0, если заказов не было.
+func (r *Report) AverageCheck() float64 {
+	if r.Orders == 0 {
+		return 0
+	}
+	return r.Revenue / float64(r.Orders)
+}
+
+// Build собирает отчет о продажах с from до to. Остатки пива - текущие, а не на конец периода.
+func Build(ctx context.Context, db *sql.DB, from, to time.Time) (*Report, error) {
+	summary, err := database.GetSalesSummary(ctx, db, from, to)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{From: from, To: to, SalesSummary: summary}
+	if report.TopBeers, err = database.GetTopBeers(ctx, db, from, to, TopBeersLimit); err != nil {
+		return nil, err
+	}
+	if report.LowStock, err = database.GetLowStockBeers(ctx, db); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// PreviousDay возвращает границы суток, предшествующих дню t, в часовом поясе loc.
+func PreviousDay(t time.Time, loc *time.Location) (from, to time.Time) {
+	year, month, day := t.In(loc).Date()
+	to = time.Date(year, month, day, 0, 0, 0, 0, loc)
+	return to.AddDate(0, 0, -1), to
+}
+
+// NextRun возвращает ближайший после now момент, когда от начала суток в часовом поясе loc
+// прошло at. Время считается по часам, поэтому при переходе на летнее время сдвигается вместе с ними.
+func NextRun(now time.Time, at time.Duration, loc *time.Location) time.Time {
+	year, month, day := now.In(loc).Date()
+	hour, minute := int(at/time.Hour), int(at%time.Hour/time.Minute)
+	next := time.Date(year, month, day, hour, minute, 0, 0, loc)
+	if !next.After(now) {
+		next = time.Date(year, month, day+1, hour, minute, 0, 0, loc)
+	}
+	return next
+}
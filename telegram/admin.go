@@ -0,0 +1,74 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/models"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// isAdmin проверяет, является ли пользователь администратором бота.
+func isAdmin(user *tgbotapi.User) bool {
+	return user != nil && adminIDs[int64(user.ID)]
+}
+
+// handleRestockCommand обрабатывает команду администратора /restock <ID пива> <количество>.
+func handleRestockCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, message.Chat.ID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 2 {
+		sendMessage(bot, message.Chat.ID, loc.T("admin.restock_usage"), "", nil, logger)
+		return
+	}
+	beerID, err := strconv.Atoi(args[0])
+	if err != nil {
+		sendMessage(bot, message.Chat.ID, loc.T("common.invalid_beer_id"), "", nil, logger)
+		return
+	}
+	quantity, err := strconv.Atoi(args[1])
+	if err != nil || quantity < 0 {
+		sendMessage(bot, message.Chat.ID, loc.T("common.invalid_quantity"), "", nil, logger)
+		return
+	}
+
+	previous, err := database.SetBeerQuantity(logContext(logger), db, beerID, quantity)
+	if err != nil {
+		logger.Error("Ошибка при изменении остатка", "beer_id", beerID, logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("admin.restock_error"), "", nil, logger)
+		return
+	}
+	logger.Info("Остаток пива изменен", "beer_id", beerID, "previous", previous, "quantity", quantity, "admin", describeUser(message.From))
+
+	beer, found := beerCatalog.SetQuantity(beerID, quantity)
+	sendMessage(bot, message.Chat.ID, loc.T("admin.restocked", previous, quantity), "", nil, logger)
+
+	// Каталог уже знает новый остаток, поэтому уведомление базы данных не покажет его изменение
+	if quantity < previous && adminChatID != 0 {
+		goBackground(func() { alertLowStock(bot, db, adminChatID, logger) })
+	}
+
+	if previous > 0 || quantity == 0 {
+		return
+	}
+	if !found {
+		// Каталог еще не загружен или не знает это пиво: подписчиков все равно нужно уведомить
+		loaded, err := beerCatalog.Get(logContext(logger), db, beerID)
+		if err != nil || loaded == nil {
+			logger.Error("Ошибка при получении пива для уведомления о поступлении", "beer_id", beerID, logging.Error, err)
+			return
+		}
+		beer = *loaded
+	}
+	// Подписчиков может быть много, поэтому уведомляем их в фоне, не задерживая обработку обновлений
+	goBackground(func() { notifyRestocked(bot, db, []models.Beer{beer}, logger) })
+}
@@ -1,81 +1,329 @@
 package telegram
 
 import (
-	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/catalog"
+	"beer_from_the_brewery/config"
+	"beer_from_the_brewery/health"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/metrics"
 	"beer_from_the_brewery/models"
+	"beer_from_the_brewery/outbox"
+	"beer_from_the_brewery/recommendations"
+	"beer_from_the_brewery/render"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
 	"database/sql"
-	"log"
-	"os"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
+const pollRetryDelay = 3 * time.Second // Пауза перед повтором getUpdates после ошибки
+
 // Глобальные переменные для хранения данных бота
 var (
-	beers                 []models.Beer          // Список доступного пива
-	beersMutex            = &sync.Mutex{}        // Мьютекс для безопасного доступа к beers
-	waitingForSearchQuery = make(map[int64]bool) // Карта для отслеживания пользователей, ожидающих результаты поиска
-	carts                 sync.Map               // Карта для хранения корзин пользователей (ключ - chatID, значение - map[int]models.CartItem)
+	beerCatalog           = catalog.New()                       // Каталог пива с поиском по ID и типу
+	waitingForSearchQuery = make(map[int64]bool)                // Карта для отслеживания пользователей, ожидающих результаты поиска
+	waitingForReview      = make(map[int64]int64)               // Карта пользователей, от которых ожидается текст отзыва (значение - ID отзыва)
+	carts                 sync.Map                              // Карта для хранения корзин пользователей (ключ - chatID, значение - map[int]models.CartItem)
+	adminIDs              map[int64]bool                        // ID пользователей Telegram, которым доступны команды администратора
+	location              = time.Local                          // Часовой пояс дат в выгрузках и отчетах
+	adminChatID           int64                                 // Чат администраторов для отчетов и предупреждений (0 - не задан)
+	recommender           = recommendations.New()               // Рекомендации "с этим также покупают"
+	userLanguages         sync.Map                              // Кэш языков пользователей (ключ - ID пользователя, значение - код языка)
+	renderer              *render.Renderer                      // Шаблоны форматированных сообщений
+	outgoing              *outbox.Queue                         // Очередь исходящих запросов к Telegram
+	updatesJob            *health.Job                           // Состояние получения обновлений от Telegram
+	waitingForBroadcast   = make(map[int64]bool)                // Администраторы, от которых ожидается текст рассылки
+	broadcastDrafts       = make(map[int64]*broadcastDraft)     // Составляемые рассылки (ключ - chatID администратора)
+	waitingForCatalogFile = make(map[int64]bool)                // Администраторы, от которых ожидается CSV-файл каталога
+	catalogImports        = make(map[int64][]catalog.ImportRow) // Проверенные файлы каталога, ожидающие подтверждения (ключ - chatID администратора)
+	runningBroadcasts     sync.Map                              // Выполняемые рассылки (ключ - ID рассылки, значение - context.CancelFunc)
+	botContext            = context.Background()                // Контекст бота, отменяемый при остановке
+	background            sync.WaitGroup                        // Фоновые задачи, завершения которых нужно дождаться при остановке
+	backgroundMu          sync.Mutex                            // Защищает backgroundClosed и запуск фоновых задач
+	backgroundClosed      bool                                  // Остановка бота ждет фоновые задачи, новые не запускаются
 )
 
-// StartBot запускает Telegram бота.
-func StartBot(db *sql.DB, logger *log.Logger) {
-	// Получаем токен бота из переменных окружения.
-	botToken := os.Getenv("BOT_TOKEN")
-	if botToken == "" {
-		log.Fatal("BOT_TOKEN не задан!")
+// goBackground запускает fn в отдельной горутине; остановка бота дожидается ее завершения.
+// fn должна завершаться после отмены botContext. После того как остановка начала ждать
+// фоновые задачи (например, если API изменило статус заказа во время остановки),
+// fn не запускается.
+func goBackground(fn func()) {
+	backgroundMu.Lock()
+	defer backgroundMu.Unlock()
+	if backgroundClosed {
+		logging.FromContext(botContext).Warn("Бот останавливается, фоновая задача не запущена")
+		return
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		fn()
+	}()
+}
+
+// closeBackground запрещает запуск новых фоновых задач и возвращает канал,
+// который закрывается после завершения уже запущенных.
+func closeBackground() <-chan struct{} {
+	backgroundMu.Lock()
+	backgroundClosed = true
+	backgroundMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// StartBot запускает Telegram бота с настройками cfg и работает до отмены ctx.
+//
+// После отмены ctx бот перестает получать обновления, дожидается обработки уже полученных
+// обновлений и завершения фоновых задач (не дольше cfg.ShutdownTimeout), а затем останавливает
+// очередь исходящих сообщений. Возвращает ошибку, если бот не удалось запустить
+// или остановка не уложилась в отведенное время.
+func StartBot(ctx context.Context, cfg *config.Config, db *sql.DB, logger *slog.Logger) error {
+	adminIDs = cfg.AdminIDs
+	location = cfg.Location
+	adminChatID = cfg.AdminChatID
+
+	// Загружаем шаблоны сообщений; TEMPLATES_DIR позволяет переопределить встроенные шаблоны.
+	var err error
+	renderer, err = render.New(cfg.TemplatesDir)
+	if err != nil {
+		return fmt.Errorf("ошибка при загрузке шаблонов сообщений: %w", err)
 	}
 
 	// Создаем новый экземпляр бота.
-	bot, err := tgbotapi.NewBotAPI(botToken)
+	bot, err := tgbotapi.NewBotAPI(cfg.BotToken)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("ошибка при подключении к Telegram: %w", err)
 	}
 
-	logger.Printf("Авторизован как @%s", bot.Self.UserName)
+	logger.Info("Бот авторизован", "username", bot.Self.UserName)
+	botContext = logging.NewContext(ctx, logger)
 
-	// Инициализируем список пива при запуске с контекстом и таймаутом
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Все запросы к Telegram отправляются через очередь с ограничением частоты.
+	// Очередь останавливается последней, чтобы успели уйти ответы обработчиков и фоновых задач.
+	outboxCtx, stopOutbox := context.WithCancel(context.Background())
+	outboxDone := make(chan struct{})
+	outgoing = outbox.New(bot, outbox.DefaultOptions(), logger)
+	go func() {
+		defer close(outboxDone)
+		outgoing.Run(outboxCtx)
+	}()
+	registerOutboxMetrics(outgoing)
 
-	beersMutex.Lock()
-	beers, err = database.GetBeers(ctx, db)
-	beersMutex.Unlock()
+	// Сообщаем покупателям об изменениях статусов их заказов.
+	registerOrderStatusHooks(bot, db)
 
-	if err != nil {
-		logger.Printf("Ошибка при начальной загрузке списка пива: %s", err.Error())
+	// Продолжаем рассылки, прерванные перезапуском.
+	resumeBroadcasts(bot, db, logger)
+
+	// Загружаем каталог пива при запуске и поддерживаем его актуальность.
+	// О низком остатке предупреждаем при запуске (остаток мог снизиться, пока бот не работал)
+	// и после изменений остатка; другие изменения каталога не проверяются.
+	if _, err := beerCatalog.Refresh(botContext, db); err != nil {
+		logger.Error("Ошибка при начальной загрузке списка пива", logging.Error, err)
 	}
+	if adminChatID != 0 {
+		goBackground(func() { alertLowStock(bot, db, adminChatID, logger) })
+	}
+	goBackground(func() {
+		beerCatalog.Run(botContext, db, cfg.Database.ConnString(), cfg.CatalogRefreshInterval, logger, func(restocked []models.Beer, stockChanged bool) {
+			notifyRestocked(bot, db, restocked, logger)
+			if stockChanged && adminChatID != 0 {
+				alertLowStock(bot, db, adminChatID, logger)
+			}
+		})
+	})
 
-	// Запускаем горутину для периодического обновления списка пива с контекстом.
-	go database.UpdateBeerList(context.Background(), db, &beers, beersMutex, logger) // Передаем контекст и логгер
+	// Загружаем статистику совместных покупок и периодически обновляем ее.
+	if err := recommender.Refresh(botContext, db); err != nil {
+		logger.Error("Ошибка при начальной загрузке рекомендаций", logging.Error, err)
+	}
+	goBackground(func() { recommender.Run(botContext, db, cfg.RecommendationsInterval, logger) })
 
-	// Получаем канал обновлений от Telegram.
-	updates := getUpdatesChannel(bot)
+	// Запускаем планировщик регулярных заказов по подпискам.
+	goBackground(func() { runSubscriptionScheduler(botContext, bot, db, cfg.SubscriptionCheckInterval, logger) })
 
-	// Обрабатываем обновления.
-	for update := range updates {
-		if update.Message != nil && update.Message.IsCommand() {
-			handleCommand(bot, update.Message, db, logger)
-		} else if update.CallbackQuery != nil {
-			handleCallbackQuery(bot, update.CallbackQuery, db, logger)
-		} else if update.Message != nil && !update.Message.IsCommand() {
-			handleMessage(bot, update.Message, db, logger)
+	// Отправляем ежедневный отчет о продажах в чат администраторов.
+	if adminChatID != 0 {
+		goBackground(func() { runDailyReport(botContext, bot, db, adminChatID, cfg.ReportTime, logger) })
+	}
+
+	// Получаем обновления от Telegram и регистрируем проверки готовности для /readyz.
+	var updates <-chan tgbotapi.Update
+	switch cfg.Transport {
+	case config.TransportWebhook:
+		updates, err = receiveWebhook(ctx, bot, cfg.WebhookURL, cfg.WebhookAddr, logger)
+		if err != nil {
+			stopOutbox()
+			return err
+		}
+	default:
+		// getUpdates не работает, пока у бота зарегистрирован webhook
+		if info, err := bot.GetWebhookInfo(); err == nil && info.IsSet() {
+			if _, err := bot.RemoveWebhook(); err != nil {
+				stopOutbox()
+				return fmt.Errorf("ошибка при удалении webhook: %w", err)
+			}
+			logger.Info("Webhook удален, обновления получаются через getUpdates")
 		}
+		updates = pollUpdates(ctx, bot, cfg.PollTimeout, logger)
 	}
+	registerHealthChecks(cfg)
+
+	// Обрабатываем обновления до остановки бота.
+	handlersDone := make(chan struct{})
+	go func() {
+		defer close(handlersDone)
+		for {
+			select {
+			case update, ok := <-updates:
+				if !ok {
+					return
+				}
+				handleUpdate(bot, update, db, logger)
+			case <-ctx.Done():
+				drainUpdates(bot, updates, db, logger)
+				return
+			}
+		}
+	}()
+
+	<-ctx.Done()
+	return shutdown(cfg.ShutdownTimeout, handlersDone, stopOutbox, outboxDone, logger)
 }
 
-// getUpdatesChannel возвращает канал обновлений от Telegram.
-func getUpdatesChannel(bot *tgbotapi.BotAPI) tgbotapi.UpdatesChannel {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+// drainUpdates обрабатывает обновления, которые уже получены от Telegram, но еще не обработаны:
+// getUpdates подтверждает их получение, и после перезапуска они не придут повторно.
+func drainUpdates(bot *tgbotapi.BotAPI, updates <-chan tgbotapi.Update, db *sql.DB, logger *slog.Logger) {
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			handleUpdate(bot, update, db, logger)
+		default:
+			return
+		}
+	}
+}
+
+// shutdown дожидается завершения обработчиков обновлений и фоновых задач, а затем
+// останавливает очередь исходящих сообщений. Все ожидание ограничено timeout.
+// Фоновые задачи ожидаются после обработчиков, которые могут запускать новые задачи.
+func shutdown(timeout time.Duration, handlersDone <-chan struct{}, stopOutbox context.CancelFunc, outboxDone <-chan struct{}, logger *slog.Logger) error {
+	logger.Info("Остановка бота")
+	deadline := time.After(timeout)
+
+	var err error
+	select {
+	case <-handlersDone:
+		select {
+		case <-closeBackground():
+		case <-deadline:
+			err = fmt.Errorf("фоновые задачи не завершились за %s", timeout)
+		}
+	case <-deadline:
+		closeBackground()
+		err = fmt.Errorf("обработка обновлений не завершилась за %s", timeout)
+	}
+
+	stopOutbox()
+	select {
+	case <-outboxDone:
+	case <-time.After(time.Second):
+		if err == nil {
+			err = errors.New("очередь исходящих сообщений не остановилась")
+		}
+	}
 
-	updates, err := bot.GetUpdatesChan(u)
 	if err != nil {
-		log.Fatalf("Критическая ошибка: не удалось получить канал обновлений: %s", err)
+		logger.Error("Бот остановлен с ошибкой", logging.Error, err)
+		return err
 	}
+	logger.Info("Бот остановлен")
+	return nil
+}
+
+// pollUpdates получает обновления методом getUpdates (long polling) с ожиданием pollTimeout
+// и передает их в канал, пока не будет отменен ctx. После ошибки запрос повторяется через
+// pollRetryDelay. Время последнего успешного запроса отслеживается задачей updatesJob.
+func pollUpdates(ctx context.Context, bot *tgbotapi.BotAPI, pollTimeout time.Duration, logger *slog.Logger) <-chan tgbotapi.Update {
+	updates := make(chan tgbotapi.Update, 100)
+	updatesJob = health.NewJob("updates", pollTimeout)
+
+	go func() {
+		defer close(updates)
+		defer updatesJob.Stopped()
+
+		config := tgbotapi.NewUpdate(0)
+		config.Timeout = int(pollTimeout / time.Second)
+		for ctx.Err() == nil {
+			batch, err := bot.GetUpdates(config)
+			if err != nil {
+				updatesJob.Failed(err)
+				logger.Error("Ошибка при получении обновлений", logging.Error, err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(pollRetryDelay):
+				}
+				continue
+			}
+			updatesJob.Succeeded()
+
+			for _, update := range batch {
+				if update.UpdateID >= config.Offset {
+					config.Offset = update.UpdateID + 1
+				}
+				select {
+				case updates <- update:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
 	return updates
 }
+
+// registerHealthChecks регистрирует проверки получения обновлений и актуальности каталога.
+// В режиме webhook обновления приходят только при действиях пользователей,
+// поэтому время с последнего обновления не проверяется.
+func registerHealthChecks(cfg *config.Config) {
+	if cfg.Transport == config.TransportPolling {
+		health.AddCheck(health.Readiness, "updates", func(ctx context.Context) (map[string]any, error) {
+			since, ok := updatesJob.SinceSuccess()
+			if !ok {
+				return nil, errors.New("обновления от Telegram еще не получены")
+			}
+			details := map[string]any{"seconds_since_success": since.Seconds()}
+			if since > 2*cfg.PollTimeout {
+				return details, fmt.Errorf("обновления от Telegram не получены за %s", since.Round(time.Second))
+			}
+			return details, nil
+		})
+	}
+
+	health.AddCheck(health.Readiness, "catalog", func(ctx context.Context) (map[string]any, error) {
+		count := len(beerCatalog.All())
+		age, ok := metrics.CatalogAge()
+		if !ok {
+			return map[string]any{"beers": count}, errors.New("каталог еще не загружен")
+		}
+		details := map[string]any{"beers": count, "age_seconds": age.Seconds()}
+		if age > cfg.CatalogMaxAge {
+			return details, fmt.Errorf("каталог не обновлялся %s", age.Round(time.Second))
+		}
+		return details, nil
+	})
+}
@@ -0,0 +1,499 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/models"
+	"beer_from_the_brewery/outbox"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	broadcastRate             = 10              // Сообщений рассылки в секунду: остаток общего лимита оставляем для ответов пользователям
+	broadcastProgressInterval = 5 * time.Second // Как часто обновлять сообщение о ходе рассылки
+	broadcastFailuresShown    = 20              // Сколько недоставленных сообщений показывать в /broadcast_status
+	broadcastCaptionLimit     = 1024            // Максимальная длина подписи к фото в Telegram
+)
+
+// broadcastDraft - рассылка, которую администратор составляет перед отправкой.
+type broadcastDraft struct {
+	broadcast     models.Broadcast
+	types         []string    // Типы пива, предложенные для выбора сегмента (в callback передается индекс)
+	previewFailed atomic.Bool // Предпросмотр не отправлен (например, из-за ошибки в разметке), рассылать нельзя
+}
+
+// handleBroadcastCommand обрабатывает команду администратора /broadcast, начиная составление рассылки.
+func handleBroadcastCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, message.Chat.ID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	delete(broadcastDrafts, message.Chat.ID)
+	waitingForBroadcast[message.Chat.ID] = true
+	sendMessage(bot, message.Chat.ID, loc.T("broadcast.compose_prompt"), "", nil, logger)
+}
+
+// handleBroadcastMessage принимает текст или фото с подписью для рассылки и показывает предпросмотр.
+// Кнопки задаются последними строками текста в формате "Текст | https://ссылка" или "Текст | beer:<ID пива>".
+func handleBroadcastMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+
+	broadcast := models.Broadcast{AuthorID: int64(message.From.ID)}
+	text := message.Text
+	if message.Photo != nil && len(*message.Photo) > 0 {
+		photos := *message.Photo
+		broadcast.PhotoFileID = photos[len(photos)-1].FileID // Фото наибольшего размера идет последним
+		text = message.Caption
+	}
+
+	body, buttons, badLine := parseBroadcastButtons(text)
+	if badLine != "" {
+		sendMessage(bot, message.Chat.ID, loc.T("broadcast.invalid_button", badLine), "", nil, logger)
+		return
+	}
+	if body == "" && broadcast.PhotoFileID == "" {
+		sendMessage(bot, message.Chat.ID, loc.T("broadcast.compose_prompt"), "", nil, logger)
+		return
+	}
+	if broadcast.PhotoFileID != "" && utf8.RuneCountInString(body) > broadcastCaptionLimit {
+		sendMessage(bot, message.Chat.ID, loc.T("broadcast.caption_too_long", broadcastCaptionLimit), "", nil, logger)
+		return
+	}
+	broadcast.Text = body
+	broadcast.Buttons = buttons
+
+	delete(waitingForBroadcast, message.Chat.ID)
+	draft := &broadcastDraft{broadcast: broadcast}
+	broadcastDrafts[message.Chat.ID] = draft
+
+	// Предпросмотр - ровно то сообщение, которое получат покупатели. Если его не удастся отправить,
+	// рассылку с тем же сообщением отправить тоже не получится
+	chatID := message.Chat.ID
+	sendRequest(chatID, broadcastMessage(chatID, loc, broadcast), func(error) {
+		draft.previewFailed.Store(true)
+		sendMessage(bot, chatID, loc.T("broadcast.preview_error"), "", nil, logger)
+	}, logger)
+	sendBroadcastControls(bot, chatID, loc, draft, db, logger)
+}
+
+// parseBroadcastButtons отделяет от текста рассылки строки с кнопками в конце текста.
+// Возвращает текст без кнопок, кнопки и первую строку с ошибкой (пустую, если ошибок нет).
+func parseBroadcastButtons(text string) (string, []models.BroadcastButton, string) {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	end := len(lines)
+	for end > 0 && strings.Contains(lines[end-1], "|") {
+		end--
+	}
+
+	var buttons []models.BroadcastButton
+	for _, line := range lines[end:] {
+		label, target, _ := strings.Cut(line, "|")
+		label, target = strings.TrimSpace(label), strings.TrimSpace(target)
+		button := models.BroadcastButton{Text: label}
+		switch {
+		case label == "":
+			return "", nil, line
+		case strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "http://"):
+			button.URL = target
+		case strings.HasPrefix(target, "beer:"):
+			beerID, err := strconv.Atoi(strings.TrimPrefix(target, "beer:"))
+			if err != nil || beerID <= 0 {
+				return "", nil, line
+			}
+			button.BeerID = beerID
+		default:
+			return "", nil, line
+		}
+		buttons = append(buttons, button)
+	}
+	return strings.TrimSpace(strings.Join(lines[:end], "\n")), buttons, ""
+}
+
+// broadcastMessage формирует сообщение рассылки для чата chatID. Кнопка отказа от рассылок
+// добавляется на языке получателя loc.
+func broadcastMessage(chatID int64, loc i18n.Localizer, broadcast models.Broadcast) tgbotapi.Chattable {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, button := range broadcast.Buttons {
+		if button.URL != "" {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL(button.Text, button.URL)))
+		} else {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(button.Text, fmt.Sprintf("add_to_cart:%d:1", button.BeerID))))
+		}
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(loc.T("broadcast.opt_out_button"), "news:off")))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	if broadcast.PhotoFileID != "" {
+		photo := tgbotapi.NewPhotoShare(chatID, broadcast.PhotoFileID)
+		photo.Caption = broadcast.Text
+		photo.ReplyMarkup = keyboard
+		return photo
+	}
+	msg := tgbotapi.NewMessage(chatID, broadcast.Text)
+	msg.ReplyMarkup = keyboard
+	return msg
+}
+
+// sendBroadcastControls показывает администратору сегмент и число получателей рассылки с кнопками управления.
+func sendBroadcastControls(bot *tgbotapi.BotAPI, chatID int64, loc i18n.Localizer, draft *broadcastDraft, db *sql.DB, logger *slog.Logger) {
+	count, err := database.CountBroadcastRecipients(logContext(logger), db, draft.broadcast.BeerType)
+	if err != nil {
+		logger.Error("Ошибка при подсчете получателей рассылки", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("broadcast.recipients_error"), "", nil, logger)
+		return
+	}
+
+	segment := loc.T("broadcast.segment_all")
+	if draft.broadcast.BeerType != "" {
+		segment = loc.T("broadcast.segment_type", draft.broadcast.BeerType)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("broadcast.choose_segment"), "broadcast_segment"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("broadcast.send"), "broadcast_send"),
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("broadcast.cancel"), "broadcast_cancel"),
+		),
+	)
+	sendMessage(bot, chatID, loc.N("broadcast.controls", count, segment), "", &keyboard, logger)
+}
+
+// handleBroadcastCallback обрабатывает кнопки управления рассылкой: выбор сегмента, отправку, отмену и остановку.
+func handleBroadcastCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	chatID := callbackQuery.Message.Chat.ID
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+	if !isAdmin(callbackQuery.From) {
+		sendMessage(bot, chatID, loc.T("common.unknown_action"), "", nil, logger)
+		return
+	}
+
+	if strings.HasPrefix(callbackQuery.Data, "broadcast_stop:") {
+		broadcastID, err := strconv.ParseInt(strings.TrimPrefix(callbackQuery.Data, "broadcast_stop:"), 10, 64)
+		if err != nil {
+			sendMessage(bot, chatID, loc.T("common.invalid_data"), "", nil, logger)
+			return
+		}
+		if cancel, ok := runningBroadcasts.Load(broadcastID); ok {
+			cancel.(context.CancelFunc)()
+			return
+		}
+		sendMessage(bot, chatID, loc.T("broadcast.not_running", broadcastID), "", nil, logger)
+		return
+	}
+
+	draft, ok := broadcastDrafts[chatID]
+	if !ok {
+		sendMessage(bot, chatID, loc.T("broadcast.no_draft"), "", nil, logger)
+		return
+	}
+
+	switch {
+	case callbackQuery.Data == "broadcast_segment":
+		draft.types = beerCatalog.Types()
+		var rows [][]tgbotapi.InlineKeyboardButton
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(loc.T("broadcast.segment_all"), "broadcast_type:all")))
+		for i, beerType := range draft.types {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(beerType, fmt.Sprintf("broadcast_type:%d", i))))
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+		sendMessage(bot, chatID, loc.T("broadcast.segment_prompt"), "", &keyboard, logger)
+
+	case strings.HasPrefix(callbackQuery.Data, "broadcast_type:"):
+		value := strings.TrimPrefix(callbackQuery.Data, "broadcast_type:")
+		if value == "all" {
+			draft.broadcast.BeerType = ""
+		} else {
+			index, err := strconv.Atoi(value)
+			if err != nil || index < 0 || index >= len(draft.types) {
+				sendMessage(bot, chatID, loc.T("common.invalid_data"), "", nil, logger)
+				return
+			}
+			draft.broadcast.BeerType = draft.types[index]
+		}
+		sendBroadcastControls(bot, chatID, loc, draft, db, logger)
+
+	case callbackQuery.Data == "broadcast_send":
+		delete(broadcastDrafts, chatID)
+		if draft.previewFailed.Load() {
+			sendMessage(bot, chatID, loc.T("broadcast.preview_error"), "", nil, logger)
+			return
+		}
+		broadcastID, err := database.CreateBroadcast(logContext(logger), db, draft.broadcast)
+		if err != nil {
+			logger.Error("Ошибка при создании рассылки", logging.Error, err)
+			sendMessage(bot, chatID, loc.T("broadcast.create_error"), "", nil, logger)
+			return
+		}
+		draft.broadcast.ID = broadcastID
+		logger.Info("Администратор запустил рассылку", "broadcast_id", broadcastID, "admin", describeUser(callbackQuery.From))
+		goBackground(func() { runBroadcast(botContext, bot, db, draft.broadcast, chatID, logger) })
+
+	case callbackQuery.Data == "broadcast_cancel":
+		delete(broadcastDrafts, chatID)
+		sendMessage(bot, chatID, loc.T("broadcast.cancelled"), "", nil, logger)
+
+	default:
+		sendMessage(bot, chatID, loc.T("common.unknown_action"), "", nil, logger)
+	}
+}
+
+// runBroadcast отправляет рассылку получателям, которым она еще не доставлена, с частотой broadcastRate,
+// сохраняет результат доставки каждому получателю и сообщает о ходе рассылки в чат администратора.
+// Рассылку можно остановить кнопкой под сообщением о ходе рассылки. Отмена ctx (остановка бота)
+// прерывает рассылку, не завершая ее: неотправленные сообщения будут отправлены после запуска.
+func runBroadcast(ctx context.Context, bot *tgbotapi.BotAPI, db *sql.DB, broadcast models.Broadcast, adminChatID int64, logger *slog.Logger) {
+	logger = logger.With("broadcast_id", broadcast.ID)
+	shutdown := ctx
+	ctx, cancel := context.WithCancel(logging.NewContext(ctx, logger))
+	defer cancel()
+	runningBroadcasts.Store(broadcast.ID, cancel)
+	defer runningBroadcasts.Delete(broadcast.ID)
+
+	loc := userLocalizer(db, adminChatID)
+	recipients, err := database.TakePendingDeliveries(ctx, db, broadcast.ID)
+	if err != nil {
+		logger.Error("Ошибка при получении получателей рассылки", logging.Error, err)
+		sendNotification(bot, adminChatID, loc.T("broadcast.recipients_error"), "", nil, logger)
+		return
+	}
+
+	stopKeyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(loc.T("broadcast.stop"), fmt.Sprintf("broadcast_stop:%d", broadcast.ID)),
+	))
+	progress := tgbotapi.NewMessage(adminChatID, loc.T("broadcast.progress", broadcast.ID, 0, len(recipients), 0))
+	progress.ReplyMarkup = stopKeyboard
+	progressMessage := outgoing.Send(ctx, adminChatID, progress, outbox.Interactive).Message
+
+	var delivered, failed atomic.Int64
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(time.Second / broadcastRate)
+	defer ticker.Stop()
+	lastProgress := time.Now()
+
+	stopped := false
+	for _, userID := range recipients {
+		select {
+		case <-ctx.Done():
+			stopped = true
+		case <-ticker.C:
+		}
+		if stopped {
+			break
+		}
+
+		result := outgoing.Enqueue(userID, broadcastMessage(userID, userLocalizer(db, userID), broadcast), outbox.Bulk)
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			if recordBroadcastDelivery(db, broadcast.ID, userID, <-result, logger) {
+				delivered.Add(1)
+			} else {
+				failed.Add(1)
+			}
+		}(userID)
+
+		if time.Since(lastProgress) >= broadcastProgressInterval && progressMessage.MessageID != 0 {
+			lastProgress = time.Now()
+			edit := tgbotapi.NewEditMessageText(adminChatID, progressMessage.MessageID,
+				loc.T("broadcast.progress", broadcast.ID, delivered.Load()+failed.Load(), len(recipients), failed.Load()))
+			edit.ReplyMarkup = &stopKeyboard
+			outgoing.Enqueue(adminChatID, edit, outbox.Interactive)
+		}
+	}
+	// Дожидаемся результатов уже поставленных в очередь сообщений
+	wg.Wait()
+
+	if shutdown.Err() != nil {
+		logger.Info("Рассылка прервана остановкой бота", "delivered", delivered.Load(), "failed", failed.Load())
+		return
+	}
+
+	status := models.BroadcastFinished
+	if stopped {
+		status = models.BroadcastCancelled
+	}
+	if err := database.FinishBroadcast(logContext(logger), db, broadcast.ID, status); err != nil {
+		logger.Error("Ошибка при завершении рассылки", logging.Error, err)
+	}
+	logger.Info("Рассылка завершена", "status", status, "delivered", delivered.Load(), "failed", failed.Load())
+
+	stats, err := database.GetBroadcastStats(logContext(logger), db, broadcast.ID)
+	if err != nil {
+		logger.Error("Ошибка при получении итогов рассылки", logging.Error, err)
+		return
+	}
+	report := loc.T("broadcast.finished", broadcast.ID, stats.Sent, stats.Failed, stats.Skipped)
+	if stopped {
+		report = loc.T("broadcast.stopped", broadcast.ID, stats.Sent, stats.Failed, stats.Pending)
+	}
+	if progressMessage.MessageID != 0 {
+		// Заменяем сообщение о ходе рассылки итогами, убирая кнопку остановки
+		edit := tgbotapi.NewEditMessageText(adminChatID, progressMessage.MessageID, report)
+		result := outgoing.Send(botContext, adminChatID, edit, outbox.Interactive)
+		if result.Err == nil {
+			return
+		}
+		logger.Error("Ошибка при отправке итогов рассылки", "attempts", result.Attempts, logging.Error, result.Err)
+	}
+	sendNotification(bot, adminChatID, report, "", nil, logger)
+}
+
+// recordBroadcastDelivery сохраняет результат доставки рассылки получателю userID.
+// Возвращает true, если сообщение доставлено.
+// Сообщения, не отправленные из-за остановки очереди, остаются ожидающими отправки.
+func recordBroadcastDelivery(db *sql.DB, broadcastID, userID int64, result outbox.Result, logger *slog.Logger) bool {
+	if errors.Is(result.Err, outbox.ErrStopped) {
+		return false
+	}
+	status, errText := models.DeliverySent, ""
+	if result.Err != nil {
+		status, errText = models.DeliveryFailed, result.Err.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(logContext(logger), 5*time.Second)
+	defer cancel()
+	if err := database.SetDeliveryResult(ctx, db, broadcastID, userID, status, errText, result.Attempts); err != nil {
+		logger.Error("Ошибка при сохранении результата рассылки", "recipient_id", userID, logging.Error, err)
+	}
+	return result.Err == nil
+}
+
+// handleBroadcastStatusCommand обрабатывает команду администратора /broadcast_status <ID рассылки>:
+// показывает итоги рассылки и получателей, которым сообщение не доставлено.
+func handleBroadcastStatusCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, message.Chat.ID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	broadcastID, err := strconv.ParseInt(strings.TrimSpace(message.CommandArguments()), 10, 64)
+	if err != nil {
+		sendMessage(bot, message.Chat.ID, loc.T("broadcast.status_usage"), "", nil, logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(logContext(logger), 5*time.Second)
+	defer cancel()
+
+	broadcast, err := database.GetBroadcast(ctx, db, broadcastID)
+	if err != nil {
+		logger.Error("Ошибка при получении рассылки", "broadcast_id", broadcastID, logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("broadcast.status_error"), "", nil, logger)
+		return
+	}
+	if broadcast == nil {
+		sendMessage(bot, message.Chat.ID, loc.T("broadcast.not_found", broadcastID), "", nil, logger)
+		return
+	}
+	stats, err := database.GetBroadcastStats(ctx, db, broadcastID)
+	if err != nil {
+		logger.Error("Ошибка при получении итогов рассылки", "broadcast_id", broadcastID, logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("broadcast.status_error"), "", nil, logger)
+		return
+	}
+	failures, err := database.GetFailedDeliveries(ctx, db, broadcastID, broadcastFailuresShown)
+	if err != nil {
+		logger.Error("Ошибка при получении недоставленных сообщений рассылки", "broadcast_id", broadcastID, logging.Error, err)
+	}
+
+	var text strings.Builder
+	text.WriteString(loc.T("broadcast.status", broadcast.ID, loc.T("broadcast.state."+broadcast.Status),
+		stats.Total, stats.Sent, stats.Failed, stats.Skipped, stats.Pending))
+	if len(failures) > 0 {
+		text.WriteString("\n\n" + loc.T("broadcast.failures_title") + "\n")
+		for _, delivery := range failures {
+			text.WriteString(loc.T("broadcast.failure_line", delivery.UserID, delivery.Error) + "\n")
+		}
+	}
+	sendMessage(bot, message.Chat.ID, text.String(), "", nil, logger)
+}
+
+// handleNewsCommand обрабатывает команду /news: показывает, подписан ли пользователь на рассылки,
+// и кнопку для изменения подписки.
+func handleNewsCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+
+	ctx, cancel := context.WithTimeout(logContext(logger), 5*time.Second)
+	defer cancel()
+
+	optOut, err := database.GetBroadcastOptOut(ctx, db, int64(message.From.ID))
+	if err != nil {
+		logger.Error("Ошибка при получении подписки на рассылки", logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("news.error"), "", nil, logger)
+		return
+	}
+
+	text, button := loc.T("news.subscribed"), tgbotapi.NewInlineKeyboardButtonData(loc.T("news.unsubscribe"), "news:off")
+	if optOut {
+		text, button = loc.T("news.unsubscribed"), tgbotapi.NewInlineKeyboardButtonData(loc.T("news.subscribe"), "news:on")
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(button))
+	sendMessage(bot, message.Chat.ID, text, "", &keyboard, logger)
+}
+
+// handleNewsCallback обрабатывает кнопки подписки на рассылки ("news:on") и отказа от них ("news:off").
+func handleNewsCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	chatID := callbackQuery.Message.Chat.ID
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+
+	var optOut bool
+	switch callbackQuery.Data {
+	case "news:off":
+		optOut = true
+	case "news:on":
+		optOut = false
+	default:
+		sendMessage(bot, chatID, loc.T("common.invalid_data"), "", nil, logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(logContext(logger), 5*time.Second)
+	defer cancel()
+
+	if err := database.SetBroadcastOptOut(ctx, db, int64(callbackQuery.From.ID), optOut); err != nil {
+		logger.Error("Ошибка при изменении подписки на рассылки", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("news.error"), "", nil, logger)
+		return
+	}
+	logger.Info("Пользователь изменил подписку на рассылки", "opt_out", optOut)
+
+	if optOut {
+		sendMessage(bot, chatID, loc.T("news.unsubscribed_done"), "", nil, logger)
+	} else {
+		sendMessage(bot, chatID, loc.T("news.subscribed_done"), "", nil, logger)
+	}
+}
+
+// resumeBroadcasts продолжает рассылки, прерванные перезапуском бота.
+func resumeBroadcasts(bot *tgbotapi.BotAPI, db *sql.DB, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(logContext(logger), 5*time.Second)
+	defer cancel()
+
+	broadcasts, err := database.GetBroadcastsInProgress(ctx, db)
+	if err != nil {
+		logger.Error("Ошибка при получении незавершенных рассылок", logging.Error, err)
+		return
+	}
+	for _, broadcast := range broadcasts {
+		logger.Info("Продолжаем рассылку", "broadcast_id", broadcast.ID)
+		goBackground(func() { runBroadcast(botContext, bot, db, broadcast, broadcast.AuthorID, logger) })
+	}
+}
@@ -2,62 +2,68 @@ package telegram
 
 import (
 	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/logging"
 	"beer_from_the_brewery/models"
-	"context"
+	"beer_from_the_brewery/render"
 	"database/sql"
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
 // handleCartCallback обрабатывает команду /cart, отображая содержимое корзины пользователя.
-func handleCartCallback(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *log.Logger) {
+func handleCartCallback(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
 	loadCart, ok := carts.Load(message.Chat.ID)
 
 	if !ok || loadCart == nil {
-		sendMessage(bot, message.Chat.ID, "Ваша корзина пуста.", "", nil, logger)
+		sendMessage(bot, message.Chat.ID, loc.T("cart.empty"), "", nil, logger)
 		return
 	}
 
 	cart := loadCart.(map[int]models.CartItem)
 
 	if len(cart) == 0 {
-		sendMessage(bot, message.Chat.ID, "Ваша корзина пуста.", "", nil, logger)
+		sendMessage(bot, message.Chat.ID, loc.T("cart.empty"), "", nil, logger)
 		return
 	}
 
-	var cartText string
-	var totalPrice float64
+	var summary render.Cart
+
+	beerIDs := make([]int, 0, len(cart))
+	for beerID := range cart {
+		beerIDs = append(beerIDs, beerID)
+	}
+	cartBeers, err := beerCatalog.GetMany(logContext(logger), db, beerIDs)
+	if err != nil {
+		logger.Error("Ошибка при получении данных о пиве", "beer_ids", beerIDs, logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("common.beer_fetch_error"), "", nil, logger)
+		return
+	}
 
 	for beerID, cartItem := range cart {
-		beer, err := database.GetBeerByID(context.Background(), db, beerID)
-		if err != nil {
-			logger.Printf("Ошибка при получении данных о пиве (ID: %d): %s", beerID, err.Error())
-			sendMessage(bot, message.Chat.ID, "Ошибка при получении данных о пиве.", "", nil, logger)
-			return
-		}
-		if beer == nil {
-			sendMessage(bot, message.Chat.ID, "Пиво не найдено.", "", nil, logger)
+		beer, ok := cartBeers[beerID]
+		if !ok {
+			sendMessage(bot, message.Chat.ID, loc.T("common.beer_not_found"), "", nil, logger)
 			return
 		}
 		beerPrice := beer.Price * float64(cartItem.Quantity)
-		cartText += fmt.Sprintf("*%s*\nКоличество: %d\nЦена: %.2f\n\n", beer.Name, cartItem.Quantity, beerPrice)
-		totalPrice += beerPrice
+		summary.Lines = append(summary.Lines, render.CartLine{Beer: beer, Quantity: cartItem.Quantity, Sum: beerPrice})
+		summary.Total += beerPrice
 	}
 
-	cartText += fmt.Sprintf("\nОбщая стоимость: %.2f", totalPrice)
-
-	keyboard := createCartKeyboard() // Создаем клавиатуру для действий с корзиной
-	sendMessage(bot, message.Chat.ID, cartText, "Markdown", &keyboard, logger)
+	keyboard := createCartKeyboard(loc) // Создаем клавиатуру для действий с корзиной
+	sendRendered(bot, message.Chat.ID, loc, "cart", summary, &keyboard, logger)
 
 }
 
 // handleCheckoutCallback обрабатывает callback-запрос на оформление заказа.
-func handleCheckoutCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *log.Logger) {
+func handleCheckoutCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
 	loadCart, ok := carts.Load(callbackQuery.Message.Chat.ID)
 	if !ok || loadCart == nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Ваша корзина пуста. Нечего оформлять.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("cart.empty_checkout"), "", nil, logger)
 		return
 	}
 	cart := loadCart.(map[int]models.CartItem)
@@ -67,22 +73,33 @@ func handleCheckoutCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.Callba
 		cartItems = append(cartItems, cartItem)
 	}
 
-	err := database.CreateOrder(context.Background(), db, callbackQuery.Message.Chat.ID, cartItems)
+	orderID, err := database.CreateOrder(logContext(logger), db, int64(callbackQuery.From.ID), cartItems)
+	var stockErr *database.InsufficientStockError
+	if errors.As(err, &stockErr) {
+		name := loc.T("common.unknown_beer", stockErr.BeerID)
+		if beer, ok := beerCatalog.Cached(stockErr.BeerID); ok {
+			name = beer.Name
+		}
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("order.not_enough_stock", name, stockErr.Available), "", nil, logger)
+		return
+	}
 	if err != nil {
-		logger.Printf("Ошибка при оформлении заказа (ChatID: %d): %s", callbackQuery.Message.Chat.ID, err.Error())
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Ошибка при оформлении заказа. Пожалуйста, попробуйте позже.", "", nil, logger)
+		logger.Error("Ошибка при оформлении заказа", logging.Error, err)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("order.checkout_error"), "", nil, logger)
 		return
 	}
+	logger = logger.With(logging.OrderID, orderID)
+	logger.Info("Оформлен заказ", "customer", describeUser(callbackQuery.From))
 
 	carts.Delete(callbackQuery.Message.Chat.ID) // Очищаем корзину после успешного заказа
-	keyboard := createBeerKeyboard()
-	sendMessage(bot, callbackQuery.Message.Chat.ID, "Спасибо за ваш заказ!", "", &keyboard, logger)
+	keyboard := createOrderPlacedKeyboard(loc, orderID)
+	sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("order.placed", orderID), "", &keyboard, logger)
 
 }
 
 // handleClearCartCallback обрабатывает callback-запрос на очистку корзины.
-func handleClearCartCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, logger *log.Logger) {
-
+func handleClearCartCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
 	carts.Delete(callbackQuery.Message.Chat.ID)
-	sendMessage(bot, callbackQuery.Message.Chat.ID, "Корзина очищена.", "", nil, logger)
+	sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("cart.cleared"), "", nil, logger)
 }
@@ -0,0 +1,259 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/catalog"
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/models"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	catalogFileLimit      = 2 << 20          // Максимальный размер файла каталога в байтах
+	catalogFileTimeout    = 30 * time.Second // Время на загрузку файла каталога из Telegram
+	catalogPreviewLines   = 30               // Сколько добавляемых и изменяемых сортов пива показывать в предпросмотре
+	catalogProblemsShown  = 20               // Сколько ошибок в файле показывать администратору
+	catalogImportCommand  = "/import_catalog"
+	catalogExportFileName = "catalog.csv"
+)
+
+// handleImportCatalogCommand обрабатывает команду администратора /import_catalog,
+// после которой бот ожидает CSV-файл каталога.
+func handleImportCatalogCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, message.Chat.ID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	delete(catalogImports, message.Chat.ID)
+	waitingForCatalogFile[message.Chat.ID] = true
+	sendMessage(bot, message.Chat.ID, loc.T("catalog_import.prompt"), "", nil, logger)
+}
+
+// isCatalogFile сообщает, что сообщение - файл каталога для импорта: документ от администратора,
+// отправленный после /import_catalog или с этой командой в подписи.
+func isCatalogFile(message *tgbotapi.Message) bool {
+	if !isAdmin(message.From) {
+		return false
+	}
+	return waitingForCatalogFile[message.Chat.ID] ||
+		message.Document != nil && strings.HasPrefix(strings.TrimSpace(message.Caption), catalogImportCommand)
+}
+
+// handleCatalogFileMessage проверяет присланный CSV-файл каталога и показывает, какое пиво
+// будет добавлено и изменено. Изменения применяются только после подтверждения кнопкой.
+func handleCatalogFileMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	chatID := message.Chat.ID
+	loc := messageLocalizer(db, message)
+	if message.Document == nil {
+		sendMessage(bot, chatID, loc.T("catalog_import.not_document"), "", nil, logger)
+		return
+	}
+	delete(waitingForCatalogFile, chatID)
+
+	if message.Document.FileSize > catalogFileLimit {
+		sendMessage(bot, chatID, loc.T("catalog_import.too_large", catalogFileLimit>>10), "", nil, logger)
+		return
+	}
+	data, err := downloadFile(bot, message.Document.FileID, catalogFileLimit)
+	if err != nil {
+		logger.Error("Ошибка при загрузке файла каталога", "file_name", message.Document.FileName, logging.Error, err)
+		sendMessage(bot, chatID, loc.T("catalog_import.download_error"), "", nil, logger)
+		return
+	}
+
+	rows, err := catalog.ReadCSV(bytes.NewReader(data))
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("catalog_import.invalid", describeImportError(err)), "", nil, logger)
+		return
+	}
+	plan, err := catalog.PlanImport(logContext(logger), db, rows)
+	var importErr *catalog.ImportError
+	if errors.As(err, &importErr) {
+		sendMessage(bot, chatID, loc.T("catalog_import.invalid", describeImportError(err)), "", nil, logger)
+		return
+	}
+	if err != nil {
+		logger.Error("Ошибка при сравнении файла с каталогом", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("catalog_import.check_error"), "", nil, logger)
+		return
+	}
+	logger.Info("Файл каталога проверен", "file_name", message.Document.FileName,
+		"created", len(plan.Create), "updated", len(plan.Update), "unchanged", len(plan.Unchanged))
+
+	if plan.Empty() {
+		sendMessage(bot, chatID, loc.T("catalog_import.no_changes", len(plan.Unchanged)), "", nil, logger)
+		return
+	}
+	catalogImports[chatID] = rows
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("catalog_import.apply"), "catalog_import:apply"),
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("catalog_import.cancel"), "catalog_import:cancel"),
+		),
+	)
+	sendMessage(bot, chatID, formatImportPlan(loc, plan), "", &keyboard, logger)
+}
+
+// describeImportError возвращает текст ошибки импорта; из длинного списка ошибок в строках
+// показываются первые catalogProblemsShown.
+func describeImportError(err error) string {
+	var importErr *catalog.ImportError
+	if !errors.As(err, &importErr) || len(importErr.Problems) <= catalogProblemsShown {
+		return err.Error()
+	}
+	shown := &catalog.ImportError{Problems: importErr.Problems[:catalogProblemsShown]}
+	return fmt.Sprintf("%s\n  … (+%d)", shown.Error(), len(importErr.Problems)-catalogProblemsShown)
+}
+
+// formatImportPlan описывает, какое пиво будет добавлено и изменено при импорте.
+func formatImportPlan(loc i18n.Localizer, plan *catalog.ImportPlan) string {
+	lines := []string{loc.T("catalog_import.preview", len(plan.Create), len(plan.Update), len(plan.Unchanged))}
+	shown := 0
+	for _, beer := range plan.Create {
+		if shown == catalogPreviewLines {
+			break
+		}
+		lines = append(lines, loc.T("catalog_import.created_line", beer.Name, beer.Price, beer.Quantity))
+		shown++
+	}
+	for _, change := range plan.Update {
+		if shown == catalogPreviewLines {
+			break
+		}
+		var changes []string
+		for _, column := range change.Columns {
+			changes = append(changes, fmt.Sprintf("%s: %s → %s", column,
+				columnValue(change.Before, column), columnValue(change.After, column)))
+		}
+		lines = append(lines, loc.T("catalog_import.updated_line", change.After.ID, change.After.Name, strings.Join(changes, "; ")))
+		shown++
+	}
+	if hidden := len(plan.Create) + len(plan.Update) - shown; hidden > 0 {
+		lines = append(lines, loc.T("catalog_import.more", hidden))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// columnValue возвращает значение столбца файла каталога для предпросмотра импорта.
+func columnValue(beer models.Beer, column string) string {
+	value := catalog.ColumnValue(beer, column)
+	if value == "" {
+		return "—"
+	}
+	if runes := []rune(value); len(runes) > 40 {
+		value = string(runes[:40]) + "…"
+	}
+	return value
+}
+
+// handleCatalogImportCallback применяет или отменяет проверенный импорт каталога.
+// Перед применением файл заново сравнивается с каталогом, чтобы учесть изменения после проверки.
+func handleCatalogImportCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	chatID := callbackQuery.Message.Chat.ID
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+	if !isAdmin(callbackQuery.From) {
+		sendMessage(bot, chatID, loc.T("common.unknown_action"), "", nil, logger)
+		return
+	}
+
+	rows, ok := catalogImports[chatID]
+	if !ok {
+		sendMessage(bot, chatID, loc.T("catalog_import.no_pending"), "", nil, logger)
+		return
+	}
+	delete(catalogImports, chatID)
+
+	switch callbackQuery.Data {
+	case "catalog_import:apply":
+		plan, err := catalog.PlanImport(logContext(logger), db, rows)
+		if err == nil {
+			err = catalog.ApplyImport(logContext(logger), db, plan)
+		}
+		if err != nil {
+			logger.Error("Ошибка при импорте каталога", logging.Error, err)
+			sendMessage(bot, chatID, loc.T("catalog_import.apply_error", describeImportError(err)), "", nil, logger)
+			return
+		}
+		logger.Info("Администратор импортировал каталог", "created", len(plan.Create), "updated", len(plan.Update),
+			"admin", describeUser(callbackQuery.From))
+		sendMessage(bot, chatID, loc.T("catalog_import.applied", len(plan.Create), len(plan.Update)), "", nil, logger)
+
+	case "catalog_import:cancel":
+		sendMessage(bot, chatID, loc.T("catalog_import.cancelled"), "", nil, logger)
+
+	default:
+		sendMessage(bot, chatID, loc.T("common.unknown_action"), "", nil, logger)
+	}
+}
+
+// handleExportCatalogCommand обрабатывает команду администратора /export_catalog,
+// отправляя каталог CSV-файлом в формате импорта.
+func handleExportCatalogCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, message.Chat.ID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	beers, err := database.GetBeers(logContext(logger), db)
+	var buf bytes.Buffer
+	if err == nil {
+		err = catalog.WriteCSV(&buf, beers)
+	}
+	if err != nil {
+		logger.Error("Ошибка при выгрузке каталога", logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("catalog_export.error"), "", nil, logger)
+		return
+	}
+	sendDocument(message.Chat.ID, catalogExportFileName, buf.Bytes(), loc.T("catalog_export.caption", len(beers)), logger)
+}
+
+// downloadFile загружает файл, полученный ботом, не больше limit байт.
+func downloadFile(bot *tgbotapi.BotAPI, fileID string, limit int) ([]byte, error) {
+	fileURL, err := bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении адреса файла: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(botContext, catalogFileTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		// Адрес файла содержит токен бота, поэтому в ошибку попадает только ее причина
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("ошибка при загрузке файла: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ошибка при загрузке файла: %s", response.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при загрузке файла: %w", err)
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("файл больше %d байт", limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,85 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/logging"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// handleFavoritesCallback обрабатывает команду "Избранное", выводя сохраненное пиво с актуальными ценой и остатком.
+// Избранное принадлежит пользователю (message.From), а не чату.
+func handleFavoritesCallback(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	favoriteBeers, err := database.GetFavoriteBeers(logContext(logger), db, int64(message.From.ID))
+	if err != nil {
+		logger.Error("Ошибка при получении избранного", logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("favorites.fetch_error"), "", nil, logger)
+		return
+	}
+
+	if len(favoriteBeers) == 0 {
+		sendMessage(bot, message.Chat.ID, loc.T("favorites.empty"), "", nil, logger)
+		return
+	}
+
+	var beerRows [][]tgbotapi.InlineKeyboardButton
+	for _, beer := range favoriteBeers {
+		var row []tgbotapi.InlineKeyboardButton
+		if beer.Quantity > 0 {
+			// Добавление в один клик: сразу подтверждаем одну штуку без выбора количества
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(loc.T("favorites.add_to_cart", beer.Name), fmt.Sprintf("confirm_add:%d:1", beer.ID)))
+		} else {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(loc.T("card.notify_stock", beer.Name), fmt.Sprintf("notify_stock:%d", beer.ID)))
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(loc.T("favorites.remove"), fmt.Sprintf("toggle_favorite:%d", beer.ID)))
+		beerRows = append(beerRows, row)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(beerRows...)
+	sendRendered(bot, message.Chat.ID, loc, "beer_list", favoriteBeers, &keyboard, logger)
+}
+
+// handleToggleFavoriteCallback обрабатывает callback-запрос на добавление пива в избранное или удаление из него.
+func handleToggleFavoriteCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+	data := strings.Split(callbackQuery.Data, ":")
+	if len(data) != 2 {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_data"), "", nil, logger)
+		return
+	}
+
+	beerID, err := strconv.Atoi(data[1])
+	if err != nil {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_beer_id"), "", nil, logger)
+		return
+	}
+
+	beer, err := beerCatalog.Get(logContext(logger), db, beerID)
+	if err != nil {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.beer_fetch_error"), "", nil, logger)
+		return
+	}
+	if beer == nil {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.beer_not_found"), "", nil, logger)
+		return
+	}
+
+	added, err := database.ToggleFavorite(logContext(logger), db, int64(callbackQuery.From.ID), beerID)
+	if err != nil {
+		logger.Error("Ошибка при изменении избранного", "beer_id", beerID, logging.Error, err)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("favorites.toggle_error"), "", nil, logger)
+		return
+	}
+
+	if added {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("favorites.added", beer.Name), "", nil, logger)
+	} else {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("favorites.removed", beer.Name), "", nil, logger)
+	}
+}
@@ -1,13 +1,14 @@
 package telegram
 
 import (
-	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/metrics"
 	"beer_from_the_brewery/models"
-	"beer_from_the_brewery/utils"
 	"context"
-	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
+	"time"
 
 	"database/sql"
 	"strings"
@@ -15,18 +16,114 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
-// handleCommand обрабатывает команды, отправленные боту.
-func handleCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *log.Logger) {
+// handleUpdate обрабатывает обновление Telegram: сохраняет профиль пользователя и передает
+// обновление обработчику команды, кнопки или сообщения. Все записи журнала, сделанные при
+// обработке, содержат ID обновления, чата и пользователя (см. updateLogger).
+func handleUpdate(bot *tgbotapi.BotAPI, update tgbotapi.Update, db *sql.DB, logger *slog.Logger) {
+	logger = updateLogger(logger, update)
+	start := time.Now()
+
+	trackUser(db, update, logger)
+
+	updateType, handler := "other", "none"
+	if update.Message != nil && update.Message.IsCommand() {
+		updateType, handler = "command", handleCommand(bot, update.Message, db, logger)
+	} else if update.CallbackQuery != nil {
+		updateType, handler = "callback_query", handleCallbackQuery(bot, update.CallbackQuery, db, logger)
+	} else if update.Message != nil && !update.Message.IsCommand() {
+		updateType, handler = "message", handleMessage(bot, update.Message, db, logger)
+	}
+
+	duration := time.Since(start)
+	metrics.Updates.With(updateType, handler).Inc()
+	metrics.HandlerDuration.With(handler).Observe(duration.Seconds())
+	logger.Debug("Обновление обработано", logging.Handler, handler, "duration", duration)
+}
+
+// updateLogger возвращает логгер, добавляющий к записям ID обновления, а также ID чата
+// и пользователя, от которого пришло обновление.
+func updateLogger(logger *slog.Logger, update tgbotapi.Update) *slog.Logger {
+	attrs := []any{logging.UpdateID, update.UpdateID}
+	switch {
+	case update.Message != nil:
+		attrs = append(attrs, logging.ChatID, update.Message.Chat.ID)
+		if update.Message.From != nil {
+			attrs = append(attrs, logging.UserID, update.Message.From.ID)
+		}
+	case update.CallbackQuery != nil:
+		if update.CallbackQuery.Message != nil {
+			attrs = append(attrs, logging.ChatID, update.CallbackQuery.Message.Chat.ID)
+		}
+		attrs = append(attrs, logging.UserID, update.CallbackQuery.From.ID)
+	}
+	return logger.With(attrs...)
+}
+
+// logContext возвращает контекст для запросов к базе данных, передающий в пакет database логгер обработчика.
+func logContext(logger *slog.Logger) context.Context {
+	return logging.NewContext(context.Background(), logger)
+}
+
+// handleCommand обрабатывает команды, отправленные боту, и возвращает имя обработчика для метрик.
+func handleCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) (handler string) {
+	handler = "/" + message.Command()
+	logger = logger.With(logging.Handler, handler)
 	switch message.Command() {
 	case "start":
-		handleStartCommand(bot, message)
+		handleStartCommand(bot, message, db, logger)
+	case "language":
+		handleLanguageCommand(bot, message, db, logger)
+	case "orders":
+		handleOrdersCallback(bot, message, db, logger)
+	case "subscriptions":
+		handleSubscriptionsCommand(bot, message, db, logger)
+	case "pause_sub":
+		handleSubscriptionCommand(bot, message, "pause", db, logger)
+	case "resume_sub":
+		handleSubscriptionCommand(bot, message, "resume", db, logger)
+	case "cancel_sub":
+		handleSubscriptionCommand(bot, message, "cancel", db, logger)
+	case "restock":
+		handleRestockCommand(bot, message, db, logger)
+	case "delivered":
+		handleDeliveredCommand(bot, message, db, logger)
+	case "reviews":
+		handleModerateCommand(bot, message, db, logger)
+	case "broadcast":
+		handleBroadcastCommand(bot, message, db, logger)
+	case "broadcast_status":
+		handleBroadcastStatusCommand(bot, message, db, logger)
+	case "news":
+		handleNewsCommand(bot, message, db, logger)
+	case "import_catalog":
+		handleImportCatalogCommand(bot, message, db, logger)
+	case "export_catalog":
+		handleExportCatalogCommand(bot, message, db, logger)
+	case "export_orders":
+		handleExportOrdersCommand(bot, message, db, logger)
+	case "report":
+		handleReportCommand(bot, message, db, logger)
+	case "lowstock":
+		handleLowStockCommand(bot, message, db, logger)
+	case "threshold":
+		handleThresholdCommand(bot, message, db, logger)
+	case "status":
+		handleStatusCommand(bot, message, db, logger)
 	default:
-		sendMessage(bot, message.Chat.ID, "Неизвестная команда.", "", nil, logger)
+		// Неизвестные команды объединяются, чтобы число обработчиков в метриках не зависело от ввода пользователей
+		handler = "unknown_command"
+		sendMessage(bot, message.Chat.ID, messageLocalizer(db, message).T("common.unknown_command"), "", nil, logger)
 	}
+	return handler
 }
 
 // handleCallbackQuery обрабатывает callback-запросы от inline-клавиатур.
-func handleCallbackQuery(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *log.Logger) {
+// Возвращает имя обработчика для метрик.
+func handleCallbackQuery(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) (handler string) {
+	// Имя обработчика - действие кнопки без параметров (например, "add_to_cart" для "add_to_cart:5:1")
+	action, _, _ := strings.Cut(callbackQuery.Data, ":")
+	handler = "callback:" + action
+	logger = logger.With(logging.Handler, handler)
 	switch {
 	case strings.HasPrefix(callbackQuery.Data, "add_to_cart:"):
 		handleAddToCartCallback(bot, callbackQuery, db, logger)
@@ -34,81 +131,131 @@ func handleCallbackQuery(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQ
 		handleAdjustQuantityCallback(bot, callbackQuery, db, logger)
 	case strings.HasPrefix(callbackQuery.Data, "confirm_add:"):
 		handleConfirmAddCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "toggle_favorite:"):
+		handleToggleFavoriteCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "notify_stock:"):
+		handleNotifyStockCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "subscribe_cart"):
+		handleSubscribeCartCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "subscription:"):
+		handleSubscriptionActionCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "reorder:"):
+		handleReorderCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "rate:"):
+		handleRateCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "reviews:"):
+		handleReviewsCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "moderate_review:"):
+		handleModerateReviewCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "set_language:"):
+		handleSetLanguageCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "broadcast_"):
+		handleBroadcastCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "news:"):
+		handleNewsCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "catalog_import:"):
+		handleCatalogImportCallback(bot, callbackQuery, db, logger)
+	case strings.HasPrefix(callbackQuery.Data, "order_status:"):
+		handleOrderStatusCallback(bot, callbackQuery, db, logger)
+	case callbackQuery.Data == "skip_review":
+		handleSkipReviewCallback(bot, callbackQuery, db, logger)
 	case callbackQuery.Data == "checkout":
 		handleCheckoutCallback(bot, callbackQuery, db, logger)
 	case callbackQuery.Data == "clear_cart":
-		handleClearCartCallback(bot, callbackQuery, logger)
+		handleClearCartCallback(bot, callbackQuery, db, logger)
 	case callbackQuery.Data == "beer":
-		handleBeerCallback(bot, callbackQuery.Message, db, logger)
+		handleBeerCallback(bot, callbackMessage(callbackQuery), db, logger)
 	case callbackQuery.Data == "search":
-		handleSearchCallback(bot, callbackQuery.Message)
+		handleSearchCallback(bot, callbackMessage(callbackQuery), db, logger)
 	case callbackQuery.Data == "cart":
-		handleCartCallback(bot, callbackQuery.Message, db, logger)
+		handleCartCallback(bot, callbackMessage(callbackQuery), db, logger)
+	case callbackQuery.Data == "favorites":
+		handleFavoritesCallback(bot, callbackMessage(callbackQuery), db, logger)
+	case callbackQuery.Data == "orders":
+		handleOrdersCallback(bot, callbackMessage(callbackQuery), db, logger)
 
 	default:
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Неизвестное действие.", "", nil, logger)
+		handler = "unknown_callback"
+		sendMessage(bot, callbackQuery.Message.Chat.ID, userLocalizer(db, int64(callbackQuery.From.ID)).T("common.unknown_action"), "", nil, logger)
 	}
+	return handler
+}
+
+// callbackMessage возвращает копию сообщения с нажатой кнопкой, отправителем которой указан
+// нажавший ее пользователь, чтобы обработчики команд находили данные этого пользователя, а не бота.
+func callbackMessage(callbackQuery *tgbotapi.CallbackQuery) *tgbotapi.Message {
+	message := *callbackQuery.Message
+	message.From = callbackQuery.From
+	return &message
 }
 
 // handleStartCommand обрабатывает команду /start.
-func handleStartCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
-	msg := tgbotapi.NewMessage(message.Chat.ID, "Привет! Я бот для покупки пива.")
-	msg.ReplyMarkup = createMainKeyboard()
-	bot.Send(msg)
+func handleStartCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	msg := tgbotapi.NewMessage(message.Chat.ID, loc.T("start.greeting"))
+	msg.ReplyMarkup = createMainKeyboard(loc)
+	sendRequest(message.Chat.ID, msg, nil, logger)
 }
 
 // handleAddToCartCallback обрабатывает callback-запрос на добавление пива в корзину.
-func handleAddToCartCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *log.Logger) {
+func handleAddToCartCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
 	data := strings.Split(callbackQuery.Data, ":")
 	if len(data) != 3 {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Неверный формат данных.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_data"), "", nil, logger)
 		return
 	}
 
 	beerID, err := strconv.Atoi(data[1])
 	if err != nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Неверный ID пива.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_beer_id"), "", nil, logger)
 		return
 	}
 
-	beer, err := database.GetBeerByID(context.Background(), db, beerID)
+	beer, err := beerCatalog.Get(logContext(logger), db, beerID)
 	if err != nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Ошибка при получении данных о пиве.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.beer_fetch_error"), "", nil, logger)
 		return
 	}
 
 	if beer == nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Пиво не найдено.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.beer_not_found"), "", nil, logger)
 		return
 	}
 
-	keyboard := createQuantityKeyboard(beerID, 1)
+	if beer.Quantity <= 0 {
+		keyboard := createNotifyStockKeyboard(loc, beerID)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("stock.out_of_stock", beer.Name), "", &keyboard, logger)
+		return
+	}
 
-	sendMessage(bot, callbackQuery.Message.Chat.ID, fmt.Sprintf("Укажите количество %s:", beer.Name), "", &keyboard, logger)
+	keyboard := createQuantityKeyboard(loc, beerID, 1)
+
+	sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("quantity.prompt", beer.Name), "", &keyboard, logger)
 
 }
 
 // handleAdjustQuantityCallback обрабатывает callback-запрос на изменение количества пива в корзине.
-func handleAdjustQuantityCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *log.Logger) {
-
+func handleAdjustQuantityCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
 	data := strings.Split(callbackQuery.Data, ":")
 	if len(data) != 4 {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Неверный формат данных.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_data"), "", nil, logger)
 		return
 	}
 	beerID, err := strconv.Atoi(data[1])
 	if err != nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Неверный ID пива.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_beer_id"), "", nil, logger)
 		return
 	}
 	quantity, err := strconv.Atoi(data[2])
 	if err != nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Неверный формат количества.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_quantity"), "", nil, logger)
 		return
 	}
 	adjust, err := strconv.Atoi(data[3])
 	if err != nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Ошибка при изменении количества.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.quantity_error"), "", nil, logger)
 		return
 	}
 
@@ -116,34 +263,35 @@ func handleAdjustQuantityCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.
 	if newQuantity <= 0 {
 		newQuantity = 1
 	}
-	keyboard := createQuantityKeyboard(beerID, newQuantity)
+	keyboard := createQuantityKeyboard(loc, beerID, newQuantity)
 	editMsg := tgbotapi.NewEditMessageReplyMarkup(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, keyboard)
-	_, err = bot.Send(editMsg)
-	if err != nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Ошибка при обновлении сообщения", "", nil, logger)
-	}
+	chatID := callbackQuery.Message.Chat.ID
+	sendRequest(chatID, editMsg, func(error) {
+		sendMessage(bot, chatID, loc.T("common.message_update_error"), "", nil, logger)
+	}, logger)
 }
 
 // handleConfirmAddCallback обрабатывает callback-запрос на подтверждение добавления пива в корзину.
-func handleConfirmAddCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *log.Logger) {
+func handleConfirmAddCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
 	data := strings.Split(callbackQuery.Data, ":")
 	beerID, err := strconv.Atoi(data[1])
 	if err != nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Неверный ID пива.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_beer_id"), "", nil, logger)
 		return
 	}
 	quantity, err := strconv.Atoi(data[2])
 	if err != nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Неверный формат количества.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_quantity"), "", nil, logger)
 		return
 	}
-	beer, err := database.GetBeerByID(context.Background(), db, beerID)
+	beer, err := beerCatalog.Get(logContext(logger), db, beerID)
 	if err != nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Ошибка при получении данных о пиве.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.beer_fetch_error"), "", nil, logger)
 		return
 	}
 	if beer == nil {
-		sendMessage(bot, callbackQuery.Message.Chat.ID, "Пиво не найдено.", "", nil, logger)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.beer_not_found"), "", nil, logger)
 		return
 	}
 	// Получаем текущую корзину или создаем новую
@@ -160,45 +308,86 @@ func handleConfirmAddCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.Call
 	cart[beerID] = cartItem
 
 	carts.Store(callbackQuery.Message.Chat.ID, cart) // Сохраняем обновленную корзину
+	metrics.CartAdditions.Inc()
 
-	sendMessage(bot, callbackQuery.Message.Chat.ID, fmt.Sprintf("%s (%d шт.) добавлен в корзину.", beer.Name, quantity), "", nil, logger)
+	// Предлагаем пиво, которое покупали вместе с содержимым корзины
+	cartBeerIDs := make([]int, 0, len(cart))
+	for cartBeerID := range cart {
+		cartBeerIDs = append(cartBeerIDs, cartBeerID)
+	}
+	addedText := loc.N("cart.added", quantity, beer.Name)
+	suggestions := suggestBeers(cartBeerIDs)
+	if len(suggestions) == 0 {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, addedText, "", nil, logger)
+		return
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(createSuggestionRows(loc, suggestions)...)
+	sendMessage(bot, callbackQuery.Message.Chat.ID, addedText+"\n\n"+loc.T("recommendations.title"), "", &keyboard, logger)
 }
 
 // handleBeerCallback обрабатывает команду "Показать пиво".
-func handleBeerCallback(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *log.Logger) {
-	beersMutex.Lock()
-	beersList := beers
-	beersMutex.Unlock()
-	var beerListText string
+func handleBeerCallback(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	beersList := beerCatalog.All()
 
 	if len(beersList) == 0 {
-		beerListText = "Пиво закончилось :("
-	} else {
-		for _, beer := range beersList {
-			beerInfo := utils.FormatBeerInfo(beer, false)
-			beerListText += fmt.Sprintf("%s\n\n", beerInfo)
-		}
+		sendMessage(bot, message.Chat.ID, loc.T("catalog.empty"), "", nil, logger)
+		return
 	}
 
-	sendMessage(bot, message.Chat.ID, beerListText, "Markdown", nil, logger)
-
+	sendRendered(bot, message.Chat.ID, loc, "beer_list", beersList, nil, logger)
 }
 
-// handleMessage обрабатывает сообщения, не являющиеся командами.
-func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *log.Logger) {
-	if waitingForSearchQuery[message.Chat.ID] {
+// handleMessage обрабатывает сообщения, не являющиеся командами, и возвращает имя обработчика для метрик.
+// Обработчик выбирается функцией messageHandler.
+func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) (handler string) {
+	handler = messageHandler(message)
+	logger = logger.With(logging.Handler, handler)
+	switch handler {
+	case "catalog_file":
+		handleCatalogFileMessage(bot, message, db, logger)
+	case "broadcast_message":
+		handleBroadcastMessage(bot, message, db, logger)
+	case "search_message":
 		handleSearchMessage(bot, message, db, logger)
 		delete(waitingForSearchQuery, message.Chat.ID)
-	} else {
-		switch message.Text {
-		case "Показать пиво":
-			handleBeerCallback(bot, message, db, logger)
-		case "Найти пиво":
-			handleSearchCallback(bot, message)
-		case "Корзина":
-			handleCartCallback(bot, message, db, logger)
-		default:
-			sendMessage(bot, message.Chat.ID, "Неизвестная команда.", "", nil, logger)
+	case "review_message":
+		handleReviewMessage(bot, message, db, logger)
+	case "menu.beer":
+		handleBeerCallback(bot, message, db, logger)
+	case "menu.search":
+		handleSearchCallback(bot, message, db, logger)
+	case "menu.cart":
+		handleCartCallback(bot, message, db, logger)
+	case "menu.favorites":
+		handleFavoritesCallback(bot, message, db, logger)
+	case "menu.orders":
+		handleOrdersCallback(bot, message, db, logger)
+	default:
+		sendMessage(bot, message.Chat.ID, messageLocalizer(db, message).T("common.unknown_command"), "", nil, logger)
+	}
+	return handler
+}
+
+// messageHandler выбирает обработчик сообщения: сначала по тому, какой ввод ожидается от пользователя,
+// затем по кнопке главного меню (на любом из поддерживаемых языков).
+func messageHandler(message *tgbotapi.Message) string {
+	if isCatalogFile(message) {
+		return "catalog_file"
+	}
+	if waitingForBroadcast[message.Chat.ID] {
+		return "broadcast_message"
+	}
+	if waitingForSearchQuery[message.Chat.ID] {
+		return "search_message"
+	}
+	if _, ok := waitingForReview[message.Chat.ID]; ok {
+		return "review_message"
+	}
+	for _, key := range []string{"menu.beer", "menu.search", "menu.cart", "menu.favorites", "menu.orders"} {
+		if i18n.Match(message.Text, key) {
+			return key
 		}
 	}
+	return "unknown_message"
 }
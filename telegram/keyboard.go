@@ -1,6 +1,8 @@
 package telegram
 
 import (
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/models"
 	"fmt"
 	"strconv"
 
@@ -8,12 +10,16 @@ import (
 )
 
 // createMainKeyboard создает клавиатуру главного меню.
-func createMainKeyboard() tgbotapi.ReplyKeyboardMarkup {
+func createMainKeyboard(loc i18n.Localizer) tgbotapi.ReplyKeyboardMarkup {
 	return tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Показать пиво"),
-			tgbotapi.NewKeyboardButton("Найти пиво"),
-			tgbotapi.NewKeyboardButton("Корзина"),
+			tgbotapi.NewKeyboardButton(loc.T("menu.beer")),
+			tgbotapi.NewKeyboardButton(loc.T("menu.search")),
+			tgbotapi.NewKeyboardButton(loc.T("menu.cart")),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(loc.T("menu.favorites")),
+			tgbotapi.NewKeyboardButton(loc.T("menu.orders")),
 		),
 	)
 }
@@ -21,7 +27,7 @@ func createMainKeyboard() tgbotapi.ReplyKeyboardMarkup {
 // createQuantityKeyboard создает клавиатуру для выбора количества пива.
 // beerID - ID пива.
 // quantity - текущее выбранное количество.
-func createQuantityKeyboard(beerID, quantity int) tgbotapi.InlineKeyboardMarkup {
+func createQuantityKeyboard(loc i18n.Localizer, beerID, quantity int) tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("-", fmt.Sprintf("adjust_quantity:%d:%d:-1", beerID, quantity)),
@@ -29,30 +35,96 @@ func createQuantityKeyboard(beerID, quantity int) tgbotapi.InlineKeyboardMarkup
 			tgbotapi.NewInlineKeyboardButtonData("+", fmt.Sprintf("adjust_quantity:%d:%d:1", beerID, quantity)),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Подтвердить", fmt.Sprintf("confirm_add:%d:%d", beerID, quantity)),
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("quantity.confirm"), fmt.Sprintf("confirm_add:%d:%d", beerID, quantity)),
 		),
 	)
 }
 
 // createCartKeyboard создает клавиатуру для действий с корзиной.
-func createCartKeyboard() tgbotapi.InlineKeyboardMarkup {
+func createCartKeyboard(loc i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Оформить заказ", "checkout"),
-			tgbotapi.NewInlineKeyboardButtonData("Очистить корзину", "clear_cart"),
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("cart.checkout"), "checkout"),
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("cart.clear"), "clear_cart"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("cart.subscribe"), "subscribe_cart"),
 		),
 	)
 }
 
-// createBeerKeyboard создает клавиатуру с кнопками "Показать пиво", "Найти пиво" и "Корзина"
-func createBeerKeyboard() tgbotapi.InlineKeyboardMarkup {
+// createSubscriptionFrequencyKeyboard создает клавиатуру выбора периодичности подписки.
+func createSubscriptionFrequencyKeyboard(loc i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	for _, days := range subscriptionFrequencies {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(loc.N("subscription.every_days", days), fmt.Sprintf("subscribe_cart:%d", days)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
+// createBeerKeyboard создает клавиатуру с кнопками "Показать пиво", "Найти пиво", "Избранное", "Мои заказы" и "Корзина"
+func createBeerKeyboard(loc i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Показать пиво", "beer"),
-			tgbotapi.NewInlineKeyboardButtonData("Найти пиво", "search"),
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("menu.beer"), "beer"),
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("menu.search"), "search"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Перейти к корзине", "cart"),
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("menu.favorites"), "favorites"),
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("menu.orders"), "orders"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("menu.go_to_cart"), "cart"),
+		),
+	)
+}
+
+// createBeerCardRow создает ряд кнопок под карточкой пива: добавление в корзину (или подписка
+// на поступление, если пива нет в наличии), избранное и отзывы, если они есть.
+// favorite - находится ли пиво в избранном пользователя.
+func createBeerCardRow(loc i18n.Localizer, beer models.Beer, favorite bool) []tgbotapi.InlineKeyboardButton {
+	star := "☆"
+	if favorite {
+		star = "★"
+	}
+	action := tgbotapi.NewInlineKeyboardButtonData(loc.T("card.add_to_cart", beer.Name), fmt.Sprintf("add_to_cart:%d:1", beer.ID))
+	if beer.Quantity <= 0 {
+		action = tgbotapi.NewInlineKeyboardButtonData(loc.T("card.notify_stock", beer.Name), fmt.Sprintf("notify_stock:%d", beer.ID))
+	}
+	row := tgbotapi.NewInlineKeyboardRow(
+		action,
+		tgbotapi.NewInlineKeyboardButtonData(star, fmt.Sprintf("toggle_favorite:%d", beer.ID)),
 	)
+	if beer.RatingCount > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(loc.T("card.reviews", beer.RatingCount), fmt.Sprintf("reviews:%d", beer.ID)))
+	}
+	return row
+}
+
+// createRatingKeyboard создает клавиатуру для оценки пива из заказа от 1 до 5.
+func createRatingKeyboard(orderID int64, beerID int) tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	for rating := 1; rating <= 5; rating++ {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d★", rating), fmt.Sprintf("rate:%d:%d:%d", orderID, beerID, rating)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
+// createNotifyStockKeyboard создает клавиатуру с кнопкой подписки на поступление пива.
+func createNotifyStockKeyboard(loc i18n.Localizer, beerID int) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("stock.notify_button"), fmt.Sprintf("notify_stock:%d", beerID)),
+		),
+	)
+}
+
+// createOrderPlacedKeyboard создает клавиатуру для сообщения об оформленном заказе:
+// навигация по боту и кнопка повтора заказа.
+func createOrderPlacedKeyboard(loc i18n.Localizer, orderID int64) tgbotapi.InlineKeyboardMarkup {
+	keyboard := createBeerKeyboard(loc)
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(loc.T("order.repeat_this"), fmt.Sprintf("reorder:%d", orderID)),
+	))
+	return keyboard
 }
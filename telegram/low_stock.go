@@ -0,0 +1,159 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/logging"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// alertLowStock отправляет в чат администраторов одно предупреждение обо всем пиве, остаток которого
+// опустился до порога. О пиве, про которое уже предупреждали, снова предупреждают только после пополнения
+// или если предыдущее предупреждение не удалось отправить.
+func alertLowStock(bot *tgbotapi.BotAPI, db *sql.DB, chatID int64, logger *slog.Logger) {
+	beers, err := database.TakeLowStockAlerts(logContext(logger), db)
+	if err != nil {
+		logger.Error("Ошибка при проверке низкого остатка", logging.Error, err)
+		return
+	}
+	if len(beers) == 0 {
+		return
+	}
+
+	loc := userLocalizer(db, chatID)
+	lines := []string{loc.T("low_stock.alert")}
+	ids := make([]int, 0, len(beers))
+	for _, beer := range beers {
+		lines = append(lines, formatLowStockLine(loc, beer))
+		ids = append(ids, beer.ID)
+	}
+	lines = append(lines, "", loc.T("low_stock.alert_footer"))
+	if _, err := sendNotification(bot, chatID, strings.Join(lines, "\n"), "", nil, logger); err != nil {
+		logger.Error("Ошибка при отправке предупреждения о низком остатке", "beer_ids", ids, logging.Error, err)
+		// Снимаем отметки, чтобы предупредить при следующей проверке
+		if err := database.ClearLowStockAlerts(logContext(logger), db, ids); err != nil {
+			logger.Error("Ошибка при снятии отметок низкого остатка", "beer_ids", ids, logging.Error, err)
+		}
+		return
+	}
+	logger.Info("Отправлено предупреждение о низком остатке", "beer_ids", ids)
+}
+
+// formatLowStockLine описывает остаток и порог пива.
+func formatLowStockLine(loc i18n.Localizer, beer database.LowStockBeer) string {
+	if beer.Own {
+		return loc.T("low_stock.line_own", beer.Name, beer.ID, beer.Quantity, beer.Threshold)
+	}
+	return loc.T("low_stock.line", beer.Name, beer.ID, beer.Quantity, beer.Threshold)
+}
+
+// handleLowStockCommand обрабатывает команду администратора /lowstock, отправляя список пива,
+// остаток которого не больше порога.
+func handleLowStockCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, message.Chat.ID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	threshold, err := database.GetLowStockThreshold(logContext(logger), db)
+	var beers []database.LowStockBeer
+	if err == nil {
+		beers, err = database.GetLowStockBeers(logContext(logger), db)
+	}
+	if err != nil {
+		logger.Error("Ошибка при получении пива с низким остатком", logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("low_stock.fetch_error"), "", nil, logger)
+		return
+	}
+
+	lines := []string{loc.T("low_stock.title", threshold)}
+	if len(beers) == 0 {
+		lines = append(lines, loc.T("low_stock.none"))
+	}
+	for _, beer := range beers {
+		lines = append(lines, formatLowStockLine(loc, beer))
+	}
+	sendMessage(bot, message.Chat.ID, strings.Join(lines, "\n"), "", nil, logger)
+}
+
+// handleThresholdCommand обрабатывает команду администратора /threshold <ID пива|all> <порог|default>,
+// задающую порог низкого остатка пива или общий порог для пива без своего порога.
+func handleThresholdCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	chatID := message.Chat.ID
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, chatID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 2 {
+		sendMessage(bot, chatID, loc.T("low_stock.threshold_usage"), "", nil, logger)
+		return
+	}
+	var threshold *int
+	if args[1] != "default" {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			sendMessage(bot, chatID, loc.T("common.invalid_quantity"), "", nil, logger)
+			return
+		}
+		threshold = &n
+	}
+
+	if args[0] == "all" {
+		if threshold == nil {
+			sendMessage(bot, chatID, loc.T("low_stock.threshold_usage"), "", nil, logger)
+			return
+		}
+		if err := database.SetLowStockThreshold(logContext(logger), db, *threshold); err != nil {
+			logger.Error("Ошибка при изменении общего порога низкого остатка", logging.Error, err)
+			sendMessage(bot, chatID, loc.T("low_stock.threshold_error"), "", nil, logger)
+			return
+		}
+		logger.Info("Общий порог низкого остатка изменен", "threshold", *threshold, "admin", describeUser(message.From))
+		sendMessage(bot, chatID, loc.T("low_stock.threshold_all_set", *threshold), "", nil, logger)
+		// Изменение порога не меняет остаток, поэтому каталог не проверит низкий остаток сам
+		if adminChatID != 0 {
+			goBackground(func() { alertLowStock(bot, db, adminChatID, logger) })
+		}
+		return
+	}
+
+	beerID, err := strconv.Atoi(args[0])
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("common.invalid_beer_id"), "", nil, logger)
+		return
+	}
+	err = database.SetBeerLowStockThreshold(logContext(logger), db, beerID, threshold)
+	if errors.Is(err, sql.ErrNoRows) {
+		sendMessage(bot, chatID, loc.T("common.beer_not_found"), "", nil, logger)
+		return
+	}
+	if err != nil {
+		logger.Error("Ошибка при изменении порога низкого остатка", "beer_id", beerID, logging.Error, err)
+		sendMessage(bot, chatID, loc.T("low_stock.threshold_error"), "", nil, logger)
+		return
+	}
+	logger.Info("Порог низкого остатка пива изменен", "beer_id", beerID, "threshold", threshold, "admin", describeUser(message.From))
+	if adminChatID != 0 {
+		goBackground(func() { alertLowStock(bot, db, adminChatID, logger) })
+	}
+
+	name := loc.T("common.unknown_beer", beerID)
+	if beer, ok := beerCatalog.Cached(beerID); ok {
+		name = beer.Name
+	}
+	if threshold == nil {
+		sendMessage(bot, chatID, loc.T("low_stock.threshold_beer_reset", name), "", nil, logger)
+		return
+	}
+	sendMessage(bot, chatID, loc.T("low_stock.threshold_beer_set", name, *threshold), "", nil, logger)
+}
@@ -1,28 +1,151 @@
 package telegram
 
 import (
-	"log"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/outbox"
+	"beer_from_the_brewery/render"
+	"log/slog"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
-// sendMessage отправляет сообщение в Telegram.
+// sendMessage отправляет ответ пользователю в Telegram через очередь исходящих сообщений.
+// Текст длиннее лимита Telegram разбивается на части, не разрывая разметку (см. render.Split);
+// клавиатура прикрепляется только к последней части.
 //
 // bot - указатель на экземпляр бота.
 // chatID - ID чата, куда нужно отправить сообщение.
 // text - текст сообщения.
 // parseMode - режим парсинга текста
-func sendMessage(bot *tgbotapi.BotAPI, chatID int64, text string, parseMode string, keyboard *tgbotapi.InlineKeyboardMarkup, logger *log.Logger) {
-	msg := tgbotapi.NewMessage(chatID, text)
-	if parseMode != "" {
-		msg.ParseMode = parseMode
+//
+// sendMessage не ждет отправки: лимиты и повторы одного чата не должны задерживать обработку
+// обновлений других пользователей. Возвращает количество частей, поставленных в очередь;
+// ошибки доставки записываются в лог. Узнать результат доставки позволяет sendMessageThen.
+func sendMessage(bot *tgbotapi.BotAPI, chatID int64, text string, parseMode string, keyboard *tgbotapi.InlineKeyboardMarkup, logger *slog.Logger) int {
+	return sendMessageThen(bot, chatID, text, parseMode, keyboard, nil, logger)
+}
+
+// deliveryReport получает результат доставки сообщения или запросов, поставленных в очередь вместе:
+// delivered - количество доставленных частей, err - первая ошибка доставки (nil, если доставлены все).
+// Вызывается в отдельной горутине.
+type deliveryReport func(delivered int, err error)
+
+// sendMessageThen отправляет сообщение как sendMessage и, если onDone не nil, сообщает ему результат
+// доставки всех частей. Возвращает количество частей, поставленных в очередь.
+func sendMessageThen(bot *tgbotapi.BotAPI, chatID int64, text string, parseMode string, keyboard *tgbotapi.InlineKeyboardMarkup, onDone deliveryReport, logger *slog.Logger) int {
+	chunks := messageChunks(chatID, text, parseMode, keyboard)
+	enqueueRequests(chatID, chunks, onDone, logger)
+	return len(chunks)
+}
+
+// sendNotification отправляет сообщение, о котором пользователь не просил (уведомление, напоминание),
+// с низким приоритетом: ответы пользователям в очереди отправляются раньше. В отличие от sendMessage
+// ждет отправки (вызывается из фоновых задач) и прекращает ожидание при остановке бота.
+//
+// Возвращает количество отправленных частей и ошибку отправки, которая к тому же записывается в лог.
+// При ошибке оставшиеся части не отправляются.
+func sendNotification(bot *tgbotapi.BotAPI, chatID int64, text string, parseMode string, keyboard *tgbotapi.InlineKeyboardMarkup, logger *slog.Logger) (int, error) {
+	chunks := messageChunks(chatID, text, parseMode, keyboard)
+	for i, chunk := range chunks {
+		result := outgoing.Send(botContext, chatID, chunk, outbox.Bulk)
+		if result.Err != nil {
+			logger.Error("Ошибка при отправке сообщения", "recipient_id", chatID,
+				"part", i+1, "parts", len(chunks), "attempts", result.Attempts, logging.Error, result.Err)
+			return i, result.Err
+		}
+	}
+	return len(chunks), nil
+}
+
+// messageChunks разбивает текст на части и формирует из них сообщения.
+func messageChunks(chatID int64, text string, parseMode string, keyboard *tgbotapi.InlineKeyboardMarkup) []tgbotapi.Chattable {
+	chunks := render.Split(text, parseMode, render.MaxMessageLength)
+	messages := make([]tgbotapi.Chattable, 0, len(chunks))
+	for i, chunk := range chunks {
+		msg := tgbotapi.NewMessage(chatID, chunk)
+		if parseMode != "" {
+			msg.ParseMode = parseMode
+		}
+
+		if keyboard != nil && i == len(chunks)-1 {
+			msg.ReplyMarkup = *keyboard // Разыменовываем указатель для прикрепления клавиатуры.
+		}
+		messages = append(messages, msg)
 	}
+	return messages
+}
 
-	if keyboard != nil {
-		msg.ReplyMarkup = *keyboard // Разыменовываем указатель для прикрепления клавиатуры.
+// sendRequest отправляет через очередь исходящих сообщений произвольный запрос к Telegram
+// (сообщение с обычной клавиатурой, изменение сообщения), не дожидаясь отправки, как sendMessage.
+// onError, если не nil, вызывается в отдельной горутине, если запрос не удалось отправить.
+func sendRequest(chatID int64, request tgbotapi.Chattable, onError func(error), logger *slog.Logger) {
+	var onDone deliveryReport
+	if onError != nil {
+		onDone = func(_ int, err error) {
+			if err != nil {
+				onError(err)
+			}
+		}
+	}
+	enqueueRequests(chatID, []tgbotapi.Chattable{request}, onDone, logger)
+}
 
+// enqueueRequests ставит запросы чата chatID в очередь с приоритетом ответа пользователю и сразу возвращается.
+// Запросы одного чата отправляются по порядку. Результаты ждет отдельная горутина: она записывает
+// ошибки в лог, передает результат onDone (если он не nil) и завершается не позже остановки очереди.
+func enqueueRequests(chatID int64, requests []tgbotapi.Chattable, onDone deliveryReport, logger *slog.Logger) {
+	results := make([]<-chan outbox.Result, 0, len(requests))
+	for _, request := range requests {
+		results = append(results, outgoing.Enqueue(chatID, request, outbox.Interactive))
 	}
-	if _, err := bot.Send(msg); err != nil {
-		logger.Printf("Ошибка при отправке сообщения: %s", err.Error())
+	go func() {
+		delivered := 0
+		var failed error
+		for i, done := range results {
+			result := <-done
+			if result.Err == nil {
+				delivered++
+				continue
+			}
+			logger.Error("Ошибка при отправке запроса", "recipient_id", chatID,
+				"part", i+1, "parts", len(results), "attempts", result.Attempts, logging.Error, result.Err)
+			if failed == nil {
+				failed = result.Err
+			}
+		}
+		if onDone != nil {
+			onDone(delivered, failed)
+		}
+	}()
+}
+
+// sendRendered формирует сообщение по шаблону name на языке loc и отправляет его в HTML-разметке.
+// Если шаблон не удалось исполнить, пользователь получает сообщение об ошибке без разметки.
+//
+// data - данные шаблона (см. описание шаблонов в render/templates).
+//
+// Как и sendMessage, не ждет отправки и возвращает количество частей, поставленных в очередь.
+func sendRendered(bot *tgbotapi.BotAPI, chatID int64, loc i18n.Localizer, name string, data any, keyboard *tgbotapi.InlineKeyboardMarkup, logger *slog.Logger) int {
+	text, err := renderer.Render(name, loc, data)
+	if err != nil {
+		logger.Error("Ошибка при формировании сообщения", "template", name, logging.Error, err)
+		return sendMessage(bot, chatID, loc.T("common.render_error"), "", nil, logger)
 	}
+	return sendMessage(bot, chatID, text, render.ParseMode, keyboard, logger)
+}
+
+// sendDocument отправляет файл name с содержимым data и подписью caption через очередь
+// исходящих сообщений, не дожидаясь отправки.
+func sendDocument(chatID int64, name string, data []byte, caption string, logger *slog.Logger) {
+	document := tgbotapi.NewDocumentUpload(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	document.Caption = caption
+	sendRequest(chatID, document, nil, logger)
+}
+
+// emptyKeyboard возвращает клавиатуру без кнопок, чтобы убрать кнопки из сообщения.
+// tgbotapi.NewInlineKeyboardMarkup() без строк отправляется как "inline_keyboard":null,
+// и Telegram отклоняет такой запрос.
+func emptyKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
 }
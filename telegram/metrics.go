@@ -0,0 +1,31 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/metrics"
+	"beer_from_the_brewery/outbox"
+)
+
+// registerOutboxMetrics регистрирует метрики очереди исходящих запросов к Telegram.
+func registerOutboxMetrics(queue *outbox.Queue) {
+	stat := func(value func(outbox.Stats) int64) func() float64 {
+		return func() float64 { return float64(value(queue.Stats())) }
+	}
+	metrics.NewCounterFunc("beer_bot_telegram_api_errors_total",
+		"Запросы к Telegram Bot API, завершившиеся ошибкой (включая повторенные).",
+		stat(func(s outbox.Stats) int64 { return s.Errors }))
+	metrics.NewCounterFunc("beer_bot_telegram_rate_limited_total",
+		"Ответы 429 (превышен лимит) от Telegram Bot API.",
+		stat(func(s outbox.Stats) int64 { return s.RateLimited }))
+	metrics.NewCounterFunc("beer_bot_telegram_retries_total",
+		"Повторные попытки отправки запросов к Telegram Bot API.",
+		stat(func(s outbox.Stats) int64 { return s.Retried }))
+	metrics.NewCounterFunc("beer_bot_telegram_delivered_total",
+		"Запросы к Telegram Bot API, доставленные успешно.",
+		stat(func(s outbox.Stats) int64 { return s.Delivered }))
+	metrics.NewCounterFunc("beer_bot_telegram_failed_total",
+		"Запросы к Telegram Bot API, не доставленные после всех попыток.",
+		stat(func(s outbox.Stats) int64 { return s.Failed }))
+	metrics.NewGaugeFunc("beer_bot_telegram_queued",
+		"Запросы в очереди исходящих сообщений.",
+		stat(func(s outbox.Stats) int64 { return s.Queued }))
+}
@@ -0,0 +1,200 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// registerOrderStatusHooks подписывает бота на изменения статусов заказов, в том числе
+// сделанные через API: покупатель получает уведомление, а после доставки - предложение оценить пиво.
+func registerOrderStatusHooks(bot *tgbotapi.BotAPI, db *sql.DB) {
+	database.OnOrderStatusChange(func(ctx context.Context, change models.OrderStatusChange) {
+		logger := logging.FromContext(ctx).With(logging.OrderID, change.OrderID)
+		goBackground(func() { notifyOrderStatus(bot, db, change, logger) })
+	})
+}
+
+// notifyOrderStatus сообщает покупателю о новом статусе его заказа.
+func notifyOrderStatus(bot *tgbotapi.BotAPI, db *sql.DB, change models.OrderStatusChange, logger *slog.Logger) {
+	if change.To == models.OrderDelivered {
+		promptOrderReview(bot, db, change.OrderID, logger)
+		return
+	}
+	loc := userLocalizer(db, change.UserID)
+	text := loc.T("order.status_changed", change.OrderID, orderStatusTitle(loc, change.To))
+	if _, err := sendNotification(bot, change.UserID, text, "", nil, logger); err != nil {
+		logger.Error("Ошибка при отправке уведомления о статусе заказа", "status", change.To, logging.Error, err)
+	}
+}
+
+// orderStatusTitle возвращает название статуса заказа на языке пользователя.
+// Для статусов без перевода возвращается сам статус.
+func orderStatusTitle(loc i18n.Localizer, status string) string {
+	key := "order.status." + status
+	if title := loc.T(key); title != key {
+		return title
+	}
+	return status
+}
+
+// changeOrderStatus переводит заказ в статус status от имени администратора admin
+// и сообщает результат в чат chatID. Возвращает true, если статус изменен.
+func changeOrderStatus(bot *tgbotapi.BotAPI, db *sql.DB, chatID int64, admin *tgbotapi.User, orderID int64, status string, logger *slog.Logger) bool {
+	loc := userLocalizer(db, int64(admin.ID))
+	logger = logger.With(logging.OrderID, orderID)
+
+	_, err := database.ChangeOrderStatus(logContext(logger), db, orderID, status, fmt.Sprintf("telegram:%d", admin.ID))
+	var transitionErr *database.OrderTransitionError
+	switch {
+	case err == nil:
+		logger.Info("Статус заказа изменен администратором", "status", status, "admin", describeUser(admin))
+		sendMessage(bot, chatID, loc.T("order_status.changed", orderID, orderStatusTitle(loc, status)), "", nil, logger)
+		return true
+	case errors.Is(err, database.ErrUnknownOrderStatus):
+		sendMessage(bot, chatID, loc.T("order_status.unknown", status, strings.Join(models.OrderStatuses, ", ")), "", nil, logger)
+	case errors.As(err, &transitionErr):
+		sendMessage(bot, chatID, formatTransitionError(loc, transitionErr), "", nil, logger)
+	case errors.Is(err, sql.ErrNoRows):
+		sendMessage(bot, chatID, loc.T("order.not_found"), "", nil, logger)
+	default:
+		logger.Error("Ошибка при изменении статуса заказа", "status", status, logging.Error, err)
+		sendMessage(bot, chatID, loc.T("admin.order_status_error"), "", nil, logger)
+	}
+	return false
+}
+
+// formatTransitionError объясняет, почему заказ нельзя перевести в статус, и перечисляет доступные статусы.
+func formatTransitionError(loc i18n.Localizer, err *database.OrderTransitionError) string {
+	from, to := orderStatusTitle(loc, err.From), orderStatusTitle(loc, err.To)
+	next := database.NextOrderStatuses(err.From)
+	if len(next) == 0 {
+		return loc.T("order_status.final", err.OrderID, from)
+	}
+	titles := make([]string, 0, len(next))
+	for _, status := range next {
+		titles = append(titles, orderStatusTitle(loc, status))
+	}
+	return loc.T("order_status.not_allowed", err.OrderID, from, to, strings.Join(titles, ", "))
+}
+
+// handleStatusCommand обрабатывает команду администратора /status <ID заказа> [статус].
+// Без статуса показывает текущий статус заказа, историю его изменений и кнопки перехода
+// в следующие статусы, со статусом - переводит заказ в этот статус.
+func handleStatusCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	chatID := message.Chat.ID
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, chatID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 || len(args) > 2 {
+		sendMessage(bot, chatID, loc.T("order_status.usage", strings.Join(models.OrderStatuses, ", ")), "", nil, logger)
+		return
+	}
+	orderID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("common.invalid_order_id"), "", nil, logger)
+		return
+	}
+	if len(args) == 2 {
+		changeOrderStatus(bot, db, chatID, message.From, orderID, strings.ToLower(args[1]), logger)
+		return
+	}
+	logger = logger.With(logging.OrderID, orderID)
+
+	order, err := database.GetOrder(logContext(logger), db, orderID)
+	if err != nil {
+		logger.Error("Ошибка при получении заказа", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("order.fetch_error"), "", nil, logger)
+		return
+	}
+	if order == nil {
+		sendMessage(bot, chatID, loc.T("order.not_found"), "", nil, logger)
+		return
+	}
+	history, err := database.GetOrderStatusHistory(logContext(logger), db, orderID)
+	if err != nil {
+		logger.Error("Ошибка при получении истории статусов заказа", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("order.fetch_error"), "", nil, logger)
+		return
+	}
+
+	text, keyboard := formatOrderStatus(loc, order, history)
+	sendMessage(bot, chatID, text, "", keyboard, logger)
+}
+
+// formatOrderStatus формирует описание статуса заказа с историей изменений
+// и клавиатуру перехода в следующие статусы (nil, если статус окончательный).
+func formatOrderStatus(loc i18n.Localizer, order *models.Order, history []models.OrderStatusChange) (string, *tgbotapi.InlineKeyboardMarkup) {
+	lines := []string{
+		loc.T("order.title", order.ID, order.OrderDate.In(location).Format(loc.T("format.date"))),
+		loc.T("order.status_line", orderStatusTitle(loc, order.Status)),
+		"",
+		loc.T("order_status.history"),
+	}
+	if len(history) == 0 {
+		lines = append(lines, loc.T("order_status.history_empty"))
+	}
+	for _, change := range history {
+		changedAt := change.ChangedAt.In(location).Format(loc.T("format.datetime"))
+		if change.From == "" {
+			lines = append(lines, loc.T("order_status.history_created", changedAt, orderStatusTitle(loc, change.To), change.ChangedBy))
+			continue
+		}
+		lines = append(lines, loc.T("order_status.history_line", changedAt,
+			orderStatusTitle(loc, change.From), orderStatusTitle(loc, change.To), change.ChangedBy))
+	}
+
+	next := database.NextOrderStatuses(order.Status)
+	if len(next) == 0 {
+		lines = append(lines, "", loc.T("order_status.final_hint"))
+		return strings.Join(lines, "\n"), nil
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, status := range next {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			orderStatusTitle(loc, status), fmt.Sprintf("order_status:%d:%s", order.ID, status))))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return strings.Join(lines, "\n"), &keyboard
+}
+
+// handleOrderStatusCallback обрабатывает нажатие администратором кнопки перехода в новый статус заказа.
+func handleOrderStatusCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	chatID := callbackQuery.Message.Chat.ID
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+	if !isAdmin(callbackQuery.From) {
+		sendMessage(bot, chatID, loc.T("common.unknown_action"), "", nil, logger)
+		return
+	}
+
+	data := strings.Split(callbackQuery.Data, ":")
+	if len(data) != 3 {
+		sendMessage(bot, chatID, loc.T("common.invalid_data"), "", nil, logger)
+		return
+	}
+	orderID, err := strconv.ParseInt(data[1], 10, 64)
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("common.invalid_order_id"), "", nil, logger)
+		return
+	}
+
+	if changeOrderStatus(bot, db, chatID, callbackQuery.From, orderID, data[2], logger) {
+		// Убираем кнопки, чтобы статус не изменили повторно
+		editMsg := tgbotapi.NewEditMessageReplyMarkup(chatID, callbackQuery.Message.MessageID, emptyKeyboard())
+		sendRequest(chatID, editMsg, nil, logger)
+	}
+}
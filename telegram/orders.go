@@ -0,0 +1,127 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/models"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// orderHistorySize - количество последних заказов, выводимых в истории.
+const orderHistorySize = 5
+
+// handleOrdersCallback обрабатывает команду "Мои заказы", выводя последние заказы с кнопками повтора.
+func handleOrdersCallback(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	orders, err := database.GetUserOrders(logContext(logger), db, int64(message.From.ID), orderHistorySize)
+	if err != nil {
+		logger.Error("Ошибка при получении истории заказов", logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("order.history_error"), "", nil, logger)
+		return
+	}
+	if len(orders) == 0 {
+		sendMessage(bot, message.Chat.ID, loc.T("order.history_empty"), "", nil, logger)
+		return
+	}
+
+	var orderRows [][]tgbotapi.InlineKeyboardButton
+	for _, order := range orders {
+		orderRows = append(orderRows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("order.repeat", order.ID), fmt.Sprintf("reorder:%d", order.ID)),
+		))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(orderRows...)
+	sendRendered(bot, message.Chat.ID, loc, "order_history", orders, &keyboard, logger)
+}
+
+// handleReorderCallback собирает корзину из позиций прошлого заказа с учетом текущих остатков и цен,
+// сообщает пользователю об изменениях и показывает корзину для оформления.
+func handleReorderCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	chatID := callbackQuery.Message.Chat.ID
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+	data := strings.Split(callbackQuery.Data, ":")
+	if len(data) != 2 {
+		sendMessage(bot, chatID, loc.T("common.invalid_data"), "", nil, logger)
+		return
+	}
+	orderID, err := strconv.ParseInt(data[1], 10, 64)
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("common.invalid_order_id"), "", nil, logger)
+		return
+	}
+	logger = logger.With(logging.OrderID, orderID)
+
+	order, err := database.GetOrder(logContext(logger), db, orderID)
+	if err != nil {
+		logger.Error("Ошибка при получении заказа", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("order.fetch_error"), "", nil, logger)
+		return
+	}
+	if order == nil || order.UserID != int64(callbackQuery.From.ID) {
+		sendMessage(bot, chatID, loc.T("order.not_found"), "", nil, logger)
+		return
+	}
+
+	items, err := database.GetOrderItems(logContext(logger), db, orderID)
+	if err != nil {
+		logger.Error("Ошибка при получении позиций заказа", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("order.fetch_error"), "", nil, logger)
+		return
+	}
+
+	beerIDs := make([]int, 0, len(items))
+	for _, item := range items {
+		beerIDs = append(beerIDs, item.BeerID)
+	}
+	orderBeers, err := beerCatalog.GetMany(logContext(logger), db, beerIDs)
+	if err != nil {
+		logger.Error("Ошибка при получении данных о пиве", "beer_ids", beerIDs, logging.Error, err)
+		sendMessage(bot, chatID, loc.T("common.beer_fetch_error"), "", nil, logger)
+		return
+	}
+
+	cart := make(map[int]models.CartItem)
+	var changes []string
+	for _, item := range items {
+		beer, ok := orderBeers[item.BeerID]
+		if !ok {
+			changes = append(changes, loc.T("reorder.discontinued", loc.T("common.unknown_beer", item.BeerID)))
+			continue
+		}
+		if beer.Quantity <= 0 {
+			changes = append(changes, loc.T("reorder.out_of_stock", beer.Name))
+			continue
+		}
+
+		quantity := item.Quantity
+		if beer.Quantity < quantity {
+			changes = append(changes, loc.T("reorder.reduced", beer.Name, beer.Quantity, quantity))
+			quantity = beer.Quantity
+		}
+		if item.Price > 0 && item.Price != beer.Price {
+			changes = append(changes, loc.T("reorder.repriced", beer.Name, item.Price, beer.Price))
+		}
+		cart[beer.ID] = models.CartItem{BeerID: beer.ID, Quantity: quantity}
+	}
+
+	if len(cart) == 0 {
+		sendMessage(bot, chatID, loc.T("reorder.nothing_available", orderID), "", nil, logger)
+		return
+	}
+
+	carts.Store(chatID, cart) // Заменяем текущую корзину позициями заказа
+
+	if len(changes) == 0 {
+		sendMessage(bot, chatID, loc.T("reorder.unchanged", orderID), "", nil, logger)
+	} else {
+		sendMessage(bot, chatID, loc.T("reorder.changed", orderID, strings.Join(changes, "\n")), "", nil, logger)
+	}
+	handleCartCallback(bot, callbackQuery.Message, db, logger)
+}
@@ -0,0 +1,83 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/accounting"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/utils"
+	"bytes"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Форматы выгрузки заказов для бухгалтерии.
+const (
+	exportFormatCSV = "csv" // Строки заказов в CSV
+	exportFormatXML = "xml" // Документы CommerceML для загрузки в 1С
+)
+
+// handleExportOrdersCommand обрабатывает команду администратора
+// /export_orders ГГГГ-ММ-ДД [ГГГГ-ММ-ДД] [csv|xml], отправляя заказы за период документами.
+// Без формата отправляются оба файла.
+func handleExportOrdersCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	chatID := message.Chat.ID
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, chatID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	formats := []string{exportFormatCSV, exportFormatXML}
+	if n := len(args); n > 0 {
+		if format := strings.ToLower(args[n-1]); format == exportFormatCSV || format == exportFormatXML {
+			formats = []string{format}
+			args = args[:n-1]
+		}
+	}
+	if len(args) == 0 || len(args) > 2 {
+		sendMessage(bot, chatID, loc.T("orders_export.usage"), "", nil, logger)
+		return
+	}
+	from, to := args[0], args[0]
+	if len(args) == 2 {
+		to = args[1]
+	}
+	start, end, err := utils.ParseDateRange(from, to, location)
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("orders_export.invalid_period"), "", nil, logger)
+		return
+	}
+
+	orders, err := accounting.LoadOrders(logContext(logger), db, start, end)
+	if err != nil {
+		logger.Error("Ошибка при выгрузке заказов", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("orders_export.error"), "", nil, logger)
+		return
+	}
+	if len(orders) == 0 {
+		sendMessage(bot, chatID, loc.T("orders_export.empty", from, to), "", nil, logger)
+		return
+	}
+
+	for _, format := range formats {
+		var buf bytes.Buffer
+		if format == exportFormatCSV {
+			err = accounting.WriteCSV(&buf, orders, location)
+		} else {
+			err = accounting.WriteCommerceML(&buf, orders, time.Now(), location)
+		}
+		if err != nil {
+			logger.Error("Ошибка при выгрузке заказов", "format", format, logging.Error, err)
+			sendMessage(bot, chatID, loc.T("orders_export.error"), "", nil, logger)
+			return
+		}
+		name := "orders_" + from + "_" + to + "." + format
+		sendDocument(chatID, name, buf.Bytes(), loc.N("orders_export.caption", len(orders), from, to), logger)
+	}
+	logger.Info("Администратор выгрузил заказы", "from", from, "to", to, "orders", len(orders),
+		"formats", strings.Join(formats, ","), "admin", describeUser(message.From))
+}
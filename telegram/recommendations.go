@@ -0,0 +1,44 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/models"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// maxSuggestions - максимальное количество рекомендаций, показываемых пользователю.
+const maxSuggestions = 3
+
+// suggestBeers подбирает до maxSuggestions сортов пива в наличии, которые покупали вместе с beerIDs.
+func suggestBeers(beerIDs []int) []models.Beer {
+	recommended := recommender.Recommend(beerIDs)
+	if len(recommended) == 0 {
+		return nil
+	}
+
+	var suggestions []models.Beer
+	for _, beerID := range recommended {
+		beer, ok := beerCatalog.Cached(beerID)
+		if !ok || beer.Quantity <= 0 {
+			continue
+		}
+		suggestions = append(suggestions, beer)
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+	}
+	return suggestions
+}
+
+// createSuggestionRows создает кнопки добавления рекомендованного пива в корзину.
+func createSuggestionRows(loc i18n.Localizer, suggestions []models.Beer) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, beer := range suggestions {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("recommendations.add", beer.Name, beer.Price), fmt.Sprintf("add_to_cart:%d:1", beer.ID)),
+		))
+	}
+	return rows
+}
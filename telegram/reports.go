@@ -0,0 +1,159 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/health"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/reports"
+	"beer_from_the_brewery/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	reportRetryDelay    = time.Minute      // Пауза перед первым повтором ежедневного отчета после ошибки
+	reportMaxRetryDelay = 30 * time.Minute // Максимальная пауза между повторами ежедневного отчета
+)
+
+// runDailyReport каждый день в время at (от начала суток в часовом поясе location) отправляет
+// в чат chatID отчет о продажах за прошедшие сутки. Работает до отмены ctx.
+func runDailyReport(ctx context.Context, bot *tgbotapi.BotAPI, db *sql.DB, chatID int64, at time.Duration, logger *slog.Logger) {
+	logger = logger.With(logging.Handler, "daily_report")
+	ctx = logging.NewContext(ctx, logger)
+	job := health.NewJob("daily_report", 24*time.Hour)
+	defer job.Stopped()
+
+	for {
+		next := reports.NextRun(time.Now(), at, location)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("Ежедневный отчет остановлен")
+			return
+		case <-timer.C:
+			deliverDailyReport(ctx, bot, db, chatID, next, at, job, logger)
+		}
+	}
+}
+
+// deliverDailyReport отправляет отчет, запланированный на время scheduled, за прошедшие сутки.
+// Если отчет не удалось сформировать или отправить, попытка повторяется за те же сутки
+// с растущей задержкой, пока не подойдет время следующего отчета или не будет отменен ctx.
+func deliverDailyReport(ctx context.Context, bot *tgbotapi.BotAPI, db *sql.DB, chatID int64, scheduled time.Time, at time.Duration, job *health.Job, logger *slog.Logger) {
+	from, to := reports.PreviousDay(scheduled, location)
+	date := from.Format(time.DateOnly)
+	deadline := reports.NextRun(scheduled, at, location)
+	delay := reportRetryDelay
+	for attempt := 1; ; attempt++ {
+		report, err := reports.Build(ctx, db, from, to)
+		if err == nil {
+			_, err = sendNotification(bot, chatID, formatReport(userLocalizer(db, chatID), report), "", nil, logger)
+		}
+		if err == nil {
+			logger.Info("Ежедневный отчет отправлен", "date", date, "orders", report.Orders, "attempts", attempt)
+			job.Succeeded()
+			return
+		}
+		job.Failed(err)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Now().Add(delay).After(deadline) {
+			logger.Error("Ежедневный отчет не отправлен", "date", date, "attempts", attempt, logging.Error, err)
+			return
+		}
+		logger.Error("Ошибка при отправке ежедневного отчета, повтор", "date", date, "attempt", attempt, "retry_in", delay, logging.Error, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay = min(2*delay, reportMaxRetryDelay)
+	}
+}
+
+// handleReportCommand обрабатывает команду администратора /report [ГГГГ-ММ-ДД [ГГГГ-ММ-ДД]],
+// отправляя отчет о продажах за период (по умолчанию - за вчера).
+func handleReportCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	chatID := message.Chat.ID
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, chatID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	var from, to time.Time
+	switch args := strings.Fields(message.CommandArguments()); len(args) {
+	case 0:
+		from, to = reports.PreviousDay(time.Now(), location)
+	case 1, 2:
+		last := ""
+		if len(args) == 2 {
+			last = args[1]
+		}
+		var err error
+		if from, to, err = utils.ParseDateRange(args[0], last, location); err != nil {
+			sendMessage(bot, chatID, loc.T("report.usage"), "", nil, logger)
+			return
+		}
+	default:
+		sendMessage(bot, chatID, loc.T("report.usage"), "", nil, logger)
+		return
+	}
+
+	report, err := reports.Build(logContext(logger), db, from, to)
+	if err != nil {
+		logger.Error("Ошибка при составлении отчета", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("report.error"), "", nil, logger)
+		return
+	}
+	sendMessage(bot, chatID, formatReport(loc, report), "", nil, logger)
+}
+
+// formatReport формирует текст отчета о продажах.
+func formatReport(loc i18n.Localizer, report *reports.Report) string {
+	first, last := report.From, report.To.AddDate(0, 0, -1)
+	var lines []string
+	if first.Equal(last) {
+		lines = append(lines, loc.T("report.title_day", first.Format(loc.T("format.date"))))
+	} else {
+		lines = append(lines, loc.T("report.title_period", first.Format(loc.T("format.date")), last.Format(loc.T("format.date"))))
+	}
+	lines = append(lines,
+		loc.T("report.orders", report.Orders),
+		loc.T("report.revenue", report.Revenue),
+		loc.T("report.average_check", report.AverageCheck()),
+		loc.T("report.customers", report.NewCustomers, report.ReturningCustomers),
+		"",
+		loc.T("report.top_beers"),
+	)
+	if len(report.TopBeers) == 0 {
+		lines = append(lines, loc.T("report.no_sales"))
+	}
+	for i, sales := range report.TopBeers {
+		name := sales.Name
+		if name == "" {
+			name = fmt.Sprintf("ID %d", sales.BeerID)
+		}
+		lines = append(lines, loc.T("report.top_beer_line", i+1, name, sales.Quantity, sales.Revenue))
+	}
+
+	lines = append(lines, "", loc.T("report.low_stock"))
+	if len(report.LowStock) == 0 {
+		lines = append(lines, loc.T("report.stock_ok"))
+	}
+	for _, beer := range report.LowStock {
+		lines = append(lines, loc.T("report.low_stock_line", beer.Name, beer.Quantity, beer.Threshold))
+	}
+	return strings.Join(lines, "\n")
+}
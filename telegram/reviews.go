@@ -0,0 +1,284 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/models"
+	"beer_from_the_brewery/utils"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// reviewsPageSize - количество отзывов, выводимых за один раз.
+const reviewsPageSize = 10
+
+// handleDeliveredCommand обрабатывает команду администратора /delivered <ID заказа>,
+// отмечая заказ доставленным и предлагая покупателю оценить пиво.
+func handleDeliveredCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, message.Chat.ID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	orderID, err := strconv.ParseInt(strings.TrimSpace(message.CommandArguments()), 10, 64)
+	if err != nil {
+		sendMessage(bot, message.Chat.ID, loc.T("admin.delivered_usage"), "", nil, logger)
+		return
+	}
+	// Предложение оценить пиво отправляет обработчик изменения статуса (см. registerOrderStatusHooks)
+	changeOrderStatus(bot, db, message.Chat.ID, message.From, orderID, models.OrderDelivered, logger)
+}
+
+// promptOrderReview предлагает покупателю оценить каждое пиво из доставленного заказа.
+func promptOrderReview(bot *tgbotapi.BotAPI, db *sql.DB, orderID int64, logger *slog.Logger) {
+	order, err := database.GetOrder(logContext(logger), db, orderID)
+	if err != nil || order == nil {
+		logger.Error("Ошибка при получении заказа для оценки", logging.Error, err)
+		return
+	}
+
+	items, err := database.GetOrderItems(logContext(logger), db, orderID)
+	if err != nil {
+		logger.Error("Ошибка при получении позиций заказа", logging.Error, err)
+		return
+	}
+
+	loc := userLocalizer(db, order.UserID)
+	sendMessage(bot, order.UserID, loc.T("review.order_delivered", orderID), "", nil, logger)
+	beerIDs := make([]int, 0, len(items))
+	for _, item := range items {
+		beerIDs = append(beerIDs, item.BeerID)
+	}
+	orderBeers, err := beerCatalog.GetMany(logContext(logger), db, beerIDs)
+	if err != nil {
+		logger.Error("Ошибка при получении данных о пиве", "beer_ids", beerIDs, logging.Error, err)
+		return
+	}
+	for _, item := range items {
+		beer, ok := orderBeers[item.BeerID]
+		if !ok {
+			logger.Error("Пиво из заказа не найдено", "beer_id", item.BeerID)
+			continue
+		}
+		keyboard := createRatingKeyboard(orderID, beer.ID)
+		sendMessage(bot, order.UserID, loc.T("review.rate_prompt", beer.Name), "", &keyboard, logger)
+	}
+}
+
+// handleRateCallback обрабатывает оценку пива покупателем.
+func handleRateCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	chatID := callbackQuery.Message.Chat.ID
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+	data := strings.Split(callbackQuery.Data, ":")
+	if len(data) != 4 {
+		sendMessage(bot, chatID, loc.T("common.invalid_data"), "", nil, logger)
+		return
+	}
+	orderID, err := strconv.ParseInt(data[1], 10, 64)
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("common.invalid_order_id"), "", nil, logger)
+		return
+	}
+	logger = logger.With(logging.OrderID, orderID)
+	beerID, err := strconv.Atoi(data[2])
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("common.invalid_beer_id"), "", nil, logger)
+		return
+	}
+	rating, err := strconv.Atoi(data[3])
+	if err != nil || rating < 1 || rating > 5 {
+		sendMessage(bot, chatID, loc.T("review.invalid_rating"), "", nil, logger)
+		return
+	}
+
+	allowed, err := database.CanReviewBeer(logContext(logger), db, int64(callbackQuery.From.ID), orderID, beerID)
+	if err != nil {
+		logger.Error("Ошибка при проверке права на отзыв", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("review.rating_error"), "", nil, logger)
+		return
+	}
+	if !allowed {
+		sendMessage(bot, chatID, loc.T("review.not_allowed"), "", nil, logger)
+		return
+	}
+
+	reviewID, err := database.SaveRating(logContext(logger), db, int64(callbackQuery.From.ID), orderID, beerID, rating)
+	if err != nil {
+		logger.Error("Ошибка при сохранении оценки", "beer_id", beerID, logging.Error, err)
+		sendMessage(bot, chatID, loc.T("review.rating_error"), "", nil, logger)
+		return
+	}
+
+	// Убираем кнопки оценки, чтобы не оценить пиво повторно по ошибке
+	editMsg := tgbotapi.NewEditMessageReplyMarkup(chatID, callbackQuery.Message.MessageID, emptyKeyboard())
+	sendRequest(chatID, editMsg, nil, logger)
+
+	waitingForReview[chatID] = reviewID
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("review.skip"), "skip_review"),
+		),
+	)
+	sendMessage(bot, chatID, loc.T("review.text_prompt", utils.FormatStars(rating)), "", &keyboard, logger)
+}
+
+// handleSkipReviewCallback обрабатывает отказ от написания текста отзыва.
+func handleSkipReviewCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	delete(waitingForReview, callbackQuery.Message.Chat.ID)
+	sendMessage(bot, callbackQuery.Message.Chat.ID, userLocalizer(db, int64(callbackQuery.From.ID)).T("review.rating_saved"), "", nil, logger)
+}
+
+// handleReviewMessage сохраняет текст отзыва, присланный после оценки.
+func handleReviewMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	reviewID := waitingForReview[message.Chat.ID]
+	delete(waitingForReview, message.Chat.ID)
+
+	text := strings.TrimSpace(message.Text)
+	if text == "" {
+		sendMessage(bot, message.Chat.ID, loc.T("review.rating_saved"), "", nil, logger)
+		return
+	}
+
+	if err := database.SetReviewText(logContext(logger), db, reviewID, text); err != nil {
+		logger.Error("Ошибка при сохранении отзыва", "review_id", reviewID, logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("review.text_error"), "", nil, logger)
+		return
+	}
+	sendMessage(bot, message.Chat.ID, loc.T("review.thanks"), "", nil, logger)
+}
+
+// handleReviewsCallback выводит последние отзывы о пиве.
+// Администраторы видят также скрытые отзывы и кнопки модерации.
+func handleReviewsCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	chatID := callbackQuery.Message.Chat.ID
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+	data := strings.Split(callbackQuery.Data, ":")
+	if len(data) != 2 {
+		sendMessage(bot, chatID, loc.T("common.invalid_data"), "", nil, logger)
+		return
+	}
+	beerID, err := strconv.Atoi(data[1])
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("common.invalid_beer_id"), "", nil, logger)
+		return
+	}
+
+	admin := isAdmin(callbackQuery.From)
+	reviews, err := database.GetBeerReviews(logContext(logger), db, beerID, admin, reviewsPageSize)
+	if err != nil {
+		logger.Error("Ошибка при получении отзывов", "beer_id", beerID, logging.Error, err)
+		sendMessage(bot, chatID, loc.T("review.fetch_error"), "", nil, logger)
+		return
+	}
+	if len(reviews) == 0 {
+		sendMessage(bot, chatID, loc.T("review.none"), "", nil, logger)
+		return
+	}
+
+	sendReviewList(bot, loc, chatID, loc.T("review.list_title", reviews[0].BeerName), reviews, admin, logger)
+}
+
+// handleModerateCommand обрабатывает команду администратора /reviews, выводя последние отзывы для модерации.
+func handleModerateCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	if !isAdmin(message.From) {
+		sendMessage(bot, message.Chat.ID, loc.T("common.unknown_command"), "", nil, logger)
+		return
+	}
+
+	reviews, err := database.GetLatestReviews(logContext(logger), db, reviewsPageSize)
+	if err != nil {
+		logger.Error("Ошибка при получении отзывов для модерации", logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("review.fetch_error"), "", nil, logger)
+		return
+	}
+	if len(reviews) == 0 {
+		sendMessage(bot, message.Chat.ID, loc.T("review.none"), "", nil, logger)
+		return
+	}
+
+	sendReviewList(bot, loc, message.Chat.ID, loc.T("review.latest_title"), reviews, true, logger)
+}
+
+// handleModerateReviewCallback скрывает отзыв или возвращает его в публикацию.
+func handleModerateReviewCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	chatID := callbackQuery.Message.Chat.ID
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+	if !isAdmin(callbackQuery.From) {
+		sendMessage(bot, chatID, loc.T("common.unknown_action"), "", nil, logger)
+		return
+	}
+
+	data := strings.Split(callbackQuery.Data, ":")
+	if len(data) != 3 || (data[2] != "hide" && data[2] != "show") {
+		sendMessage(bot, chatID, loc.T("common.invalid_data"), "", nil, logger)
+		return
+	}
+	reviewID, err := strconv.ParseInt(data[1], 10, 64)
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("review.invalid_id"), "", nil, logger)
+		return
+	}
+
+	hidden := data[2] == "hide"
+	if err := database.SetReviewHidden(logContext(logger), db, reviewID, hidden); err != nil {
+		logger.Error("Ошибка при модерации отзыва", "review_id", reviewID, logging.Error, err)
+		sendMessage(bot, chatID, loc.T("review.moderation_error"), "", nil, logger)
+		return
+	}
+	logger.Info("Видимость отзыва изменена", "review_id", reviewID, "hidden", hidden, "admin", describeUser(callbackQuery.From))
+
+	if hidden {
+		sendMessage(bot, chatID, loc.T("review.hidden", reviewID), "", nil, logger)
+	} else {
+		sendMessage(bot, chatID, loc.T("review.published", reviewID), "", nil, logger)
+	}
+}
+
+// sendReviewList отправляет список отзывов. Тексты отзывов присылают пользователи,
+// поэтому сообщение отправляется без разметки.
+// moderation - добавить ли кнопки модерации для каждого отзыва.
+func sendReviewList(bot *tgbotapi.BotAPI, loc i18n.Localizer, chatID int64, title string, reviews []models.Review, moderation bool, logger *slog.Logger) {
+	reviewsText := title + "\n\n"
+	var moderationRows [][]tgbotapi.InlineKeyboardButton
+	for _, review := range reviews {
+		reviewsText += fmt.Sprintf("#%d %s %s", review.ID, utils.FormatStars(review.Rating), review.AuthorName)
+		if moderation {
+			reviewsText += fmt.Sprintf(" (%s)", review.BeerName)
+		}
+		if review.Hidden {
+			reviewsText += " " + loc.T("review.hidden_mark")
+		}
+		if review.Text != "" {
+			reviewsText += "\n" + review.Text
+		}
+		reviewsText += "\n\n"
+
+		if moderation {
+			if review.Hidden {
+				moderationRows = append(moderationRows, tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData(loc.T("review.publish_button", review.ID), fmt.Sprintf("moderate_review:%d:show", review.ID)),
+				))
+			} else {
+				moderationRows = append(moderationRows, tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData(loc.T("review.hide_button", review.ID), fmt.Sprintf("moderate_review:%d:hide", review.ID)),
+				))
+			}
+		}
+	}
+
+	if len(moderationRows) == 0 {
+		sendMessage(bot, chatID, reviewsText, "", nil, logger)
+		return
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(moderationRows...)
+	sendMessage(bot, chatID, reviewsText, "", &keyboard, logger)
+}
@@ -2,60 +2,67 @@ package telegram
 
 import (
 	"beer_from_the_brewery/database"
-	"beer_from_the_brewery/utils"
-	"context"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/render"
 	"database/sql"
-	"fmt"
-	"log"
+	"log/slog"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
 // handleSearchCallback обрабатывает команду "Найти пиво", запрашивая у пользователя поисковый запрос.
-func handleSearchCallback(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
-	msg := tgbotapi.NewMessage(message.Chat.ID, "Введите название пива для поиска:")
-	bot.Send(msg)
+func handleSearchCallback(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	sendMessage(bot, message.Chat.ID, messageLocalizer(db, message).T("search.prompt"), "", nil, logger)
 	waitingForSearchQuery[message.Chat.ID] = true // Устанавливаем флаг ожидания поискового запроса
 }
 
 // handleSearchMessage обрабатывает сообщение с поисковым запросом от пользователя.
-func handleSearchMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *log.Logger) {
+func handleSearchMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
 	searchQuery := message.Text
-	foundBeers, err := database.SearchBeers(context.Background(), db, searchQuery)
+	foundBeers, err := database.SearchBeers(logContext(logger), db, searchQuery)
 	if err != nil {
-		logger.Printf("Ошибка при поиске пива (запрос: %s): %s", searchQuery, err.Error())
-		sendMessage(bot, message.Chat.ID, "Ошибка при поиске пива.", "", nil, logger)
+		logger.Error("Ошибка при поиске пива", "query", searchQuery, logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("search.error"), "", nil, logger)
 		return
 	}
 
 	if len(foundBeers) == 0 {
-		sendMessage(bot, message.Chat.ID, "Пиво не найдено.", "", nil, logger)
+		sendMessage(bot, message.Chat.ID, loc.T("common.beer_not_found"), "", nil, logger)
 		return
-	} else if len(foundBeers) == 1 {
-		// Найдено одно пиво - выводим подробную информацию и кнопку "Добавить в корзину"
+	}
+
+	// Избранное нужно только для отметки звездочкой, поэтому ошибка не прерывает поиск
+	favoriteIDs, err := database.GetFavoriteIDs(logContext(logger), db, int64(message.From.ID))
+	if err != nil {
+		logger.Error("Ошибка при получении избранного", logging.Error, err)
+	}
+
+	if len(foundBeers) == 1 {
+		// Найдено одно пиво - выводим подробную информацию и кнопки "Добавить в корзину" и избранного
 		beer := foundBeers[0]
-		msgText := utils.FormatBeerInfo(beer, true) // true - подробная информация
+		msgText, err := renderer.Render("beer_details", loc, beer)
+		if err != nil {
+			logger.Error("Ошибка при формировании карточки пива", "beer_id", beer.ID, logging.Error, err)
+			sendMessage(bot, message.Chat.ID, loc.T("common.render_error"), "", nil, logger)
+			return
+		}
 
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Добавить в корзину %s", beer.Name), fmt.Sprintf("add_to_cart:%d:1", beer.ID)),
-			),
-		)
-		sendMessage(bot, message.Chat.ID, msgText, "Markdown", &keyboard, logger)
+		beerRows := [][]tgbotapi.InlineKeyboardButton{createBeerCardRow(loc, beer, favoriteIDs[beer.ID])}
+		if suggestions := suggestBeers([]int{beer.ID}); len(suggestions) > 0 {
+			msgText += "\n\n" + render.Escape(loc.T("recommendations.title"))
+			beerRows = append(beerRows, createSuggestionRows(loc, suggestions)...)
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(beerRows...)
+		sendMessage(bot, message.Chat.ID, msgText, render.ParseMode, &keyboard, logger)
 
 	} else {
-		// Найдено несколько позиций - выводим краткую информацию и кнопку "Добавить в корзину" для каждого
-		var beerListText string
+		// Найдено несколько позиций - выводим краткую информацию и кнопки "Добавить в корзину" и избранного для каждого
 		var beerRows [][]tgbotapi.InlineKeyboardButton
 		for _, beer := range foundBeers {
-			beerInfo := utils.FormatBeerInfo(beer, false) // false - краткая информация
-			beerListText += fmt.Sprintf("%s\n\n", beerInfo)
-
-			beerRows = append(beerRows, []tgbotapi.InlineKeyboardButton{
-				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Добавить в корзину %s", beer.Name), fmt.Sprintf("add_to_cart:%d:1", beer.ID)),
-			})
+			beerRows = append(beerRows, createBeerCardRow(loc, beer, favoriteIDs[beer.ID]))
 		}
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(beerRows...)
-		sendMessage(bot, message.Chat.ID, beerListText, "Markdown", &keyboard, logger)
+		sendRendered(bot, message.Chat.ID, loc, "beer_list", foundBeers, &keyboard, logger)
 	}
 }
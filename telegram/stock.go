@@ -0,0 +1,86 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/models"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// handleNotifyStockCallback обрабатывает callback-запрос на подписку о поступлении пива.
+func handleNotifyStockCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+	data := strings.Split(callbackQuery.Data, ":")
+	if len(data) != 2 {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_data"), "", nil, logger)
+		return
+	}
+
+	beerID, err := strconv.Atoi(data[1])
+	if err != nil {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.invalid_beer_id"), "", nil, logger)
+		return
+	}
+
+	beer, err := beerCatalog.Get(logContext(logger), db, beerID)
+	if err != nil {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.beer_fetch_error"), "", nil, logger)
+		return
+	}
+	if beer == nil {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("common.beer_not_found"), "", nil, logger)
+		return
+	}
+
+	if beer.Quantity > 0 {
+		keyboard := createQuantityKeyboard(loc, beerID, 1)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("stock.already_available", beer.Name), "", &keyboard, logger)
+		return
+	}
+
+	subscribed, err := database.SubscribeToRestock(logContext(logger), db, int64(callbackQuery.From.ID), beerID)
+	if err != nil {
+		logger.Error("Ошибка при подписке на поступление", "beer_id", beerID, logging.Error, err)
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("stock.subscribe_error"), "", nil, logger)
+		return
+	}
+
+	if subscribed {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("stock.subscribed", beer.Name), "", nil, logger)
+	} else {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, loc.T("stock.already_subscribed", beer.Name), "", nil, logger)
+	}
+}
+
+// notifyRestocked уведомляет подписчиков о том, что пиво снова появилось в наличии, и снимает их подписки.
+// Подписка пользователя, которого не удалось уведомить, восстанавливается.
+func notifyRestocked(bot *tgbotapi.BotAPI, db *sql.DB, restocked []models.Beer, logger *slog.Logger) {
+	for _, beer := range restocked {
+		subscribers, err := database.TakeRestockSubscribers(logContext(logger), db, beer.ID)
+		if err != nil {
+			logger.Error("Ошибка при получении подписчиков на поступление", "beer_id", beer.ID, logging.Error, err)
+			continue
+		}
+
+		for _, chatID := range subscribers {
+			loc := userLocalizer(db, chatID)
+			keyboard := tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData(loc.T("stock.buy", beer.Name), fmt.Sprintf("add_to_cart:%d:1", beer.ID)),
+				),
+			)
+			if _, err := sendNotification(bot, chatID, loc.T("stock.restocked", beer.Name), "", &keyboard, logger); err != nil {
+				// Восстанавливаем подписку, чтобы пользователь узнал о следующем поступлении
+				if _, err := database.SubscribeToRestock(logContext(logger), db, chatID, beer.ID); err != nil {
+					logger.Error("Ошибка при восстановлении подписки на поступление", "recipient_id", chatID, "beer_id", beer.ID, logging.Error, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/health"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const subscriptionReminderLead = 24 * time.Hour // За сколько до заказа по подписке напоминать покупателю
+
+// subscriptionFrequencies содержит доступные варианты периодичности подписки в днях.
+var subscriptionFrequencies = []int{7, 14, 30}
+
+// subscriptionActions сопоставляет действия над подпиской со статусами, в которые она переходит.
+var subscriptionActions = map[string]string{
+	"pause":  models.SubscriptionPaused,
+	"resume": models.SubscriptionActive,
+	"cancel": models.SubscriptionCancelled,
+}
+
+// handleSubscribeCartCallback оформляет подписку на регулярный заказ содержимого корзины.
+// Без параметров предлагает выбрать периодичность, с параметром (subscribe_cart:<дней>) создает подписку.
+func handleSubscribeCartCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	chatID := callbackQuery.Message.Chat.ID
+	loc := userLocalizer(db, int64(callbackQuery.From.ID))
+	loadCart, ok := carts.Load(chatID)
+	if !ok || loadCart == nil || len(loadCart.(map[int]models.CartItem)) == 0 {
+		sendMessage(bot, chatID, loc.T("subscription.empty_cart"), "", nil, logger)
+		return
+	}
+	cart := loadCart.(map[int]models.CartItem)
+
+	data := strings.Split(callbackQuery.Data, ":")
+	if len(data) == 1 {
+		keyboard := createSubscriptionFrequencyKeyboard(loc)
+		sendMessage(bot, chatID, loc.T("subscription.choose_frequency"), "", &keyboard, logger)
+		return
+	}
+
+	frequencyDays, err := strconv.Atoi(data[1])
+	if err != nil || frequencyDays <= 0 {
+		sendMessage(bot, chatID, loc.T("subscription.invalid_frequency"), "", nil, logger)
+		return
+	}
+
+	items := make([]models.CartItem, 0, len(cart))
+	for _, cartItem := range cart {
+		items = append(items, cartItem)
+	}
+
+	firstRunAt := time.Now().AddDate(0, 0, frequencyDays)
+	subscriptionID, err := database.CreateSubscription(logContext(logger), db, int64(callbackQuery.From.ID), frequencyDays, firstRunAt, items)
+	if err != nil {
+		logger.Error("Ошибка при создании подписки", logging.Error, err)
+		sendMessage(bot, chatID, loc.T("subscription.create_error"), "", nil, logger)
+		return
+	}
+	logger.Info("Оформлена подписка", "subscription_id", subscriptionID, "customer", describeUser(callbackQuery.From))
+
+	sendMessage(bot, chatID, loc.N("subscription.created", frequencyDays, subscriptionID, firstRunAt.Format(loc.T("format.date"))), "", nil, logger)
+}
+
+// handleSubscriptionsCommand обрабатывает команду /subscriptions, выводя подписки пользователя с кнопками управления.
+func handleSubscriptionsCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+	subscriptions, err := database.GetUserSubscriptions(logContext(logger), db, int64(message.From.ID))
+	if err != nil {
+		logger.Error("Ошибка при получении подписок", logging.Error, err)
+		sendMessage(bot, message.Chat.ID, loc.T("subscription.fetch_error"), "", nil, logger)
+		return
+	}
+	if len(subscriptions) == 0 {
+		sendMessage(bot, message.Chat.ID, loc.T("subscription.none"), "", nil, logger)
+		return
+	}
+
+	subscriptionsText := loc.T("subscription.list_title") + "\n\n"
+	var subscriptionRows [][]tgbotapi.InlineKeyboardButton
+	for _, subscription := range subscriptions {
+		status := loc.T("subscription.status.active")
+		toggle := tgbotapi.NewInlineKeyboardButtonData(loc.T("subscription.pause_button", subscription.ID), fmt.Sprintf("subscription:%d:pause", subscription.ID))
+		if subscription.Status == models.SubscriptionPaused {
+			status = loc.T("subscription.status.paused")
+			toggle = tgbotapi.NewInlineKeyboardButtonData(loc.T("subscription.resume_button", subscription.ID), fmt.Sprintf("subscription:%d:resume", subscription.ID))
+		}
+
+		subscriptionsText += loc.N("subscription.list_line", subscription.FrequencyDays, subscription.ID, status,
+			subscription.NextRunAt.Format(loc.T("format.date")), formatItemList(loc, db, subscription.Items, logger))
+		subscriptionRows = append(subscriptionRows, tgbotapi.NewInlineKeyboardRow(
+			toggle,
+			tgbotapi.NewInlineKeyboardButtonData(loc.T("subscription.cancel_button", subscription.ID), fmt.Sprintf("subscription:%d:cancel", subscription.ID)),
+		))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(subscriptionRows...)
+	sendMessage(bot, message.Chat.ID, subscriptionsText, "", &keyboard, logger)
+}
+
+// handleSubscriptionActionCallback обрабатывает кнопки управления подпиской (subscription:<ID>:<действие>).
+func handleSubscriptionActionCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	data := strings.Split(callbackQuery.Data, ":")
+	if len(data) != 3 {
+		sendMessage(bot, callbackQuery.Message.Chat.ID, userLocalizer(db, int64(callbackQuery.From.ID)).T("common.invalid_data"), "", nil, logger)
+		return
+	}
+	changeSubscriptionStatus(bot, callbackQuery.Message.Chat.ID, int64(callbackQuery.From.ID), data[1], data[2], db, logger)
+}
+
+// handleSubscriptionCommand обрабатывает команды /pause_sub, /resume_sub и /cancel_sub с ID подписки.
+// action - действие над подпиской: pause, resume или cancel.
+func handleSubscriptionCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, action string, db *sql.DB, logger *slog.Logger) {
+	argument := strings.TrimSpace(message.CommandArguments())
+	if argument == "" {
+		sendMessage(bot, message.Chat.ID, messageLocalizer(db, message).T("subscription.command_usage", message.Command()), "", nil, logger)
+		return
+	}
+	changeSubscriptionStatus(bot, message.Chat.ID, int64(message.From.ID), argument, action, db, logger)
+}
+
+// changeSubscriptionStatus применяет действие к подписке пользователя userID и сообщает о результате в чат chatID.
+func changeSubscriptionStatus(bot *tgbotapi.BotAPI, chatID, userID int64, subscriptionIDText string, action string, db *sql.DB, logger *slog.Logger) {
+	loc := userLocalizer(db, userID)
+	subscriptionID, err := strconv.ParseInt(subscriptionIDText, 10, 64)
+	if err != nil {
+		sendMessage(bot, chatID, loc.T("subscription.invalid_id"), "", nil, logger)
+		return
+	}
+	status, ok := subscriptionActions[action]
+	if !ok {
+		sendMessage(bot, chatID, loc.T("common.unknown_action"), "", nil, logger)
+		return
+	}
+
+	if err := database.SetSubscriptionStatus(logContext(logger), db, subscriptionID, userID, status); err != nil {
+		logger.Error("Ошибка при изменении подписки", "subscription_id", subscriptionID, logging.Error, err)
+		sendMessage(bot, chatID, loc.T("subscription.change_error"), "", nil, logger)
+		return
+	}
+
+	switch status {
+	case models.SubscriptionPaused:
+		sendMessage(bot, chatID, loc.T("subscription.paused", subscriptionID), "", nil, logger)
+	case models.SubscriptionActive:
+		sendMessage(bot, chatID, loc.T("subscription.resumed", subscriptionID), "", nil, logger)
+	case models.SubscriptionCancelled:
+		sendMessage(bot, chatID, loc.T("subscription.cancelled", subscriptionID), "", nil, logger)
+	}
+}
+
+// runSubscriptionScheduler периодически напоминает о предстоящих заказах по подпискам
+// и оформляет заказы, срок которых наступил.
+func runSubscriptionScheduler(ctx context.Context, bot *tgbotapi.BotAPI, db *sql.DB, interval time.Duration, logger *slog.Logger) {
+	logger = logger.With(logging.Handler, "subscription_scheduler")
+	ctx = logging.NewContext(ctx, logger)
+	job := health.NewJob("subscriptions", interval)
+	defer job.Stopped()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Планировщик подписок остановлен")
+			return
+		case <-ticker.C:
+			remindSubscriptions(ctx, bot, db, logger)
+			runDueSubscriptions(ctx, bot, db, logger)
+			job.Succeeded()
+		}
+	}
+}
+
+// remindSubscriptions напоминает покупателям о заказах по подписке, которые будут оформлены в ближайшие сутки.
+func remindSubscriptions(ctx context.Context, bot *tgbotapi.BotAPI, db *sql.DB, logger *slog.Logger) {
+	subscriptions, err := database.GetSubscriptionsDueBefore(ctx, db, time.Now().Add(subscriptionReminderLead))
+	if err != nil {
+		logger.Error("Ошибка при получении подписок для напоминания", logging.Error, err)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		if subscription.Reminded {
+			continue
+		}
+
+		loc := userLocalizer(db, subscription.UserID)
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(loc.T("subscription.pause"), fmt.Sprintf("subscription:%d:pause", subscription.ID)),
+				tgbotapi.NewInlineKeyboardButtonData(loc.T("subscription.cancel"), fmt.Sprintf("subscription:%d:cancel", subscription.ID)),
+			),
+		)
+		sendNotification(bot, subscription.UserID, loc.T("subscription.reminder",
+			subscription.NextRunAt.Format(loc.T("format.datetime")), subscription.ID, formatItemList(loc, db, subscription.Items, logger)), "", &keyboard, logger)
+
+		if err := database.MarkSubscriptionReminded(ctx, db, subscription.ID); err != nil {
+			logger.Error("Ошибка при обновлении подписки", "subscription_id", subscription.ID, logging.Error, err)
+		}
+	}
+}
+
+// runDueSubscriptions оформляет заказы по подпискам, срок которых наступил.
+// Позиции, которых нет в наличии, пропускаются, а количество ограничивается остатком.
+func runDueSubscriptions(ctx context.Context, bot *tgbotapi.BotAPI, db *sql.DB, logger *slog.Logger) {
+	now := time.Now()
+	subscriptions, err := database.GetSubscriptionsDueBefore(ctx, db, now)
+	if err != nil {
+		logger.Error("Ошибка при получении подписок к исполнению", logging.Error, err)
+		return
+	}
+
+	// Пиво всех подписок загружается одним запросом
+	var beerIDs []int
+	for _, subscription := range subscriptions {
+		for _, item := range subscription.Items {
+			beerIDs = append(beerIDs, item.BeerID)
+		}
+	}
+	subscriptionBeers, err := beerCatalog.GetMany(ctx, db, beerIDs)
+	if err != nil {
+		// Подписки останутся просроченными и будут исполнены при следующей проверке
+		logger.Error("Ошибка при получении данных о пиве", "beer_ids", beerIDs, logging.Error, err)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		loc := userLocalizer(db, subscription.UserID)
+		var items []models.CartItem
+		var skipped []string
+		for _, item := range subscription.Items {
+			beer, ok := subscriptionBeers[item.BeerID]
+			if !ok || beer.Quantity <= 0 {
+				name := loc.T("common.unknown_beer", item.BeerID)
+				if ok {
+					name = beer.Name
+				}
+				skipped = append(skipped, loc.T("reorder.out_of_stock", name))
+				continue
+			}
+			if beer.Quantity < item.Quantity {
+				skipped = append(skipped, loc.T("reorder.reduced", beer.Name, beer.Quantity, item.Quantity))
+				item.Quantity = beer.Quantity
+			}
+			items = append(items, item)
+		}
+
+		// Следующий заказ переносится на ближайшую будущую дату, даже если бот долго не работал
+		nextRunAt := subscription.NextRunAt
+		for !nextRunAt.After(now) {
+			nextRunAt = nextRunAt.AddDate(0, 0, subscription.FrequencyDays)
+		}
+
+		// Заказ оформляется одной транзакцией с переносом даты, поэтому при ошибке подписка останется
+		// просроченной и будет исполнена при следующей проверке, но не оформит заказ дважды
+		var orderText string
+		orderID, err := database.RunSubscription(ctx, db, subscription, items, nextRunAt)
+		var stockErr *database.InsufficientStockError
+		switch {
+		case errors.As(err, &stockErr):
+			// Остаток изменился после загрузки каталога: пропускаем период, иначе заказ не оформлялся бы до пополнения
+			if _, err := database.RunSubscription(ctx, db, subscription, nil, nextRunAt); err != nil {
+				logger.Error("Ошибка при переносе заказа по подписке", "subscription_id", subscription.ID, logging.Error, err)
+				continue
+			}
+			logger.Info("Заказ по подписке пропущен: не хватило пива", "subscription_id", subscription.ID,
+				"beer_id", stockErr.BeerID, "available", stockErr.Available)
+			name := loc.T("common.unknown_beer", stockErr.BeerID)
+			if beer, ok := subscriptionBeers[stockErr.BeerID]; ok {
+				name = beer.Name
+			}
+			orderText = loc.T("subscription.not_enough_stock", subscription.ID, name, stockErr.Available)
+			skipped = nil
+		case errors.Is(err, database.ErrSubscriptionChanged):
+			logger.Info("Подписка изменена до оформления заказа", "subscription_id", subscription.ID)
+			continue
+		case err != nil:
+			logger.Error("Ошибка при оформлении заказа по подписке", "subscription_id", subscription.ID, logging.Error, err)
+			continue
+		case orderID == 0:
+			orderText = loc.T("subscription.nothing_available", subscription.ID)
+		default:
+			logger.Info("Оформлен заказ по подписке", logging.OrderID, orderID, "subscription_id", subscription.ID)
+			orderText = loc.T("subscription.order_placed", orderID, subscription.ID, formatItemList(loc, db, items, logger))
+		}
+
+		if len(skipped) > 0 {
+			orderText += "\n" + loc.T("subscription.changes", strings.Join(skipped, "\n"))
+		}
+		orderText += "\n" + loc.T("subscription.next_order", nextRunAt.Format(loc.T("format.date")))
+		sendNotification(bot, subscription.UserID, orderText, "", nil, logger)
+	}
+}
+
+// formatItemList возвращает список позиций в виде "Название - N шт." по одной на строку.
+func formatItemList(loc i18n.Localizer, db *sql.DB, items []models.CartItem, logger *slog.Logger) string {
+	beerIDs := make([]int, 0, len(items))
+	for _, item := range items {
+		beerIDs = append(beerIDs, item.BeerID)
+	}
+	itemBeers, err := beerCatalog.GetMany(logContext(logger), db, beerIDs)
+	if err != nil {
+		logger.Error("Ошибка при получении данных о пиве", "beer_ids", beerIDs, logging.Error, err)
+	}
+
+	var lines []string
+	for _, item := range items {
+		name := loc.T("common.unknown_beer", item.BeerID)
+		if beer, ok := itemBeers[item.BeerID]; ok {
+			name = beer.Name
+		}
+		lines = append(lines, loc.N("common.item_line", item.Quantity, name))
+	}
+	return strings.Join(lines, "\n")
+}
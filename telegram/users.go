@@ -0,0 +1,122 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/database"
+	"beer_from_the_brewery/i18n"
+	"beer_from_the_brewery/logging"
+	"beer_from_the_brewery/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// updateSender возвращает автора обновления (сообщения или callback-запроса).
+func updateSender(update tgbotapi.Update) *tgbotapi.User {
+	switch {
+	case update.Message != nil:
+		return update.Message.From
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.From
+	}
+	return nil
+}
+
+// trackUser сохраняет профиль автора обновления в таблицу users и запоминает его язык.
+func trackUser(db *sql.DB, update tgbotapi.Update, logger *slog.Logger) {
+	from := updateSender(update)
+	if from == nil || from.IsBot {
+		return
+	}
+
+	user := models.User{
+		ID:           int64(from.ID),
+		Username:     from.UserName,
+		FirstName:    from.FirstName,
+		LastName:     from.LastName,
+		LanguageCode: from.LanguageCode,
+		LastSeenAt:   time.Now(),
+	}
+	language, err := database.UpsertUser(logContext(logger), db, user)
+	if err != nil {
+		logger.Error("Ошибка при сохранении пользователя", logging.Error, err)
+		language = from.LanguageCode
+	}
+	userLanguages.Store(user.ID, i18n.Normalize(language))
+}
+
+// userLocalizer возвращает Localizer для пользователя Telegram userID. Язык берется из кэша, который
+// заполняется при каждом обновлении, а для пользователей, которым бот пишет первым, - из базы данных.
+// Уведомления отправляются в личный чат пользователя, ID которого совпадает с ID пользователя;
+// в остальных случаях нужно передавать ID автора обновления, а не ID чата (см. messageLocalizer).
+func userLocalizer(db *sql.DB, userID int64) i18n.Localizer {
+	if language, ok := userLanguages.Load(userID); ok {
+		return i18n.New(language.(string))
+	}
+
+	language, err := database.GetUserLanguage(context.Background(), db, userID)
+	if err != nil {
+		// Ошибка не мешает отправить сообщение на языке по умолчанию, поэтому не кэшируем результат
+		return i18n.New(i18n.DefaultLanguage)
+	}
+	language = i18n.Normalize(language)
+	userLanguages.Store(userID, language)
+	return i18n.New(language)
+}
+
+// messageLocalizer возвращает Localizer автора сообщения. У сообщений без автора (записи каналов)
+// язык определяется по чату.
+func messageLocalizer(db *sql.DB, message *tgbotapi.Message) i18n.Localizer {
+	if message.From == nil {
+		return userLocalizer(db, message.Chat.ID)
+	}
+	return userLocalizer(db, int64(message.From.ID))
+}
+
+// handleLanguageCommand обрабатывает команду /language, предлагая выбрать язык бота.
+func handleLanguageCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, logger *slog.Logger) {
+	loc := messageLocalizer(db, message)
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, language := range i18n.Languages() {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(i18n.New(language).T("language.name"), "set_language:"+language))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	sendMessage(bot, message.Chat.ID, loc.T("language.choose"), "", &keyboard, logger)
+}
+
+// handleSetLanguageCallback сохраняет выбранный пользователем язык и обновляет главное меню.
+func handleSetLanguageCallback(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, logger *slog.Logger) {
+	chatID := callbackQuery.Message.Chat.ID
+	userID := int64(callbackQuery.From.ID)
+	language := i18n.Normalize(strings.TrimPrefix(callbackQuery.Data, "set_language:"))
+
+	if err := database.SetUserLanguage(logContext(logger), db, userID, language); err != nil {
+		logger.Error("Ошибка при сохранении языка", logging.Error, err)
+		sendMessage(bot, chatID, userLocalizer(db, userID).T("language.error"), "", nil, logger)
+		return
+	}
+	userLanguages.Store(userID, language)
+
+	// Кнопки обычной клавиатуры переводятся, поэтому отправляем меню заново
+	loc := i18n.New(language)
+	msg := tgbotapi.NewMessage(chatID, loc.T("language.changed"))
+	msg.ReplyMarkup = createMainKeyboard(loc)
+	sendRequest(chatID, msg, nil, logger)
+}
+
+// describeUser возвращает читаемое описание пользователя для логов и сообщений персоналу.
+func describeUser(from *tgbotapi.User) string {
+	name := from.FirstName
+	if from.LastName != "" {
+		name += " " + from.LastName
+	}
+	if from.UserName != "" {
+		return fmt.Sprintf("%s (@%s, ID: %d)", name, from.UserName, from.ID)
+	}
+	return fmt.Sprintf("%s (ID: %d)", name, from.ID)
+}
@@ -0,0 +1,80 @@
+package telegram
+
+import (
+	"beer_from_the_brewery/health"
+	"beer_from_the_brewery/logging"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// receiveWebhook регистрирует webhookURL в Telegram и принимает обновления HTTP-сервером
+// на адресе addr, пока не будет отменен ctx. Обновления принимаются только по пути из webhookURL,
+// поэтому путь стоит сделать трудноугадываемым (например, /telegram/<случайная строка>).
+// Время последнего полученного обновления отслеживается задачей updatesJob.
+func receiveWebhook(ctx context.Context, bot *tgbotapi.BotAPI, webhookURL, addr string, logger *slog.Logger) (<-chan tgbotapi.Update, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный адрес webhook: %w", err)
+	}
+	if _, err := bot.SetWebhook(tgbotapi.NewWebhook(webhookURL)); err != nil {
+		return nil, fmt.Errorf("ошибка при регистрации webhook: %w", err)
+	}
+
+	updates := make(chan tgbotapi.Update, 100)
+	updatesJob = health.NewJob("updates", 0)
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+path, func(w http.ResponseWriter, r *http.Request) {
+		var update tgbotapi.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "некорректное обновление", http.StatusBadRequest)
+			return
+		}
+		updatesJob.Succeeded()
+		select {
+		case updates <- update:
+		case <-ctx.Done():
+			// Telegram повторит обновление, не получив ответа 200
+			http.Error(w, "бот останавливается", http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+			http.Error(w, "запрос отменен", http.StatusServiceUnavailable)
+		}
+	})
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		logger.Info("Прием обновлений через webhook запущен", "addr", addr, "path", path)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			updatesJob.Failed(err)
+			logger.Error("Ошибка HTTP-сервера webhook", logging.Error, err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		defer updatesJob.Stopped()
+		// Shutdown дожидается завершения обработчиков, после этого в канал никто не пишет
+		// и его можно закрыть
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Ошибка при остановке HTTP-сервера webhook", logging.Error, err)
+			server.Close()
+			return
+		}
+		close(updates)
+	}()
+	return updates, nil
+}
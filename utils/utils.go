@@ -1,24 +1,44 @@
 package utils
 
 import (
-	"beer_from_the_brewery/models"
 	"fmt"
 	"strings"
+	"time"
 )
 
-// FormatBeerInfo форматирует информацию о пиве для отправки пользователю.
-//
-// beer - структура с информацией о пиве.
-// detailed - флаг, указывающий, нужно ли выводить подробное описание.
-func FormatBeerInfo(beer models.Beer, detailed bool) string {
-	beerInfo := fmt.Sprintf("*%s - %s*\nЦена: %.2f\nВ наличии: %d", beer.Name, beer.Type, beer.Price, beer.Quantity)
-	if detailed {
-		beerInfo += fmt.Sprintf("\n%s", beer.Description) // Добавляем описание, если нужно
-	}
-	return beerInfo
-}
-
 // ContainsIgnoreCase проверяет, содержит ли строка s подстроку substr без учета регистра.
 func ContainsIgnoreCase(s, substr string) bool {
 	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
 }
+
+// FormatStars возвращает оценку от 1 до 5 в виде звезд, например "★★★☆☆".
+func FormatStars(rating int) string {
+	if rating < 0 {
+		rating = 0
+	}
+	if rating > 5 {
+		rating = 5
+	}
+	return strings.Repeat("★", rating) + strings.Repeat("☆", 5-rating)
+}
+
+// ParseDateRange разбирает период из дат from и to в формате ГГГГ-ММ-ДД в часовом поясе loc.
+// Дата to входит в период, поэтому end - начало следующего за ней дня. Пустая to означает
+// период из одного дня from.
+func ParseDateRange(from, to string, loc *time.Location) (start, end time.Time, err error) {
+	start, err = time.ParseInLocation(time.DateOnly, from, loc)
+	if err != nil {
+		return start, end, fmt.Errorf("некорректная дата %q, ожидается ГГГГ-ММ-ДД", from)
+	}
+	last := start
+	if to != "" {
+		last, err = time.ParseInLocation(time.DateOnly, to, loc)
+		if err != nil {
+			return start, end, fmt.Errorf("некорректная дата %q, ожидается ГГГГ-ММ-ДД", to)
+		}
+	}
+	if last.Before(start) {
+		return start, end, fmt.Errorf("дата окончания %s раньше даты начала %s", to, from)
+	}
+	return start, last.AddDate(0, 0, 1), nil
+}